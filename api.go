@@ -0,0 +1,62 @@
+package credhub
+
+// API is the set of operations that Client provides. Code that depends on API
+// rather than *Client can be tested against the in-memory fake in the
+// credhubtest package.
+type API interface {
+	// IsV1API returns true if the credhub API is version 1.x
+	IsV1API() bool
+
+	// WhoAmI returns the actor that Credhub identifies the client as
+	WhoAmI() (string, error)
+
+	// GetByID will look up a credental by its ID. It returns ErrNotFound if
+	// there is no credential with the ID.
+	GetByID(id string) (*Credential, error)
+
+	// GetAllByName will return all versions of a credential, newest first
+	GetAllByName(name string) ([]Credential, error)
+
+	// GetVersionsByName will return the latest numVersions versions of a credential, newest first
+	GetVersionsByName(name string, numVersions int) ([]Credential, error)
+
+	// GetLatestByName will return the current version of a credential. It
+	// returns an error that errors.Is reports as ErrNotFound if the credential
+	// doesn't exist, as do the other lookups by name.
+	GetLatestByName(name string) (*Credential, error)
+
+	// Set adds a credential in Credhub
+	Set(credential Credential, mode OverwriteMode, additionalPermissions []Permission) (*Credential, error)
+
+	// Generate will create a credential in Credhub
+	Generate(name string, credentialType CredentialType, parameters map[string]interface{}) (*Credential, error)
+
+	// Regenerate will generate new values for credentials using the same parameters as the stored value
+	Regenerate(name string) (*Credential, error)
+
+	// Delete deletes a credential by name
+	Delete(name string) error
+
+	// ListAllPaths lists all paths that have credentials
+	ListAllPaths() ([]string, error)
+
+	// FindByPath retrieves a list of stored credential names which are within the specified path
+	FindByPath(path string) ([]Credential, error)
+
+	// FindByPartialName retrieves a list of stored credential names which contain the search
+	FindByPartialName(partialName string) ([]Credential, error)
+
+	// GetPermissions returns the permissions of a credential
+	GetPermissions(credentialName string) ([]Permission, error)
+
+	// AddPermissions adds permissions to a credential
+	AddPermissions(credentialName string, newPerms []Permission) ([]Permission, error)
+
+	// DeletePermissions deletes permissions from a credential
+	DeletePermissions(credentialName, actorID string) error
+
+	// InterpolateCredentials interpolates the credhub-ref credentials of a VCAP_SERVICES JSON string
+	InterpolateCredentials(vcapServices string) (string, error)
+}
+
+var _ API = (*Client)(nil)
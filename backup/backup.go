@@ -0,0 +1,300 @@
+/*
+Package backup snapshots every version of every credential under a path, along
+with their permissions, into an encrypted archive, and restores archives into
+the same or another Credhub.
+
+Example usage:
+
+	err := backup.Backup(client, "/concourse", file, passphrase)
+	...
+
+	archive, err := backup.Read(file, passphrase)
+	if err != nil {
+		...
+	}
+
+	results, err := archive.Restore(otherClient, backup.RestoreOptions{})
+
+Archives are encrypted with AES-256-GCM, with a key derived from the passphrase
+with PBKDF2-HMAC-SHA256, so they can't be read or modified without it.
+
+Credhub doesn't allow the history of a credential to be written directly, so
+restoring sets each version in the order it was created, across every
+credential in the archive. The restored versions have new IDs and creation
+times, and generated credentials lose the parameters they were generated with.
+
+*/
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// Archive is the contents of a backup
+type Archive struct {
+	// Prefix is the path that was backed up
+	Prefix string `json:"prefix"`
+
+	// Created is when the backup was taken
+	Created time.Time `json:"created"`
+
+	// Credentials are the credentials under Prefix, in order of name
+	Credentials []Credential `json:"credentials"`
+}
+
+// Credential is the history and permissions of a single credential
+type Credential struct {
+	Name string `json:"name"`
+
+	// Versions are every version of the credential, oldest first
+	Versions []credhub.Credential `json:"versions"`
+
+	// Permissions are the permissions of the credential. They are only backed
+	// up from servers with the 1.x API.
+	Permissions []credhub.Permission `json:"permissions,omitempty"`
+}
+
+// Snapshot reads every version of every credential under prefix, and their
+// permissions if the server has the 1.x API
+func Snapshot(c credhub.API, prefix string) (*Archive, error) {
+	found, err := c.FindByPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(found))
+	for _, cred := range found {
+		names = append(names, cred.Name)
+	}
+	sort.Strings(names)
+
+	archive := &Archive{
+		Prefix:      prefix,
+		Created:     time.Now().UTC(),
+		Credentials: make([]Credential, 0, len(names)),
+	}
+
+	for _, name := range names {
+		versions, err := c.GetAllByName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// GetAllByName returns the newest first
+		sort.SliceStable(versions, func(i, j int) bool {
+			return versions[i].Created < versions[j].Created
+		})
+
+		cred := Credential{Name: name, Versions: versions}
+
+		if c.IsV1API() {
+			if cred.Permissions, err = c.GetPermissions(name); err != nil {
+				return nil, err
+			}
+		}
+
+		archive.Credentials = append(archive.Credentials, cred)
+	}
+
+	return archive, nil
+}
+
+// Backup writes an encrypted snapshot of every credential under prefix to w
+func Backup(c credhub.API, prefix string, w io.Writer, passphrase []byte) error {
+	archive, err := Snapshot(c, prefix)
+	if err != nil {
+		return err
+	}
+
+	return archive.Write(w, passphrase)
+}
+
+// Write encrypts the archive with passphrase, and writes it to w
+func (a *Archive) Write(w io.Writer, passphrase []byte) error {
+	buf := new(bytes.Buffer)
+
+	gz := gzip.NewWriter(buf)
+	if err := json.NewEncoder(gz).Encode(a); err != nil {
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return seal(w, buf.Bytes(), passphrase)
+}
+
+// Read decrypts an archive written by Write. If the passphrase is wrong, or the
+// archive has been modified, the error is ErrDecrypt.
+func Read(r io.Reader, passphrase []byte) (*Archive, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := open(buf, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	archive := new(Archive)
+	if err = json.NewDecoder(gz).Decode(archive); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// RestoreOptions control how an archive is restored
+type RestoreOptions struct {
+	// Prefix moves the credentials under this path instead of the one they
+	// were backed up from, e.g. to restore /prod into /staging
+	Prefix string
+
+	// SkipExisting leaves credentials that already exist alone, rather than
+	// adding the archived versions to their history
+	SkipExisting bool
+}
+
+// Result is the outcome of restoring a single credential
+type Result struct {
+	// Name is the name the credential was restored as
+	Name string
+
+	// Versions is the number of versions that were restored
+	Versions int
+
+	// Permissions is the number of permissions that were restored
+	Permissions int
+
+	// Skipped is true if the credential already existed and SkipExisting was
+	// set
+	Skipped bool
+
+	// Err is why the credential could not be fully restored. Once a version
+	// fails, the later versions of the credential are not restored.
+	Err error
+}
+
+/*
+
+Restore sets every version of every credential in the archive, in the order
+they were created, and then adds their permissions if the server has the 1.x
+API. Permissions of the actor that Restore authenticates as are left alone,
+since it has every permission on credentials it creates.
+
+A credential that fails doesn't stop the others from being restored; the result
+of each is returned. The error is only non-nil if the actor can't be
+identified.
+
+*/
+func (a *Archive) Restore(c credhub.API, opts RestoreOptions) ([]Result, error) {
+	actor, err := c.WhoAmI()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(a.Credentials))
+
+	type version struct {
+		index int
+		cred  credhub.Credential
+	}
+	var versions []version
+
+	for i, cred := range a.Credentials {
+		results[i].Name = a.restoredName(cred.Name, opts.Prefix)
+
+		if opts.SkipExisting {
+			if _, err := c.GetLatestByName(results[i].Name); err == nil {
+				results[i].Skipped = true
+				continue
+			}
+		}
+
+		for _, v := range cred.Versions {
+			versions = append(versions, version{index: i, cred: v})
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].cred.Created < versions[j].cred.Created
+	})
+
+	for _, v := range versions {
+		result := &results[v.index]
+		if result.Err != nil {
+			continue
+		}
+
+		cred := credhub.Credential{
+			Name:  result.Name,
+			Type:  v.cred.Type,
+			Value: credhub.SettableValue(v.cred),
+		}
+
+		if _, err := c.Set(cred, credhub.Overwrite, nil); err != nil {
+			result.Err = err
+			continue
+		}
+		result.Versions++
+	}
+
+	if !c.IsV1API() {
+		return results, nil
+	}
+
+	for i, cred := range a.Credentials {
+		result := &results[i]
+		if result.Skipped || result.Err != nil {
+			continue
+		}
+
+		var perms []credhub.Permission
+		for _, perm := range cred.Permissions {
+			if perm.Actor != actor {
+				perms = append(perms, perm)
+			}
+		}
+
+		if len(perms) == 0 {
+			continue
+		}
+
+		if _, err := c.AddPermissions(result.Name, perms); err != nil {
+			result.Err = err
+			continue
+		}
+		result.Permissions = len(perms)
+	}
+
+	return results, nil
+}
+
+// restoredName returns the name to restore a credential as
+func (a *Archive) restoredName(name, prefix string) string {
+	if prefix == "" {
+		return name
+	}
+
+	from := strings.TrimSuffix(a.Prefix, "/") + "/"
+	to := strings.TrimSuffix(prefix, "/") + "/"
+
+	return to + strings.TrimPrefix(name, from)
+}
@@ -0,0 +1,167 @@
+package backup_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/backup"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestBackup(t *testing.T) {
+	spec.Run(t, "Backup", testBackup, spec.Report(report.Terminal{}))
+}
+
+func testBackup(t *testing.T, when spec.G, it spec.S) {
+	var (
+		source     *credhubtest.FakeClient
+		passphrase = []byte("correct horse battery staple")
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		source = credhubtest.NewFakeClient(credhubtest.Version1)
+		source.Seed(
+			credhub.Credential{Name: "/prod/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "first"}},
+			credhub.Credential{Name: "/prod/token", Type: credhub.Value, Value: "token"},
+			credhub.Credential{Name: "/prod/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "second"}},
+			credhub.Credential{Name: "/prod/nested/config", Type: credhub.JSON, Value: map[string]interface{}{"port": 5432.0}},
+			credhub.Credential{Name: "/other/secret", Type: credhub.Password, Value: "secret"},
+		)
+		source.SeedPermissions("/prod/db", credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read}})
+	})
+
+	it("snapshots every version and permission under a path", func() {
+		archive, err := backup.Snapshot(source, "/prod")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archive.Prefix).To(Equal("/prod"))
+		Expect(archive.Credentials).To(HaveLen(3))
+
+		db := archive.Credentials[0]
+		Expect(db.Name).To(Equal("/prod/db"))
+		Expect(db.Versions).To(HaveLen(2))
+		Expect(db.Versions[0].Value).To(HaveKeyWithValue("password", "first"))
+		Expect(db.Versions[1].Value).To(HaveKeyWithValue("password", "second"))
+		Expect(db.Permissions).To(ContainElement(credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read}}))
+
+		Expect(archive.Credentials[1].Name).To(Equal("/prod/nested/config"))
+		Expect(archive.Credentials[2].Name).To(Equal("/prod/token"))
+	})
+
+	it("doesn't back up permissions from v2 servers", func() {
+		v2 := credhubtest.NewFakeClient(credhubtest.Version2)
+		v2.Seed(credhub.Credential{Name: "/prod/token", Type: credhub.Value, Value: "token"})
+
+		archive, err := backup.Snapshot(v2, "/prod")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archive.Credentials).To(HaveLen(1))
+		Expect(archive.Credentials[0].Permissions).To(BeNil())
+	})
+
+	it("round trips through an encrypted archive and restores the history", func() {
+		var buf bytes.Buffer
+		Expect(backup.Backup(source, "/prod", &buf, passphrase)).To(Succeed())
+		Expect(buf.String()).NotTo(ContainSubstring("second"))
+
+		encrypted := buf.Bytes()
+
+		_, err := backup.Read(bytes.NewReader(encrypted), []byte("wrong"))
+		Expect(err).To(Equal(backup.ErrDecrypt))
+
+		tampered := append([]byte(nil), encrypted...)
+		tampered[len(tampered)-1] ^= 1
+		_, err = backup.Read(bytes.NewReader(tampered), passphrase)
+		Expect(err).To(Equal(backup.ErrDecrypt))
+
+		archive, err := backup.Read(bytes.NewReader(encrypted), passphrase)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archive.Credentials).To(HaveLen(3))
+
+		target := credhubtest.NewFakeClient(credhubtest.Version1)
+		target.Seed(credhub.Credential{Name: "/staging/token", Type: credhub.Value, Value: "existing"})
+
+		results, err := archive.Restore(target, backup.RestoreOptions{Prefix: "/staging", SkipExisting: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]backup.Result{
+			{Name: "/staging/db", Versions: 2, Permissions: 1},
+			{Name: "/staging/nested/config", Versions: 1},
+			{Name: "/staging/token", Skipped: true},
+		}))
+
+		versions, err := target.GetAllByName("/staging/db")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions).To(HaveLen(2))
+		Expect(versions[0].Value).To(HaveKeyWithValue("password", "second"))
+		Expect(versions[1].Value).To(HaveKeyWithValue("password", "first"))
+
+		perms, err := target.GetPermissions("/staging/db")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(perms).To(ContainElement(credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read}}))
+
+		token, err := target.GetLatestByName("/staging/token")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.Value).To(Equal("existing"))
+
+		_, err = target.GetLatestByName("/staging/secret")
+		Expect(err).To(HaveOccurred())
+	})
+
+	it("restores into the same path and reports failures", func() {
+		archive, err := backup.Snapshot(source, "/prod")
+		Expect(err).NotTo(HaveOccurred())
+
+		target := credhubtest.NewFakeClient(credhubtest.Version2)
+		target.Seed(credhub.Credential{Name: "/prod/token", Type: credhub.Password, Value: "different type"})
+
+		results, err := archive.Restore(target, backup.RestoreOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results[0]).To(Equal(backup.Result{Name: "/prod/db", Versions: 2}))
+		Expect(results[2].Name).To(Equal("/prod/token"))
+		Expect(results[2].Err).To(HaveOccurred())
+	})
+
+	it("doesn't count writes the server rejects", func() {
+		archive, err := backup.Snapshot(source, "/prod")
+		Expect(err).NotTo(HaveOccurred())
+
+		server := credhubtest.NewServer(credhubtest.Version1)
+		defer server.Close()
+
+		target, err := server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+
+		server.InjectFault(http.MethodPut, "/api/v1/data", credhubtest.Fault{Status: http.StatusForbidden})
+		results, err := archive.Restore(target, backup.RestoreOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(3))
+		for _, result := range results {
+			Expect(result.Versions).To(BeZero())
+			Expect(result.Err).To(MatchError(ContainSubstring("got 403 Forbidden")))
+		}
+
+		server.ClearFaults()
+		server.InjectFault(http.MethodPost, "/api/v1/permissions", credhubtest.Fault{Status: http.StatusForbidden})
+		results, err = archive.Restore(target, backup.RestoreOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results[0].Name).To(Equal("/prod/db"))
+		Expect(results[0].Versions).To(Equal(2))
+		Expect(results[0].Permissions).To(BeZero())
+		Expect(results[0].Err).To(MatchError(ContainSubstring("got 403 Forbidden")))
+	})
+
+	it("requires a passphrase", func() {
+		archive, err := backup.Snapshot(source, "/prod")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archive.Write(new(bytes.Buffer), nil)).To(MatchError("a passphrase is required"))
+
+		_, err = backup.Read(bytes.NewReader([]byte("not an archive")), passphrase)
+		Expect(err).To(MatchError("not a backup archive"))
+	})
+}
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrDecrypt is returned when an archive can not be decrypted, because the
+// passphrase is wrong or the archive has been modified
+var ErrDecrypt = errors.New("unable to decrypt backup: wrong passphrase or corrupted archive")
+
+// magic identifies backup archives, and the version of their format
+var magic = []byte("go-credhub-backup\x01")
+
+const (
+	// kdfIterations is the number of PBKDF2-HMAC-SHA256 iterations used to
+	// derive keys from passphrases
+	kdfIterations = 600000
+
+	saltSize = 16
+	keySize  = 32
+)
+
+/*
+
+seal encrypts plaintext with a key derived from passphrase, and writes it to w
+as an archive laid out as:
+
+	magic | iterations (uint32, big endian) | salt | nonce | ciphertext
+
+The key is derived from the passphrase and salt with PBKDF2-HMAC-SHA256, and
+the plaintext is sealed with AES-256-GCM. Everything before the ciphertext is
+authenticated as additional data, so that the parameters can't be changed
+without detection.
+
+*/
+func seal(w io.Writer, plaintext, passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return errors.New("a passphrase is required")
+	}
+
+	header := new(bytes.Buffer)
+	header.Write(magic)
+	header.Write(binary.BigEndian.AppendUint32(nil, kdfIterations))
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	header.Write(salt)
+
+	aead, err := newAEAD(passphrase, salt, kdfIterations)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	header.Write(nonce)
+
+	ciphertext := aead.Seal(nil, nonce, plaintext, header.Bytes())
+
+	if _, err = w.Write(header.Bytes()); err != nil {
+		return err
+	}
+
+	_, err = w.Write(ciphertext)
+	return err
+}
+
+// open decrypts an archive written by seal
+func open(archive, passphrase []byte) ([]byte, error) {
+	if !bytes.HasPrefix(archive, magic) {
+		return nil, errors.New("not a backup archive")
+	}
+
+	rest := archive[len(magic):]
+	if len(rest) < 4+saltSize {
+		return nil, ErrDecrypt
+	}
+
+	iterations := binary.BigEndian.Uint32(rest)
+	if iterations == 0 || iterations > 100*kdfIterations {
+		return nil, fmt.Errorf("unsupported number of key derivation iterations %d", iterations)
+	}
+	salt := rest[4 : 4+saltSize]
+
+	aead, err := newAEAD(passphrase, salt, int(iterations))
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := len(magic) + 4 + saltSize + aead.NonceSize()
+	if len(archive) < headerSize {
+		return nil, ErrDecrypt
+	}
+
+	header := archive[:headerSize]
+	nonce := archive[headerSize-aead.NonceSize() : headerSize]
+
+	plaintext, err := aead.Open(nil, nonce, archive[headerSize:], header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
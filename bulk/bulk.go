@@ -0,0 +1,266 @@
+/*
+Package bulk imports and exports credentials in the YAML format used by the
+credhub CLI's import and export commands, e.g. to move credentials between
+foundations:
+
+	credentials:
+	- name: /concourse/main/db
+	  type: user
+	  value:
+	    username: admin
+	    password: hunter2
+	- name: /concourse/main/token
+	  type: value
+	  value: abc123
+
+Example usage:
+
+	results, err := bulk.Export(source, "/concourse", file)
+	...
+	results, err = bulk.Import(target, file, bulk.Options{DryRun: true})
+	if err != nil {
+		...
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s: %v\n", result.Name, result.Err)
+		}
+	}
+
+*/
+package bulk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/internal/yamljson"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// File is the contents of an import or export file
+type File struct {
+	Credentials []Entry `yaml:"credentials"`
+}
+
+// Entry is a single credential in an import or export file
+type Entry struct {
+	Name  string                 `yaml:"name"`
+	Type  credhub.CredentialType `yaml:"type"`
+	Value interface{}            `yaml:"value"`
+}
+
+// Result is the outcome of importing or exporting a single credential
+type Result struct {
+	Name string
+	Type credhub.CredentialType
+
+	// Err is why the credential could not be imported or exported, or nil if
+	// it was (or, in a dry run, would have been)
+	Err error
+}
+
+// Options control how credentials are imported
+type Options struct {
+	// DryRun checks every entry without setting any credentials
+	DryRun bool
+
+	// Mode is passed to Set. Leave it empty to overwrite existing credentials,
+	// as the credhub CLI does.
+	Mode credhub.OverwriteMode
+}
+
+// objectFields are the fields of each type of credential with an object value,
+// including those that are only returned by the server (and so appear in
+// exports from the credhub CLI), which are dropped on import
+var objectFields = map[credhub.CredentialType]map[string]bool{
+	credhub.User:        {"username": true, "password": true, "password_hash": true},
+	credhub.Certificate: {"ca": true, "ca_name": true, "certificate": true, "private_key": true},
+	credhub.RSA:         {"public_key": true, "private_key": true},
+	credhub.SSH:         {"public_key": true, "private_key": true, "public_key_fingerprint": true},
+}
+
+/*
+
+Import sets every credential in an import file read from r. Entries are imported
+in order, and an entry that fails does not stop the rest from being imported;
+the result of each is returned. The error is only non-nil if the file can't be
+read.
+
+Before anything is set, each entry is checked: it must have a name, one of the
+seven credential types, and a value of the right form for its type. Fields that
+the server returns but won't accept (like the password_hash of a user) are
+dropped, so exports can be imported as they are.
+
+*/
+func Import(c credhub.API, r io.Reader, opts Options) ([]Result, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	if err = yaml.Unmarshal(buf, &file); err != nil {
+		return nil, err
+	}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = credhub.Overwrite
+	}
+
+	results := make([]Result, 0, len(file.Credentials))
+	for i, entry := range file.Credentials {
+		result := Result{Name: entry.Name, Type: entry.Type}
+
+		cred, err := credential(entry)
+		if err != nil {
+			result.Err = err
+			if entry.Name == "" {
+				result.Name = fmt.Sprintf("credentials[%d]", i)
+			}
+		} else if !opts.DryRun {
+			if _, err = c.Set(cred, mode, nil); err != nil {
+				result.Err = err
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+/*
+
+Export writes every credential under prefix (e.g. "/concourse") to w as an
+import file, in order of name. Only the latest version of each credential is
+exported.
+
+A credential that can not be read is left out of the file, and its result has
+the reason; the results of the others are returned too. The error is only
+non-nil if the credentials can't be listed or the file can't be written.
+
+*/
+func Export(c credhub.API, prefix string, w io.Writer) ([]Result, error) {
+	found, err := c.FindByPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(found))
+	for _, cred := range found {
+		names = append(names, cred.Name)
+	}
+	sort.Strings(names)
+
+	var file File
+	results := make([]Result, 0, len(names))
+	for _, name := range names {
+		cred, err := c.GetLatestByName(name)
+		if err != nil {
+			results = append(results, Result{Name: name, Err: err})
+			continue
+		}
+
+		entry := Entry{Name: cred.Name, Type: cred.Type, Value: credhub.SettableValue(*cred)}
+		if m, ok := entry.Value.(map[string]interface{}); ok && objectFields[cred.Type] != nil {
+			entry.Value = withoutEmptyFields(m)
+		}
+
+		file.Credentials = append(file.Credentials, entry)
+		results = append(results, Result{Name: cred.Name, Type: cred.Type})
+	}
+
+	out, err := yaml.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(out); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// credential checks an entry, and returns the credential to set for it
+func credential(entry Entry) (credhub.Credential, error) {
+	cred := credhub.Credential{Name: entry.Name, Type: entry.Type}
+
+	if entry.Name == "" {
+		return cred, errors.New("name is missing")
+	}
+
+	if entry.Value == nil {
+		return cred, errors.New("value is missing")
+	}
+
+	value, err := yamljson.Convert(entry.Value)
+	if err != nil {
+		return cred, err
+	}
+
+	switch entry.Type {
+	case credhub.Value, credhub.Password:
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return cred, fmt.Errorf("the value of a %s credential must be a string", entry.Type)
+		}
+		cred.Value = fmt.Sprint(value)
+	case credhub.JSON:
+		if _, ok := value.(map[string]interface{}); !ok {
+			return cred, errors.New("the value of a json credential must be an object")
+		}
+		cred.Value = value
+	case credhub.User, credhub.Certificate, credhub.RSA, credhub.SSH:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return cred, fmt.Errorf("the value of a %s credential must be an object", entry.Type)
+		}
+
+		for key, v := range m {
+			if !objectFields[entry.Type][key] {
+				return cred, fmt.Errorf("%s credentials do not have a %q field", entry.Type, key)
+			}
+
+			if _, ok := v.(string); !ok && v != nil {
+				return cred, fmt.Errorf("the %s field must be a string", key)
+			}
+		}
+
+		cred.Value = withoutEmptyFields(m)
+		m = credhub.SettableValue(cred).(map[string]interface{})
+		if len(m) == 0 {
+			return cred, fmt.Errorf("the value of a %s credential must have at least one field", entry.Type)
+		}
+
+		if _, ok := m["password"]; entry.Type == credhub.User && !ok {
+			return cred, errors.New("the value of a user credential must have a password")
+		}
+		cred.Value = m
+	case "":
+		return cred, errors.New("type is missing")
+	default:
+		return cred, fmt.Errorf("unknown type %q", entry.Type)
+	}
+
+	return cred, nil
+}
+
+// withoutEmptyFields returns the fields of an object value that aren't empty
+func withoutEmptyFields(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for key, v := range m {
+		if v != nil && v != "" {
+			out[key] = v
+		}
+	}
+
+	return out
+}
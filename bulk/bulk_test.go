@@ -0,0 +1,225 @@
+package bulk_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/bulk"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestBulk(t *testing.T) {
+	spec.Run(t, "Bulk", testBulk, spec.Report(report.Terminal{}))
+}
+
+const importFile = `credentials:
+- name: /test/value
+  type: value
+  value: 8080
+- name: /test/password
+  type: password
+  value: hunter2
+- name: /test/json
+  type: json
+  value:
+    hosts: [a, b]
+    nested:
+      retries: 3
+- name: /test/user
+  type: user
+  value:
+    username: admin
+    password: secret
+    password_hash: $6$hash
+- name: /test/certificate
+  type: certificate
+  value:
+    ca: CA
+    certificate: CERT
+    private_key: KEY
+- name: /test/rsa
+  type: rsa
+  value:
+    public_key: PUBLIC
+    private_key: PRIVATE
+- name: /test/ssh
+  type: ssh
+  value:
+    public_key: ssh-rsa PUBLIC
+    private_key: PRIVATE
+    public_key_fingerprint: FINGERPRINT
+`
+
+func testBulk(t *testing.T, when spec.G, it spec.S) {
+	var fake *credhubtest.FakeClient
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		fake = credhubtest.NewFakeClient(credhubtest.Version2)
+	})
+
+	when("importing", func() {
+		it("sets credentials of every type", func() {
+			results, err := bulk.Import(fake, strings.NewReader(importFile), bulk.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(7))
+			for _, result := range results {
+				Expect(result.Err).NotTo(HaveOccurred(), result.Name)
+			}
+
+			value, err := fake.GetLatestByName("/test/value")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value.Value).To(Equal("8080"))
+
+			json, err := fake.GetLatestByName("/test/json")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Value).To(Equal(map[string]interface{}{
+				"hosts":  []interface{}{"a", "b"},
+				"nested": map[string]interface{}{"retries": 3.0},
+			}))
+
+			user, err := fake.GetLatestByName("/test/user")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user.Type).To(Equal(credhub.User))
+			Expect(user.Value).To(HaveKeyWithValue("password", "secret"))
+			Expect(user.Value).NotTo(HaveKeyWithValue("password_hash", "$6$hash"))
+
+			ssh, err := fake.GetLatestByName("/test/ssh")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ssh.Value).To(HaveKeyWithValue("private_key", "PRIVATE"))
+		})
+
+		it("doesn't set anything in a dry run", func() {
+			results, err := bulk.Import(fake, strings.NewReader(importFile), bulk.Options{DryRun: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(7))
+
+			found, err := fake.FindByPath("/test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeEmpty())
+		})
+
+		it("reports invalid entries and imports the rest", func() {
+			file := `credentials:
+- type: value
+  value: no name
+- name: /test/no-type
+  value: x
+- name: /test/bad-type
+  type: secret
+  value: x
+- name: /test/no-value
+  type: password
+- name: /test/list
+  type: value
+  value: [a, b]
+- name: /test/json-string
+  type: json
+  value: x
+- name: /test/bad-field
+  type: rsa
+  value:
+    private: x
+- name: /test/no-password
+  type: user
+  value:
+    username: admin
+- name: /test/good
+  type: value
+  value: good
+`
+			results, err := bulk.Import(fake, strings.NewReader(file), bulk.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(9))
+
+			Expect(results[0].Name).To(Equal("credentials[0]"))
+			Expect(results[0].Err).To(MatchError("name is missing"))
+			Expect(results[1].Err).To(MatchError("type is missing"))
+			Expect(results[2].Err).To(MatchError(`unknown type "secret"`))
+			Expect(results[3].Err).To(MatchError("value is missing"))
+			Expect(results[4].Err).To(MatchError("the value of a value credential must be a string"))
+			Expect(results[5].Err).To(MatchError("the value of a json credential must be an object"))
+			Expect(results[6].Err).To(MatchError(`rsa credentials do not have a "private" field`))
+			Expect(results[7].Err).To(MatchError("the value of a user credential must have a password"))
+			Expect(results[8].Err).NotTo(HaveOccurred())
+
+			found, err := fake.FindByPath("/test")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(HaveLen(1))
+		})
+
+		it("reports errors from the server", func() {
+			fake.Seed(credhub.Credential{Name: "/test/value", Type: credhub.Password, Value: "x"})
+
+			results, err := bulk.Import(fake, strings.NewReader(importFile), bulk.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[0].Err).To(HaveOccurred())
+			Expect(results[1].Err).NotTo(HaveOccurred())
+		})
+
+		it("reports writes the server rejects", func() {
+			server := credhubtest.NewServer(credhubtest.Version2)
+			defer server.Close()
+			server.Seed(credhub.Credential{Name: "/test/value", Type: credhub.Password, Value: "x"})
+
+			client, err := server.NewClient()
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := bulk.Import(client, strings.NewReader(importFile), bulk.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results[0].Err).To(MatchError(ContainSubstring("got 400 Bad Request: The credential type cannot be modified")))
+			Expect(results[1].Err).NotTo(HaveOccurred())
+
+			cred, err := client.GetLatestByName("/test/value")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Type).To(Equal(credhub.Password))
+		})
+
+		it("rejects files that aren't YAML", func() {
+			_, err := bulk.Import(fake, strings.NewReader("credentials: ["), bulk.Options{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("exporting", func() {
+		it("writes a file that can be imported", func() {
+			_, err := bulk.Import(fake, strings.NewReader(importFile), bulk.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			fake.Seed(credhub.Credential{Name: "/other/value", Type: credhub.Value, Value: "other"})
+
+			var out bytes.Buffer
+			results, err := bulk.Export(fake, "/test", &out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(7))
+			Expect(results[0]).To(Equal(bulk.Result{Name: "/test/certificate", Type: credhub.Certificate}))
+
+			Expect(out.String()).To(HavePrefix("credentials:\n- name: /test/certificate\n  type: certificate\n"))
+			Expect(out.String()).NotTo(ContainSubstring("/other/value"))
+			Expect(out.String()).NotTo(ContainSubstring("password_hash"))
+			Expect(out.String()).NotTo(ContainSubstring("public_key_fingerprint"))
+
+			target := credhubtest.NewFakeClient(credhubtest.Version1)
+			results, err = bulk.Import(target, &out, bulk.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(7))
+
+			for _, name := range []string{"/test/json", "/test/user", "/test/ssh"} {
+				original, err := fake.GetLatestByName(name)
+				Expect(err).NotTo(HaveOccurred())
+				imported, err := target.GetLatestByName(name)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(imported.Type).To(Equal(original.Type))
+				if original.Type == credhub.JSON {
+					Expect(imported.Value).To(Equal(original.Value))
+				}
+			}
+		})
+	})
+}
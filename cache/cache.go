@@ -0,0 +1,324 @@
+/*
+Package cache wraps a credhub.API with a read-through cache, for services that
+read the same credentials on every request.
+
+The latest versions of credentials, and credentials looked up by ID, are cached
+for a TTL, and the least recently used are evicted once there are too many.
+Credentials that don't exist can be cached too, for a shorter TTL. Once an
+entry expires it can still be served for a while, while it is refreshed in the
+background, so that requests don't wait on Credhub.
+
+Writes made through the cache update it, so a service always reads its own
+writes; writes made elsewhere are seen once the entry expires, or after it is
+invalidated.
+
+Example usage:
+
+	cached := cache.New(client, cache.Options{
+		TTL:         time.Minute,
+		StaleTTL:    10 * time.Minute,
+		NotFoundTTL: 10 * time.Second,
+		MaxSize:     1000,
+	})
+
+	cred, err := cached.GetLatestByName("/concourse/main/db")
+
+*/
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// DefaultTTL is the TTL of entries if Options.TTL is not set
+const DefaultTTL = time.Minute
+
+// Options control how long credentials are cached, and how many
+type Options struct {
+	// TTL is how long a credential is served from the cache before it is read
+	// again. The default is DefaultTTL.
+	TTL time.Duration
+
+	// StaleTTL is how long after an entry expires that it is still served,
+	// while it is refreshed in the background. Once it has passed, requests
+	// wait for the credential to be read again. The default is 0, which never
+	// serves expired entries.
+	StaleTTL time.Duration
+
+	// NotFoundTTL is how long that credentials which don't exist are cached as
+	// not found. The default is 0, which doesn't cache them.
+	NotFoundTTL time.Duration
+
+	// MaxSize is the most entries that are cached, after which the least
+	// recently used are evicted. The default is 0, which is unlimited.
+	MaxSize int
+
+	// Clock is used to expire entries. The default is the system clock.
+	Clock clock.Clock
+}
+
+// Client is a credhub.API that caches GetLatestByName and GetByID. Every other
+// method is passed through to the wrapped API.
+//
+// The credentials it returns are shared with the cache, and must not be
+// modified.
+type Client struct {
+	credhub.API
+
+	opts Options
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	lru     *list.List
+	loads   map[string]*load
+}
+
+type entry struct {
+	key  string
+	cred *credhub.Credential
+	err  error
+
+	// expires is when the entry has to be refreshed, and stale when it can no
+	// longer be served
+	expires time.Time
+	stale   time.Time
+
+	elem *list.Element
+}
+
+// load is a read from Credhub that is in flight
+type load struct {
+	done chan struct{}
+	cred *credhub.Credential
+	err  error
+}
+
+// New wraps a credhub.API with a cache
+func New(c credhub.API, opts Options) *Client {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = clock.NewClock()
+	}
+
+	return &Client{
+		API:     c,
+		opts:    opts,
+		entries: make(map[string]*entry),
+		lru:     list.New(),
+		loads:   make(map[string]*load),
+	}
+}
+
+// GetLatestByName returns the current version of a credential from the cache,
+// reading it from Credhub if it isn't cached or has expired
+func (c *Client) GetLatestByName(name string) (*credhub.Credential, error) {
+	return c.get(nameKey(name), func() (*credhub.Credential, error) {
+		return c.API.GetLatestByName(name)
+	})
+}
+
+// GetByID returns a version of a credential from the cache, reading it from
+// Credhub if it isn't cached or has expired
+func (c *Client) GetByID(id string) (*credhub.Credential, error) {
+	return c.get(idKey(id), func() (*credhub.Credential, error) {
+		return c.API.GetByID(id)
+	})
+}
+
+// Set adds a credential in Credhub, and caches it as the latest version
+func (c *Client) Set(credential credhub.Credential, mode credhub.OverwriteMode, additionalPermissions []credhub.Permission) (*credhub.Credential, error) {
+	cred, err := c.API.Set(credential, mode, additionalPermissions)
+	c.written(credential.Name, cred, err)
+	return cred, err
+}
+
+// Generate creates a credential in Credhub, and caches it as the latest version
+func (c *Client) Generate(name string, credentialType credhub.CredentialType, parameters map[string]interface{}) (*credhub.Credential, error) {
+	cred, err := c.API.Generate(name, credentialType, parameters)
+	c.written(name, cred, err)
+	return cred, err
+}
+
+// Regenerate generates a new value for a credential in Credhub, and caches it
+// as the latest version
+func (c *Client) Regenerate(name string) (*credhub.Credential, error) {
+	cred, err := c.API.Regenerate(name)
+	c.written(name, cred, err)
+	return cred, err
+}
+
+// Delete deletes a credential from Credhub, and all of its versions from the
+// cache
+func (c *Client) Delete(name string) error {
+	err := c.API.Delete(name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidate(nameKey(name))
+	for key, e := range c.entries {
+		if e.cred != nil && normalizeName(e.cred.Name) == normalizeName(name) {
+			c.invalidate(key)
+		}
+	}
+
+	return err
+}
+
+// Invalidate removes the latest version of a credential from the cache, so
+// the next read gets it from Credhub
+func (c *Client) Invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidate(nameKey(name))
+}
+
+// InvalidateAll empties the cache
+func (c *Client) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*entry)
+	c.lru.Init()
+	c.loads = make(map[string]*load)
+}
+
+// Len returns the number of entries in the cache
+func (c *Client) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// get returns an entry if it is fresh, or stale while it is refreshed, and
+// otherwise waits for it to be read. Concurrent reads of the same entry share
+// a single load.
+func (c *Client) get(key string, read func() (*credhub.Credential, error)) (*credhub.Credential, error) {
+	c.mu.Lock()
+
+	now := c.opts.Clock.Now()
+	if e, ok := c.entries[key]; ok && now.Before(e.stale) {
+		c.lru.MoveToFront(e.elem)
+		if !now.Before(e.expires) && c.loads[key] == nil {
+			c.start(key, read)
+		}
+
+		cred, err := e.cred, e.err
+		c.mu.Unlock()
+		return cred, err
+	}
+
+	l := c.loads[key]
+	if l == nil {
+		l = c.start(key, read)
+	}
+	c.mu.Unlock()
+
+	<-l.done
+	return l.cred, l.err
+}
+
+// start reads an entry in the background. The result is only cached if the
+// entry hasn't been written or invalidated in the meantime, so that a slow
+// read can't replace a newer version. It must be called with the lock held.
+func (c *Client) start(key string, read func() (*credhub.Credential, error)) *load {
+	l := &load{done: make(chan struct{})}
+	c.loads[key] = l
+
+	go func() {
+		l.cred, l.err = read()
+
+		c.mu.Lock()
+		if c.loads[key] == l {
+			delete(c.loads, key)
+			c.store(key, l.cred, l.err)
+		}
+		c.mu.Unlock()
+
+		close(l.done)
+	}()
+
+	return l
+}
+
+// store caches the result of a read. Credentials that are not found are
+// cached for NotFoundTTL, and other errors are not cached, leaving any stale
+// entry to be served. It must be called with the lock held.
+func (c *Client) store(key string, cred *credhub.Credential, err error) {
+	ttl := c.opts.TTL
+	if err != nil {
+		if !errors.Is(err, credhub.ErrNotFound) || c.opts.NotFoundTTL <= 0 {
+			return
+		}
+		ttl = c.opts.NotFoundTTL
+	}
+
+	e, ok := c.entries[key]
+	if !ok {
+		e = &entry{key: key}
+		e.elem = c.lru.PushFront(e)
+		c.entries[key] = e
+	} else {
+		c.lru.MoveToFront(e.elem)
+	}
+
+	now := c.opts.Clock.Now()
+	e.cred, e.err = cred, err
+	e.expires = now.Add(ttl)
+	e.stale = e.expires.Add(c.opts.StaleTTL)
+
+	for c.opts.MaxSize > 0 && c.lru.Len() > c.opts.MaxSize {
+		c.invalidate(c.lru.Back().Value.(*entry).key)
+	}
+}
+
+// written caches the result of a write as the latest version of a credential,
+// or invalidates it if the write failed or didn't return the stored
+// credential. Loads that are in flight are abandoned, so they can't replace it.
+func (c *Client) written(name string, cred *credhub.Credential, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := nameKey(name)
+	c.invalidate(key)
+	if err == nil && cred != nil && cred.ID != "" {
+		c.store(key, cred, nil)
+	}
+}
+
+// invalidate removes an entry, and abandons any load of it. It must be called
+// with the lock held.
+func (c *Client) invalidate(key string) {
+	if e, ok := c.entries[key]; ok {
+		c.lru.Remove(e.elem)
+		delete(c.entries, key)
+	}
+
+	delete(c.loads, key)
+}
+
+// nameKey is the key of the latest version of a credential. Credhub adds a
+// leading / to names that don't have one, so "foo" and "/foo" share an entry.
+func nameKey(name string) string {
+	return "name:" + normalizeName(name)
+}
+
+func normalizeName(name string) string {
+	return "/" + strings.TrimPrefix(name, "/")
+}
+
+func idKey(id string) string {
+	return "id:" + id
+}
@@ -0,0 +1,379 @@
+package cache_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/cache"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestCache(t *testing.T) {
+	spec.Run(t, "Cache", testCache, spec.Report(report.Terminal{}))
+}
+
+// countingAPI counts the reads that reach Credhub, and can hold them until
+// they are released
+type countingAPI struct {
+	credhub.API
+
+	mu    sync.Mutex
+	reads int
+	fail  error
+	hold  chan struct{}
+}
+
+func (c *countingAPI) GetLatestByName(name string) (*credhub.Credential, error) {
+	c.mu.Lock()
+	c.reads++
+	hold, fail := c.hold, c.fail
+	c.mu.Unlock()
+
+	if hold != nil {
+		<-hold
+	}
+
+	if fail != nil {
+		return nil, fail
+	}
+
+	return c.API.GetLatestByName(name)
+}
+
+func (c *countingAPI) GetByID(id string) (*credhub.Credential, error) {
+	c.mu.Lock()
+	c.reads++
+	c.mu.Unlock()
+
+	return c.API.GetByID(id)
+}
+
+// emptySetAPI returns an empty credential from Set, as a server that didn't
+// store it might
+type emptySetAPI struct {
+	credhub.API
+}
+
+func (emptySetAPI) Set(credential credhub.Credential, mode credhub.OverwriteMode, additionalPermissions []credhub.Permission) (*credhub.Credential, error) {
+	return &credhub.Credential{}, nil
+}
+
+func (c *countingAPI) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.reads
+}
+
+func (c *countingAPI) holdReads() chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hold = make(chan struct{})
+	return c.hold
+}
+
+func (c *countingAPI) failReads(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fail = err
+}
+
+func testCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		fake    *credhubtest.FakeClient
+		api     *countingAPI
+		clock   *fakeclock.FakeClock
+		opts    cache.Options
+		cached  *cache.Client
+		setFake func(value string)
+	)
+
+	value := func(name string) interface{} {
+		cred, err := cached.GetLatestByName(name)
+		Expect(err).NotTo(HaveOccurred())
+		return cred.Value
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		fake = credhubtest.NewFakeClient(credhubtest.Version2)
+		fake.Seed(credhub.Credential{Name: "/a", Type: credhub.Value, Value: "1"})
+		setFake = func(v string) {
+			_, err := fake.Set(credhub.Credential{Name: "/a", Type: credhub.Value, Value: v}, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		api = &countingAPI{API: fake}
+		clock = fakeclock.NewFakeClock(time.Now())
+		opts = cache.Options{TTL: time.Minute, Clock: clock}
+		cached = cache.New(api, opts)
+	})
+
+	it("implements credhub.API", func() {
+		var _ credhub.API = cached
+	})
+
+	it("caches the latest version for the TTL", func() {
+		Expect(value("/a")).To(Equal("1"))
+		setFake("2")
+		Expect(value("/a")).To(Equal("1"))
+		Expect(api.count()).To(Equal(1))
+
+		clock.Increment(59 * time.Second)
+		Expect(value("/a")).To(Equal("1"))
+
+		clock.Increment(time.Second)
+		Expect(value("/a")).To(Equal("2"))
+		Expect(api.count()).To(Equal(2))
+	})
+
+	it("caches credentials by ID", func() {
+		latest, err := fake.GetLatestByName("/a")
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 3; i++ {
+			cred, err := cached.GetByID(latest.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Value).To(Equal("1"))
+		}
+		Expect(api.count()).To(Equal(1))
+	})
+
+	it("shares concurrent reads", func() {
+		release := api.holdReads()
+
+		values := make(chan interface{}, 10)
+		for i := 0; i < 10; i++ {
+			go func() {
+				cred, err := cached.GetLatestByName("/a")
+				if err != nil {
+					values <- err
+					return
+				}
+				values <- cred.Value
+			}()
+		}
+
+		Eventually(api.count).Should(Equal(1))
+		close(release)
+		for i := 0; i < 10; i++ {
+			Expect(<-values).To(Equal("1"))
+		}
+		Expect(api.count()).To(Equal(1))
+	})
+
+	it("doesn't cache errors", func() {
+		api.failReads(errors.New("boom"))
+		_, err := cached.GetLatestByName("/a")
+		Expect(err).To(MatchError("boom"))
+
+		api.failReads(nil)
+		Expect(value("/a")).To(Equal("1"))
+		Expect(api.count()).To(Equal(2))
+	})
+
+	when("not found credentials are cached", func() {
+		it.Before(func() {
+			opts.NotFoundTTL = 10 * time.Second
+			cached = cache.New(api, opts)
+		})
+
+		it("caches them for the NotFoundTTL", func() {
+			_, err := cached.GetLatestByName("/missing")
+			Expect(err).To(MatchError("Name Not Found"))
+			_, err = cached.GetLatestByName("/missing")
+			Expect(err).To(MatchError("Name Not Found"))
+			Expect(api.count()).To(Equal(1))
+
+			fake.Seed(credhub.Credential{Name: "/missing", Type: credhub.Value, Value: "found"})
+			clock.Increment(10 * time.Second)
+			Expect(value("/missing")).To(Equal("found"))
+			Expect(api.count()).To(Equal(2))
+		})
+	})
+
+	it("doesn't cache not found credentials by default", func() {
+		_, err := cached.GetLatestByName("/missing")
+		Expect(err).To(HaveOccurred())
+		_, err = cached.GetLatestByName("/missing")
+		Expect(err).To(HaveOccurred())
+		Expect(api.count()).To(Equal(2))
+		Expect(cached.Len()).To(Equal(0))
+	})
+
+	when("there is a max size", func() {
+		it.Before(func() {
+			opts.MaxSize = 2
+			fake.Seed(
+				credhub.Credential{Name: "/b", Type: credhub.Value, Value: "b"},
+				credhub.Credential{Name: "/c", Type: credhub.Value, Value: "c"},
+			)
+			cached = cache.New(api, opts)
+		})
+
+		it("evicts the least recently used", func() {
+			value("/a")
+			value("/b")
+			value("/a")
+			value("/c")
+			Expect(cached.Len()).To(Equal(2))
+			Expect(api.count()).To(Equal(3))
+
+			value("/a")
+			value("/c")
+			Expect(api.count()).To(Equal(3))
+
+			value("/b")
+			Expect(api.count()).To(Equal(4))
+		})
+	})
+
+	when("stale entries are served", func() {
+		it.Before(func() {
+			opts.StaleTTL = time.Minute
+			cached = cache.New(api, opts)
+		})
+
+		it("refreshes them in the background", func() {
+			Expect(value("/a")).To(Equal("1"))
+			setFake("2")
+
+			release := api.holdReads()
+			clock.Increment(90 * time.Second)
+			Expect(value("/a")).To(Equal("1"))
+			Expect(value("/a")).To(Equal("1"))
+			Eventually(api.count).Should(Equal(2))
+
+			close(release)
+			Eventually(func() interface{} { return value("/a") }).Should(Equal("2"))
+			Expect(api.count()).To(Equal(2))
+		})
+
+		it("keeps serving them if the refresh fails", func() {
+			Expect(value("/a")).To(Equal("1"))
+
+			api.failReads(errors.New("boom"))
+			clock.Increment(90 * time.Second)
+			Expect(value("/a")).To(Equal("1"))
+			Eventually(api.count).Should(Equal(2))
+			Consistently(func() interface{} { return value("/a") }).Should(Equal("1"))
+
+			clock.Increment(30 * time.Second)
+			_, err := cached.GetLatestByName("/a")
+			Expect(err).To(MatchError("boom"))
+		})
+
+		it("waits once they are too old", func() {
+			Expect(value("/a")).To(Equal("1"))
+			setFake("2")
+
+			clock.Increment(2 * time.Minute)
+			Expect(value("/a")).To(Equal("2"))
+		})
+	})
+
+	when("writing through the cache", func() {
+		it("caches the new version", func() {
+			Expect(value("/a")).To(Equal("1"))
+
+			_, err := cached.Set(credhub.Credential{Name: "/a", Type: credhub.Value, Value: "2"}, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value("/a")).To(Equal("2"))
+
+			cred, err := cached.Generate("/p", credhub.Password, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value("/p")).To(Equal(cred.Value))
+
+			cred, err = cached.Regenerate("/p")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value("/p")).To(Equal(cred.Value))
+
+			Expect(api.count()).To(Equal(1))
+		})
+
+		it("doesn't cache credentials that weren't returned", func() {
+			cached = cache.New(emptySetAPI{api}, opts)
+			Expect(value("/a")).To(Equal("1"))
+
+			_, err := cached.Set(credhub.Credential{Name: "/a", Type: credhub.Value, Value: "2"}, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cached.Len()).To(Equal(0))
+			Expect(value("/a")).To(Equal("1"))
+			Expect(api.count()).To(Equal(2))
+		})
+
+		it("doesn't let reads in flight replace newer versions", func() {
+			release := api.holdReads()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				cached.GetLatestByName("/a")
+			}()
+			Eventually(api.count).Should(Equal(1))
+
+			_, err := cached.Set(credhub.Credential{Name: "/a", Type: credhub.Value, Value: "2"}, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			close(release)
+			<-done
+			Expect(value("/a")).To(Equal("2"))
+		})
+
+		it("treats names with and without a leading / as the same", func() {
+			Expect(value("/a")).To(Equal("1"))
+
+			_, err := cached.Set(credhub.Credential{Name: "a", Type: credhub.Value, Value: "2"}, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value("/a")).To(Equal("2"))
+			Expect(value("a")).To(Equal("2"))
+			Expect(api.count()).To(Equal(1))
+
+			latest, err := cached.GetLatestByName("/a")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cached.GetByID(latest.ID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cached.Delete("a")).To(Succeed())
+			Expect(cached.Len()).To(Equal(0))
+		})
+
+		it("forgets deleted credentials", func() {
+			latest, err := cached.GetLatestByName("/a")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cached.GetByID(latest.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cached.Len()).To(Equal(2))
+
+			Expect(cached.Delete("/a")).To(Succeed())
+			Expect(cached.Len()).To(Equal(0))
+
+			_, err = cached.GetLatestByName("/a")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	it("invalidates entries", func() {
+		Expect(value("/a")).To(Equal("1"))
+		setFake("2")
+
+		cached.Invalidate("/a")
+		Expect(value("/a")).To(Equal("2"))
+
+		setFake("3")
+		cached.InvalidateAll()
+		Expect(cached.Len()).To(Equal(0))
+		Expect(value("/a")).To(Equal("3"))
+		Expect(api.count()).To(Equal(3))
+	})
+}
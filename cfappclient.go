@@ -2,6 +2,7 @@ package credhub
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"net/http"
 	"os"
 )
@@ -20,7 +21,8 @@ func NewCFAppAuthClient(tr *http.Transport) (HTTPClient, error) {
 
 // CFAppAuthClient wraps an HTTPClient and handles mTLS authentication
 type CFAppAuthClient struct {
-	hc HTTPClient
+	hc   HTTPClient
+	cert *x509.Certificate
 }
 
 // Get will do an HTTP Request to the specified URL using the HTTP GET method
@@ -51,6 +53,10 @@ func (c *CFAppAuthClient) loadTLS(tr *http.Transport) error {
 		return err
 	}
 
+	if c.cert, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+
 	if modifiedTransport.TLSClientConfig == nil {
 		modifiedTransport.TLSClientConfig = &tls.Config{}
 	}
@@ -0,0 +1,207 @@
+package credhub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// cliClientID is the UAA client that the credhub CLI logs in with, and so the
+// one its refresh tokens are issued to
+const cliClientID = "credhub_cli"
+
+// CLIConfig is the login session that the credhub CLI stores, usually in
+// ~/.credhub/config.json
+type CLIConfig struct {
+	APIURL             string   `json:"ApiURL"`
+	AuthURL            string   `json:"AuthURL"`
+	AccessToken        string   `json:"AccessToken"`
+	RefreshToken       string   `json:"RefreshToken"`
+	InsecureSkipVerify bool     `json:"InsecureSkipVerify"`
+	CACerts            []string `json:"CaCerts"`
+	ServerVersion      string   `json:"ServerVersion"`
+}
+
+// DefaultCLIConfigPath returns the path that the credhub CLI stores its config in
+func DefaultCLIConfigPath() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+
+	return filepath.Join(home, ".credhub", "config.json")
+}
+
+// ReadCLIConfig reads a credhub CLI config file. If path is empty,
+// DefaultCLIConfigPath() is used.
+func ReadCLIConfig(path string) (*CLIConfig, error) {
+	if path == "" {
+		path = DefaultCLIConfigPath()
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(CLIConfig)
+	if err = json.Unmarshal(buf, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+/*
+
+NewFromCLIConfig creates a Credhub client that reuses the login session of the
+credhub CLI, as stored in the config file at path (or DefaultCLIConfigPath() if
+path is empty).
+
+The stored access token is used until it expires, at which point it is refreshed
+with the stored refresh token through the UAA server returned by UAAEndpoint.
+Access tokens whose expiry can't be read, because they aren't JWTs, are
+refreshed after a minute.
+If writeBack is true, refreshed tokens are written back to the config file, so
+that the CLI will pick them up as well.
+
+*/
+func NewFromCLIConfig(path string, writeBack bool) (*Client, error) {
+	if path == "" {
+		path = DefaultCLIConfigPath()
+	}
+
+	cfg, err := ReadCLIConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.APIURL == "" {
+		return nil, errors.New("credhub CLI config does not have an API URL, please log in with the credhub CLI")
+	}
+
+	if cfg.AccessToken == "" && cfg.RefreshToken == "" {
+		return nil, errors.New("credhub CLI config does not have any tokens, please log in with the credhub CLI")
+	}
+
+	server := strings.TrimSuffix(cfg.APIURL, "/")
+
+	tr, err := newTransport(cfg.CACerts, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	baseClient := &http.Client{Transport: tr}
+
+	endpoint, err := uaaEndpoint(baseClient, server)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthConfig := &oauth2.Config{
+		ClientID: cliClientID,
+		Endpoint: endpoint,
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  cfg.AccessToken,
+		RefreshToken: cfg.RefreshToken,
+		TokenType:    "bearer",
+		Expiry:       tokenExpiry(cfg.AccessToken),
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, baseClient)
+
+	var ts oauth2.TokenSource = oauthConfig.TokenSource(ctx, token)
+	if writeBack {
+		ts = &cliTokenSource{
+			path:  path,
+			src:   ts,
+			saved: cfg.AccessToken,
+		}
+	}
+
+	return New(server, NewTokenAuthClient(baseClient, ts))
+}
+
+// cliTokenSource writes any new tokens from src back to the credhub CLI config
+type cliTokenSource struct {
+	path  string
+	src   oauth2.TokenSource
+	saved string
+	mu    sync.Mutex
+}
+
+func (s *cliTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token.AccessToken != s.saved {
+		if err = s.save(token); err != nil {
+			return nil, err
+		}
+		s.saved = token.AccessToken
+	}
+
+	return token, nil
+}
+
+// save only updates the token fields, so that anything else the CLI has stored
+// in its config is left alone. The config is replaced atomically, so that the
+// CLI never reads a partly written file.
+func (s *cliTokenSource) save(token *oauth2.Token) error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	buf, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	cfg := make(map[string]interface{})
+	if err = json.Unmarshal(buf, &cfg); err != nil {
+		return err
+	}
+
+	cfg["AccessToken"] = token.AccessToken
+	if token.RefreshToken != "" {
+		cfg["RefreshToken"] = token.RefreshToken
+	}
+
+	if buf, err = json.Marshal(cfg); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = tmp.Chmod(info.Mode()); err == nil {
+		_, err = tmp.Write(buf)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,182 @@
+package credhub_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	. "github.com/onsi/gomega"
+)
+
+// unsignedToken creates a JWT with the given claims, which is good enough for
+// the client to inspect, but would never be accepted by a real server
+func unsignedToken(claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload, _ := json.Marshal(claims)
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestCLIConfig(t *testing.T) {
+	spec.Run(t, "CLIConfig", testCLIConfig, spec.Report(report.Terminal{}))
+}
+
+func testCLIConfig(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server     *httptest.Server
+		dir        string
+		configPath string
+		config     map[string]interface{}
+	)
+
+	writeConfig := func() {
+		buf, err := json.Marshal(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(configPath, buf, 0600)).To(Succeed())
+	}
+
+	readConfig := func() map[string]interface{} {
+		buf, err := ioutil.ReadFile(configPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		cfg := make(map[string]interface{})
+		Expect(json.Unmarshal(buf, &cfg)).To(Succeed())
+		return cfg
+	}
+
+	it.Before(func() {
+		var err error
+		RegisterTestingT(t)
+		server = mockCredhubServer()
+
+		dir, err = ioutil.TempDir("", "credhub-cli")
+		Expect(err).NotTo(HaveOccurred())
+		configPath = filepath.Join(dir, "config.json")
+
+		config = map[string]interface{}{
+			"ApiURL":             server.URL,
+			"AuthURL":            "https://uaa.example.com",
+			"AccessToken":        "abcd",
+			"RefreshToken":       "refresh-me",
+			"InsecureSkipVerify": false,
+			"CaCerts": []string{string(pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: server.Certificate().Raw,
+			}))},
+			"ServerVersion": "1.9.1",
+		}
+	})
+
+	it.After(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	when("reading the config", func() {
+		it("reads the CLI fields", func() {
+			writeConfig()
+
+			cfg, err := credhub.ReadCLIConfig(configPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.APIURL).To(Equal(server.URL))
+			Expect(cfg.AccessToken).To(Equal("abcd"))
+			Expect(cfg.RefreshToken).To(Equal("refresh-me"))
+			Expect(cfg.CACerts).To(HaveLen(1))
+		})
+
+		it("defaults to the CLI's config path", func() {
+			home := os.Getenv("HOME")
+			defer os.Setenv("HOME", home)
+			os.Setenv("HOME", dir)
+
+			Expect(credhub.DefaultCLIConfigPath()).To(Equal(filepath.Join(dir, ".credhub", "config.json")))
+		})
+
+		it("fails when the file does not exist", func() {
+			_, err := credhub.NewFromCLIConfig(filepath.Join(dir, "missing.json"), false)
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails when the user has not logged in", func() {
+			delete(config, "AccessToken")
+			delete(config, "RefreshToken")
+			writeConfig()
+
+			_, err := credhub.NewFromCLIConfig(configPath, false)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("the access token is still valid", func() {
+		it("uses it", func() {
+			writeConfig()
+
+			chClient, err := credhub.NewFromCLIConfig(configPath, true)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = chClient.GetLatestByName("/concourse/common/sample-password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readConfig()["AccessToken"]).To(Equal("abcd"))
+		})
+	})
+
+	when("the access token has expired", func() {
+		var expired string
+
+		it.Before(func() {
+			expired = unsignedToken(map[string]interface{}{
+				"exp": time.Now().Add(-time.Hour).Unix(),
+			})
+			config["AccessToken"] = expired
+			config["SomethingElse"] = "preserved"
+			writeConfig()
+		})
+
+		it("refreshes it and writes it back", func() {
+			chClient, err := credhub.NewFromCLIConfig(configPath, true)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = chClient.GetLatestByName("/concourse/common/sample-password")
+			Expect(err).NotTo(HaveOccurred())
+
+			cfg := readConfig()
+			Expect(cfg["AccessToken"]).To(Equal("abcd"))
+			Expect(cfg["RefreshToken"]).To(Equal("refreshed"))
+			Expect(cfg["SomethingElse"]).To(Equal("preserved"))
+
+			files, err := ioutil.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			Expect(files[0].Name()).To(Equal("config.json"))
+			Expect(files[0].Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		it("leaves the config alone when not writing back", func() {
+			chClient, err := credhub.NewFromCLIConfig(configPath, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = chClient.GetLatestByName("/concourse/common/sample-password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readConfig()["AccessToken"]).To(Equal(expired))
+		})
+
+		it("fails when the refresh token is invalid", func() {
+			config["RefreshToken"] = "bad"
+			writeConfig()
+
+			_, err := credhub.NewFromCLIConfig(configPath, true)
+			Expect(err).To(HaveOccurred())
+			Expect(fmt.Sprint(readConfig()["AccessToken"])).To(Equal(expired))
+		})
+	})
+}
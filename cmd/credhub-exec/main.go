@@ -0,0 +1,214 @@
+/*
+Command credhub-exec runs a program with credentials from Credhub in its
+environment, for apps that don't use this library themselves.
+
+Usage:
+
+	credhub-exec [-prefix PATH] [-e NAME=CREDENTIAL[.FIELD]]... -- COMMAND [ARGS...]
+
+If VCAP_SERVICES contains credhub-refs, they are resolved with
+InterpolateCredentials. Each -e sets an environment variable to the value of a
+credential, or of a field of it (e.g. -e DB_PASSWORD=db.password). Names that
+don't start with "/" are relative to -prefix. Values that aren't strings are
+passed as JSON.
+
+Signals are forwarded to the program, and credhub-exec exits with its exit
+code.
+
+Credhub is configured with the same environment variables as the credhub CLI;
+see credhub.NewFromEnvironment. Inside a Cloud Foundry container, CREDHUB_API,
+CF_INSTANCE_CERT and CF_INSTANCE_KEY are already set, so the app authenticates
+with its instance identity through NewCFAppAuthClient.
+
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/interpolate"
+)
+
+type envVar struct {
+	name string
+	ref  string
+}
+
+type envFlags []envVar
+
+func (e *envFlags) String() string {
+	names := make([]string, 0, len(*e))
+	for _, v := range *e {
+		names = append(names, v.name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (e *envFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected NAME=CREDENTIAL, got %q", s)
+	}
+
+	if !interpolate.IsVariable(parts[1]) {
+		return fmt.Errorf("invalid credential %q in %q", parts[1], s)
+	}
+
+	*e = append(*e, envVar{name: parts[0], ref: parts[1]})
+	return nil
+}
+
+func main() {
+	var vars envFlags
+
+	prefix := flag.String("prefix", "", "path that relative credential names are under")
+	flag.Var(&vars, "e", "NAME=CREDENTIAL[.FIELD] to set in the environment (repeatable)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-prefix PATH] [-e NAME=CREDENTIAL[.FIELD]]... -- COMMAND [ARGS...]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	env := os.Environ()
+	if len(vars) > 0 || strings.Contains(os.Getenv("VCAP_SERVICES"), "credhub-ref") {
+		client, err := credhub.NewFromEnvironment()
+		if err != nil {
+			fatal(err)
+		}
+
+		if env, err = environment(client, env, vars, *prefix); err != nil {
+			fatal(err)
+		}
+	}
+
+	code, err := run(flag.Args(), env)
+	if err != nil {
+		fatal(err)
+	}
+
+	os.Exit(code)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "credhub-exec:", err)
+	os.Exit(1)
+}
+
+// environment returns environ with VCAP_SERVICES interpolated and vars set
+func environment(client credhub.API, environ []string, vars []envVar, prefix string) ([]string, error) {
+	values := make(map[string]string)
+
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "VCAP_SERVICES=") && strings.Contains(kv, "credhub-ref") {
+			vcap, err := client.InterpolateCredentials(strings.TrimPrefix(kv, "VCAP_SERVICES="))
+			if err != nil {
+				return nil, fmt.Errorf("unable to interpolate VCAP_SERVICES: %v", err)
+			}
+			values["VCAP_SERVICES"] = vcap
+		}
+	}
+
+	if len(vars) > 0 {
+		placeholders := make(map[string]interface{}, len(vars))
+		for _, v := range vars {
+			placeholders[v.name] = "((" + v.ref + "))"
+		}
+
+		resolved, err := interpolate.New(client, prefix).Value(placeholders)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, value := range resolved.(map[string]interface{}) {
+			if s, ok := value.(string); ok {
+				values[name] = s
+				continue
+			}
+
+			buf, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			values[name] = string(buf)
+		}
+	}
+
+	env := make([]string, 0, len(environ)+len(values))
+	for _, kv := range environ {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if _, ok := values[name]; !ok {
+			env = append(env, kv)
+		}
+	}
+
+	for name, value := range values {
+		env = append(env, name+"="+value)
+	}
+
+	return env, nil
+}
+
+// run runs a command with the given environment, forwarding signals to it, and
+// returns its exit code
+func run(args []string, env []string) (int, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+
+	if err := cmd.Start(); err != nil {
+		signal.Stop(signals)
+		return 0, err
+	}
+
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	err := cmd.Wait()
+
+	// no signals are delivered after Stop returns, so closing the channel
+	// ends the forwarding goroutine
+	signal.Stop(signals)
+	close(signals)
+	<-forwarded
+
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return 0, err
+	}
+
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+		if status.Signaled() {
+			// follow the shell convention for processes killed by signals
+			return 128 + int(status.Signal()), nil
+		}
+		return status.ExitStatus(), nil
+	}
+
+	if cmd.ProcessState.Success() {
+		return 0, nil
+	}
+	return 1, nil
+}
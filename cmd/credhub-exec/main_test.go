@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	"github.com/cloudfoundry-community/go-credhub/interpolate"
+	. "github.com/onsi/gomega"
+)
+
+func TestEnvironment(t *testing.T) {
+	spec.Run(t, "Environment", testEnvironment, spec.Report(report.Terminal{}))
+}
+
+func testEnvironment(t *testing.T, when spec.G, it spec.S) {
+	var fake *credhubtest.FakeClient
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		fake = credhubtest.NewFakeClient(credhubtest.Version2)
+		fake.Seed(
+			credhub.Credential{Name: "/app/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "secret"}},
+			credhub.Credential{Name: "/app/token", Type: credhub.Value, Value: "token"},
+		)
+	})
+
+	it("sets variables from credentials and their fields", func() {
+		env, err := environment(fake, []string{"HOME=/home/vcap", "TOKEN=old"}, []envVar{
+			{name: "TOKEN", ref: "token"},
+			{name: "DB_PASSWORD", ref: "db.password"},
+			{name: "DB", ref: "/app/db"},
+		}, "/app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(ConsistOf(
+			"HOME=/home/vcap",
+			"TOKEN=token",
+			"DB_PASSWORD=secret",
+			`DB={"password":"secret","username":"me"}`,
+		))
+	})
+
+	it("interpolates VCAP_SERVICES", func() {
+		vcap := `{"db":[{"credentials":{"credhub-ref":"/app/db"}}]}`
+
+		env, err := environment(fake, []string{"VCAP_SERVICES=" + vcap}, nil, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(HaveLen(1))
+		Expect(env[0]).To(HavePrefix("VCAP_SERVICES="))
+		Expect(env[0][len("VCAP_SERVICES="):]).To(MatchJSON(`{"db":[{"credentials":{"username":"me","password":"secret"}}]}`))
+	})
+
+	it("reports missing credentials", func() {
+		_, err := environment(fake, nil, []envVar{{name: "MISSING", ref: "missing"}}, "/app")
+		Expect(err).To(BeAssignableToTypeOf(&interpolate.MissingVariablesError{}))
+	})
+
+	it("rejects malformed -e flags", func() {
+		var vars envFlags
+		Expect(vars.Set("NAME=db.password")).To(Succeed())
+		Expect(vars.Set("NAME")).To(HaveOccurred())
+		Expect(vars.Set("=db")).To(HaveOccurred())
+		Expect(vars.Set("NAME=db password")).To(HaveOccurred())
+		Expect(vars.Set("NAME= db")).To(HaveOccurred())
+		Expect(vars.Set("NAME=db)")).To(HaveOccurred())
+		Expect(vars.Set("NAME=((db))")).To(HaveOccurred())
+		Expect(vars).To(Equal(envFlags{{name: "NAME", ref: "db.password"}}))
+	})
+}
@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// forwardedSignals are the signals that are passed on to the child process
+var forwardedSignals = []os.Signal{
+	os.Interrupt,
+}
@@ -0,0 +1,123 @@
+/*
+Command credhub-extract moves literal secrets out of a YAML file and into
+Credhub, replacing them with ((name)) placeholders.
+
+Usage:
+
+	credhub-extract -prefix /concourse/main -key /properties/db/password [-key /path=name ...] [-dry-run] [-o output.yml] file.yml
+
+Each -key is a BOSH ops file path to a secret, optionally followed by =name to
+choose the name of its credential. The file is rewritten in place unless -o is
+given ("-o -" writes to stdout). With -dry-run, the planned changes and the
+rewritten file are printed, and nothing is changed.
+
+Credhub is configured with the same environment variables as the credhub CLI;
+see credhub.NewFromEnvironment.
+
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/extract"
+)
+
+type keyFlags []extract.Key
+
+func (k *keyFlags) String() string {
+	paths := make([]string, 0, len(*k))
+	for _, key := range *k {
+		paths = append(paths, key.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func (k *keyFlags) Set(s string) error {
+	key, err := extract.ParseKey(s)
+	if err != nil {
+		return err
+	}
+
+	*k = append(*k, key)
+	return nil
+}
+
+func main() {
+	var keys keyFlags
+
+	prefix := flag.String("prefix", "", "path to store the credentials under (required)")
+	dryRun := flag.Bool("dry-run", false, "print the planned changes without making them")
+	output := flag.String("o", "", "file to write the result to, or - for stdout (default: the input file)")
+	flag.Var(&keys, "key", "ops file path of a secret, optionally followed by =name (repeatable)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -prefix PATH -key PATH[=NAME]... [-dry-run] [-o FILE] FILE\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *prefix == "" || len(keys) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), keys, *prefix, *output, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, "credhub-extract:", err)
+		os.Exit(1)
+	}
+}
+
+func run(file string, keys []extract.Key, prefix, output string, dryRun bool) error {
+	doc, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	plan, err := extract.NewPlan(doc, keys, prefix)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Println("Planned changes:")
+		for _, change := range plan.Changes {
+			fmt.Println("  " + change.String())
+		}
+		fmt.Printf("\nResulting %s:\n%s", file, plan.Document)
+		return nil
+	}
+
+	client, err := credhub.NewFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	if err = plan.Apply(client); err != nil {
+		return err
+	}
+
+	for _, change := range plan.Changes {
+		fmt.Fprintln(os.Stderr, "stored", change.String())
+	}
+
+	switch output {
+	case "-":
+		_, err = os.Stdout.Write(plan.Document)
+		return err
+	case "":
+		output = file
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(output, plan.Document, info.Mode().Perm())
+}
@@ -0,0 +1,137 @@
+/*
+Command credhub-sync compares the credentials under a path on two Credhub
+servers, printing a diff that doesn't reveal their values, and optionally
+copies them from the source to the target.
+
+Usage:
+
+	credhub-sync -source CONFIG -target CONFIG -path PATH [-include GLOB]... [-exclude GLOB]... [-mode MODE] [-permissions] [-apply]
+
+-source and -target are credhub CLI config files (as written by "credhub
+login"), one of which may be "env" to configure that server with the same
+environment variables as the credhub CLI; see credhub.NewFromEnvironment.
+
+Without -apply, only the diff is printed. With it, credentials are copied as
+decided by -mode: overwrite sets every credential, no-overwrite only adds those
+missing from the target, and converge (the default) sets those that differ.
+Credentials that are only on the target are never deleted.
+
+The exit code is 0 if nothing differs (or everything was synced), 3 if there
+are differences (without -apply), and 1 on errors.
+
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credsync"
+)
+
+type globFlags []string
+
+func (g *globFlags) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globFlags) Set(s string) error {
+	*g = append(*g, s)
+	return nil
+}
+
+func main() {
+	var opts credsync.Options
+
+	source := flag.String("source", "", `credhub CLI config file of the source, or "env" (required)`)
+	target := flag.String("target", "", `credhub CLI config file of the target, or "env" (required)`)
+	prefix := flag.String("path", "", "path to compare (required)")
+	mode := flag.String("mode", string(credhub.Converge), "overwrite, no-overwrite or converge")
+	all := flag.Bool("all", false, "print unchanged credentials as well")
+	apply := flag.Bool("apply", false, "copy the credentials to the target")
+	flag.Var((*globFlags)(&opts.Include), "include", "pattern of the credentials to compare (repeatable)")
+	flag.Var((*globFlags)(&opts.Exclude), "exclude", "pattern of credentials to leave out (repeatable)")
+	flag.BoolVar(&opts.Permissions, "permissions", false, "compare permissions as well (1.x servers only)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -source CONFIG -target CONFIG -path PATH [-include GLOB]... [-exclude GLOB]... [-mode MODE] [-permissions] [-apply]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 || *source == "" || *target == "" || *prefix == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.Mode = credhub.OverwriteMode(*mode)
+
+	code, err := run(*source, *target, *prefix, opts, *all, *apply)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "credhub-sync:", err)
+		os.Exit(1)
+	}
+
+	os.Exit(code)
+}
+
+func run(sourceConfig, targetConfig, prefix string, opts credsync.Options, all, apply bool) (int, error) {
+	source, err := newClient(sourceConfig)
+	if err != nil {
+		return 0, fmt.Errorf("source: %v", err)
+	}
+
+	target, err := newClient(targetConfig)
+	if err != nil {
+		return 0, fmt.Errorf("target: %v", err)
+	}
+
+	if !apply {
+		diffs, err := credsync.Diff(source, target, prefix, opts)
+		if err != nil {
+			return 0, err
+		}
+
+		code := 0
+		for _, diff := range diffs {
+			if diff.Kind != credsync.Unchanged {
+				code = 3
+			}
+			if all || diff.Kind != credsync.Unchanged {
+				fmt.Println(diff)
+			}
+		}
+
+		return code, nil
+	}
+
+	results, err := credsync.Sync(source, target, prefix, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	code := 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			code = 1
+			fmt.Printf("%s\n    error: %v\n", result.Difference, result.Err)
+		case result.Set || result.PermissionsAdded > 0:
+			fmt.Printf("%s\n    synced\n", result.Difference)
+		case all || result.Kind != credsync.Unchanged:
+			fmt.Println(result.Difference)
+		}
+	}
+
+	return code, nil
+}
+
+func newClient(config string) (credhub.API, error) {
+	if config == "env" {
+		return credhub.NewFromEnvironment()
+	}
+
+	return credhub.NewFromCLIConfig(config, true)
+}
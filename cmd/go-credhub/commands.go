@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// flagSet creates the flag set of a command, with the -o flag that every
+// command has
+func (c *cli) flagSet(name, usage string) (*flag.FlagSet, *printer) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+
+	p := &printer{w: c.stdout}
+	fs.StringVar(&p.format, "o", "table", "output format: "+strings.Join(formats, ", "))
+
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: go-credhub %s %s\n\n", name, usage)
+		fs.PrintDefaults()
+	}
+
+	return fs, p
+}
+
+// parse parses the flags of a command, which takes no arguments
+func (c *cli) parse(fs *flag.FlagSet, p *printer, args []string) error {
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return err
+	} else if err != nil {
+		return errUsage
+	}
+
+	if fs.NArg() > 0 {
+		return c.invalid(fs, "unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	for _, format := range formats {
+		if p.format == format {
+			return nil
+		}
+	}
+
+	return c.invalid(fs, "unknown output format %q", p.format)
+}
+
+// invalid prints why a command's flags are invalid, followed by its usage
+func (c *cli) invalid(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(c.stderr, "go-credhub %s: %s\n\n", fs.Name(), fmt.Sprintf(format, args...))
+	fs.Usage()
+	return errUsage
+}
+
+func get(c *cli, args []string) error {
+	fs, p := c.flagSet("get", "-n NAME [-versions N | -all] [-k FIELD] | -i ID [-k FIELD]")
+	name := fs.String("n", "", "name of the credential")
+	id := fs.String("i", "", "ID of the credential version")
+	versions := fs.Int("versions", 0, "number of versions to get, newest first")
+	all := fs.Bool("all", false, "get every version, newest first")
+	key := fs.String("k", "", "only print this field of the value")
+
+	if err := c.parse(fs, p, args); err != nil {
+		return err
+	}
+
+	switch {
+	case (*name == "") == (*id == ""):
+		return c.invalid(fs, "one of -n or -i is required")
+	case *id != "" && (*versions != 0 || *all):
+		return c.invalid(fs, "-versions and -all can only be used with -n")
+	case *versions < 0:
+		return c.invalid(fs, "-versions must be positive")
+	case *versions > 0 && *all:
+		return c.invalid(fs, "only one of -versions and -all can be used")
+	case *key != "" && (*versions > 0 || *all):
+		return c.invalid(fs, "-k can not be used with -versions or -all")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	if *versions > 0 || *all {
+		var creds []credhub.Credential
+		if *all {
+			creds, err = client.GetAllByName(*name)
+		} else {
+			creds, err = client.GetVersionsByName(*name, *versions)
+		}
+		if err != nil {
+			return err
+		}
+
+		return p.credentials(creds)
+	}
+
+	var cred *credhub.Credential
+	if *id != "" {
+		cred, err = client.GetByID(*id)
+	} else {
+		cred, err = client.GetLatestByName(*name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *key == "" {
+		return p.credential(cred)
+	}
+
+	obj, _ := cred.Value.(map[string]interface{})
+	value, ok := obj[*key]
+	if !ok {
+		return fmt.Errorf("%s has no field %q", cred.Name, *key)
+	}
+
+	return p.value(value)
+}
+
+func set(c *cli, args []string) error {
+	fs, p := c.flagSet("set", "-n NAME -t TYPE -v VALUE [-mode MODE]")
+	name := fs.String("n", "", "name of the credential")
+	credType := fs.String("t", "", "type of the credential: value, password, json, user, certificate, rsa or ssh")
+	value := fs.String("v", "", `value of the credential, as JSON for types other than value and password, or "-" to read it from stdin`)
+	mode := fs.String("mode", string(credhub.Overwrite), "overwrite, no-overwrite or converge (ignored by v2 servers)")
+
+	if err := c.parse(fs, p, args); err != nil {
+		return err
+	}
+
+	switch {
+	case *name == "":
+		return c.invalid(fs, "-n is required")
+	case *credType == "":
+		return c.invalid(fs, "-t is required")
+	}
+
+	raw := *value
+	if raw == "-" {
+		buf, err := ioutil.ReadAll(c.stdin)
+		if err != nil {
+			return err
+		}
+		raw = strings.TrimSuffix(string(buf), "\n")
+	}
+
+	cred := credhub.Credential{Name: *name, Type: credhub.CredentialType(*credType)}
+	switch cred.Type {
+	case credhub.Value, credhub.Password:
+		cred.Value = raw
+	default:
+		if err := json.Unmarshal([]byte(raw), &cred.Value); err != nil {
+			return fmt.Errorf("the value of %s credentials must be JSON: %v", cred.Type, err)
+		}
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	stored, err := client.Set(cred, credhub.OverwriteMode(*mode), nil)
+	if err != nil {
+		return err
+	}
+
+	return p.credential(stored)
+}
+
+// paramFlags collects key=value generation parameters
+type paramFlags map[string]interface{}
+
+func (f paramFlags) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// Set adds a parameter. Values that are valid JSON, like numbers and booleans,
+// are decoded; anything else is a string.
+func (f paramFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", s)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(parts[1]), &value); err != nil {
+		value = parts[1]
+	}
+
+	f[parts[0]] = value
+	return nil
+}
+
+func generate(c *cli, args []string) error {
+	fs, p := c.flagSet("generate", "-n NAME [-t TYPE] [-p KEY=VALUE]...")
+	name := fs.String("n", "", "name of the credential")
+	credType := fs.String("t", string(credhub.Password), "type of the credential: password, user, certificate, rsa or ssh")
+	params := make(paramFlags)
+	fs.Var(params, "p", "generation parameter, e.g. length=30 or common_name=example.com (repeatable)")
+
+	if err := c.parse(fs, p, args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return c.invalid(fs, "-n is required")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	cred, err := client.Generate(*name, credhub.CredentialType(*credType), params)
+	if err != nil {
+		return err
+	}
+
+	return p.credential(cred)
+}
+
+func regenerate(c *cli, args []string) error {
+	fs, p := c.flagSet("regenerate", "-n NAME")
+	name := fs.String("n", "", "name of the credential")
+
+	if err := c.parse(fs, p, args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return c.invalid(fs, "-n is required")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	cred, err := client.Regenerate(*name)
+	if err != nil {
+		return err
+	}
+
+	return p.credential(cred)
+}
+
+func deleteCredential(c *cli, args []string) error {
+	fs, p := c.flagSet("delete", "-n NAME")
+	name := fs.String("n", "", "name of the credential")
+
+	if err := c.parse(fs, p, args); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return c.invalid(fs, "-n is required")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	return client.Delete(*name)
+}
+
+func find(c *cli, args []string) error {
+	fs, p := c.flagSet("find", "-path PATH | -n PARTIAL_NAME | -paths")
+	path := fs.String("path", "", "find the credentials directly under a path")
+	partialName := fs.String("n", "", "find the credentials whose names contain this")
+	paths := fs.Bool("paths", false, "list every path that has credentials")
+
+	if err := c.parse(fs, p, args); err != nil {
+		return err
+	}
+
+	count := 0
+	for _, given := range []bool{*path != "", *partialName != "", *paths} {
+		if given {
+			count++
+		}
+	}
+	if count != 1 {
+		return c.invalid(fs, "exactly one of -path, -n and -paths is required")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	if *paths {
+		all, err := client.ListAllPaths()
+		if err != nil {
+			return err
+		}
+
+		return p.print(all, func(w *tabwriter.Writer) {
+			for _, path := range all {
+				fmt.Fprintln(w, path)
+			}
+		})
+	}
+
+	var creds []credhub.Credential
+	if *path != "" {
+		creds, err = client.FindByPath(*path)
+	} else {
+		creds, err = client.FindByPartialName(*partialName)
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.print(creds, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tVERSION_CREATED_AT")
+		for _, cred := range creds {
+			fmt.Fprintf(w, "%s\t%s\n", cred.Name, cred.Created)
+		}
+	})
+}
+
+func permissions(c *cli, args []string) error {
+	fs, p := c.flagSet("permissions", "-n NAME [-add ACTOR -op OPERATIONS | -delete ACTOR]")
+	name := fs.String("n", "", "name of the credential")
+	add := fs.String("add", "", "actor to grant operations to")
+	ops := fs.String("op", "", "comma separated operations to grant: read, write, delete, read_acl, write_acl")
+	del := fs.String("delete", "", "actor to revoke every operation from")
+
+	if err := c.parse(fs, p, args); err != nil {
+		return err
+	}
+
+	switch {
+	case *name == "":
+		return c.invalid(fs, "-n is required")
+	case *add != "" && *del != "":
+		return c.invalid(fs, "only one of -add and -delete can be used")
+	case (*add != "") != (*ops != ""):
+		return c.invalid(fs, "-add and -op must be used together")
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	if *del != "" {
+		return client.DeletePermissions(*name, *del)
+	}
+
+	var perms []credhub.Permission
+	if *add != "" {
+		perm := credhub.Permission{Actor: *add}
+		for _, op := range strings.Split(*ops, ",") {
+			perm.Operations = append(perm.Operations, credhub.Operation(strings.TrimSpace(op)))
+		}
+
+		perms, err = client.AddPermissions(*name, []credhub.Permission{perm})
+	} else {
+		perms, err = client.GetPermissions(*name)
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.print(perms, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ACTOR\tOPERATIONS")
+		for _, perm := range perms {
+			ops := make([]string, 0, len(perm.Operations))
+			for _, op := range perm.Operations {
+				ops = append(ops, string(op))
+			}
+			fmt.Fprintf(w, "%s\t%s\n", perm.Actor, strings.Join(ops, ", "))
+		}
+	})
+}
@@ -0,0 +1,144 @@
+/*
+Command go-credhub is a command line client for Credhub, built on this library,
+for scripts that need to manage credentials without writing Go.
+
+Usage:
+
+	go-credhub COMMAND [FLAGS] [-o table|json|yaml]
+
+Commands:
+
+	get          get a credential by name (optionally a number of versions) or ID
+	set          set the value of a credential
+	generate     generate a credential
+	regenerate   regenerate a credential with the parameters it was generated with
+	delete       delete a credential
+	find         find credentials by path or partial name, or list every path
+	permissions  list, add or delete the permissions of a credential
+
+Run "go-credhub COMMAND -h" for the flags of each command.
+
+If CREDHUB_SERVER (or CREDHUB_API) is set, Credhub is configured with the same
+environment variables as the credhub CLI, authenticating as a UAA client or, in
+a Cloud Foundry container, with the instance identity; see
+credhub.NewFromEnvironment. Otherwise the login session of the credhub CLI is
+reused; see credhub.NewFromCLIConfig.
+
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// errUsage is returned by commands that were given invalid flags, after their
+// usage has been printed
+var errUsage = errors.New("invalid usage")
+
+// cli is what a command needs to run
+type cli struct {
+	// client returns the client to use. It is only called once the command's
+	// flags are known to be valid.
+	client func() (credhub.API, error)
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"get":         {"get a credential by name (optionally a number of versions) or ID", get},
+	"set":         {"set the value of a credential", set},
+	"generate":    {"generate a credential", generate},
+	"regenerate":  {"regenerate a credential with the parameters it was generated with", regenerate},
+	"delete":      {"delete a credential", deleteCredential},
+	"find":        {"find credentials by path or partial name, or list every path", find},
+	"permissions": {"list, add or delete the permissions of a credential", permissions},
+}
+
+func main() {
+	c := &cli{
+		client: newClient,
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+
+	os.Exit(c.main(os.Args[1:]))
+}
+
+// main runs the command named by args[0], returning the exit code
+func (c *cli) main(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		c.usage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "go-credhub: unknown command %q\n\n", args[0])
+		c.usage()
+		return 2
+	}
+
+	switch err := cmd.run(c, args[1:]); err {
+	case nil:
+		return 0
+	case flag.ErrHelp:
+		return 0
+	case errUsage:
+		return 2
+	default:
+		fmt.Fprintln(c.stderr, "go-credhub:", err)
+		return 1
+	}
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "Usage: go-credhub COMMAND [FLAGS]")
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(c.stderr, "  %-12s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, `Run "go-credhub COMMAND -h" for the flags of each command.`)
+}
+
+// newClient creates a client from the environment if a server is configured
+// there, or from the credhub CLI's login session otherwise
+func newClient() (credhub.API, error) {
+	if os.Getenv("CREDHUB_SERVER") != "" || os.Getenv("CREDHUB_API") != "" {
+		return credhub.NewFromEnvironment()
+	}
+
+	client, err := credhub.NewFromCLIConfig("", true)
+	if err != nil {
+		return nil, fmt.Errorf("set CREDHUB_SERVER, or log in with the credhub CLI: %v", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestCLI(t *testing.T) {
+	spec.Run(t, "CLI", testCLI, spec.Report(report.Terminal{}))
+}
+
+func testCLI(t *testing.T, when spec.G, it spec.S) {
+	var (
+		fake           *credhubtest.FakeClient
+		c              *cli
+		stdout, stderr *bytes.Buffer
+		clientCreated  bool
+	)
+
+	run := func(args ...string) int {
+		stdout.Reset()
+		stderr.Reset()
+		return c.main(args)
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		fake = credhubtest.NewFakeClient(credhubtest.Version1)
+		fake.Seed(
+			credhub.Credential{Name: "/app/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "old"}},
+			credhub.Credential{Name: "/app/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "new"}},
+			credhub.Credential{Name: "/app/token", Type: credhub.Value, Value: "token"},
+		)
+
+		stdout = new(bytes.Buffer)
+		stderr = new(bytes.Buffer)
+		clientCreated = false
+		c = &cli{
+			client: func() (credhub.API, error) {
+				clientCreated = true
+				return fake, nil
+			},
+			stdin:  strings.NewReader("from stdin\n"),
+			stdout: stdout,
+			stderr: stderr,
+		}
+	})
+
+	when("getting credentials", func() {
+		it("prints the latest version as a table", func() {
+			Expect(run("get", "-n", "/app/db")).To(Equal(0))
+			Expect(stdout.String()).To(MatchRegexp(`(?m)^name:\s+/app/db$`))
+			Expect(stdout.String()).To(MatchRegexp(`(?m)^type:\s+user$`))
+			Expect(stdout.String()).To(MatchRegexp(`(?m)^  password:\s+new$`))
+		})
+
+		it("prints JSON and YAML", func() {
+			Expect(run("get", "-n", "/app/token", "-o", "json")).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring(`"value": "token"`))
+
+			Expect(run("get", "-n", "/app/db", "-o", "yaml")).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring("name: /app/db\n"))
+			Expect(stdout.String()).To(ContainSubstring("  password: new\n"))
+		})
+
+		it("prints a single field as it is", func() {
+			Expect(run("get", "-n", "/app/db", "-k", "password")).To(Equal(0))
+			Expect(stdout.String()).To(Equal("new\n"))
+
+			Expect(run("get", "-n", "/app/db", "-k", "missing")).To(Equal(1))
+			Expect(stderr.String()).To(ContainSubstring(`has no field "missing"`))
+		})
+
+		it("gets versions and credentials by ID", func() {
+			Expect(run("get", "-n", "/app/db", "-all", "-o", "json")).To(Equal(0))
+			Expect(strings.Count(stdout.String(), `"name": "/app/db"`)).To(Equal(2))
+
+			Expect(run("get", "-n", "/app/db", "-versions", "1", "-o", "json")).To(Equal(0))
+			Expect(strings.Count(stdout.String(), `"name": "/app/db"`)).To(Equal(1))
+
+			cred, err := fake.GetLatestByName("/app/token")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(run("get", "-i", cred.ID, "-k", "missing")).To(Equal(1))
+			Expect(run("get", "-i", cred.ID)).To(Equal(0))
+			Expect(stdout.String()).To(MatchRegexp(`(?m)^value:\s+token$`))
+		})
+
+		it("reports errors", func() {
+			Expect(run("get", "-n", "/app/missing")).To(Equal(1))
+			Expect(stderr.String()).To(Equal("go-credhub: Name Not Found\n"))
+		})
+	})
+
+	when("changing credentials", func() {
+		it("sets values and JSON", func() {
+			Expect(run("set", "-n", "/app/token", "-t", "value", "-v", "new-token")).To(Equal(0))
+			Expect(run("set", "-n", "/app/config", "-t", "json", "-v", `{"a": [1, 2]}`)).To(Equal(0))
+			Expect(run("set", "-n", "/app/stdin", "-t", "password", "-v", "-")).To(Equal(0))
+
+			token, _ := fake.GetLatestByName("/app/token")
+			Expect(token.Value).To(Equal("new-token"))
+			config, _ := fake.GetLatestByName("/app/config")
+			Expect(config.Value).To(Equal(map[string]interface{}{"a": []interface{}{1.0, 2.0}}))
+			stdin, _ := fake.GetLatestByName("/app/stdin")
+			Expect(stdin.Value).To(Equal("from stdin"))
+
+			Expect(run("set", "-n", "/app/config", "-t", "json", "-v", "not json")).To(Equal(1))
+		})
+
+		it("generates with parameters", func() {
+			Expect(run("generate", "-n", "/app/generated", "-p", "length=12", "-p", "exclude_upper=true", "-o", "json")).To(Equal(0))
+			cred, err := fake.GetLatestByName("/app/generated")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Type).To(Equal(credhub.Password))
+			Expect(stdout.String()).To(ContainSubstring(`"name": "/app/generated"`))
+
+			Expect(run("regenerate", "-n", "/app/generated")).To(Equal(0))
+			versions, _ := fake.GetAllByName("/app/generated")
+			Expect(versions).To(HaveLen(2))
+		})
+
+		it("deletes", func() {
+			Expect(run("delete", "-n", "/app/token")).To(Equal(0))
+			Expect(stdout.String()).To(BeEmpty())
+			_, err := fake.GetLatestByName("/app/token")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	it("finds credentials and paths", func() {
+		Expect(run("find", "-path", "/app")).To(Equal(0))
+		Expect(stdout.String()).To(HavePrefix("NAME"))
+		Expect(stdout.String()).To(ContainSubstring("/app/db"))
+		Expect(stdout.String()).To(ContainSubstring("/app/token"))
+
+		Expect(run("find", "-n", "tok", "-o", "json")).To(Equal(0))
+		Expect(stdout.String()).To(ContainSubstring(`"name": "/app/token"`))
+		Expect(stdout.String()).NotTo(ContainSubstring("/app/db"))
+
+		Expect(run("find", "-paths")).To(Equal(0))
+		Expect(stdout.String()).To(ContainSubstring("/app/"))
+	})
+
+	it("manages permissions", func() {
+		Expect(run("permissions", "-n", "/app/db", "-add", "uaa-user:someone", "-op", "read,write")).To(Equal(0))
+		Expect(stdout.String()).To(MatchRegexp(`uaa-user:someone\s+read, write`))
+
+		Expect(run("permissions", "-n", "/app/db", "-delete", "uaa-user:someone")).To(Equal(0))
+		Expect(run("permissions", "-n", "/app/db", "-o", "json")).To(Equal(0))
+		Expect(stdout.String()).NotTo(ContainSubstring("uaa-user:someone"))
+	})
+
+	when("the server refuses writes", func() {
+		var server *credhubtest.Server
+
+		it.Before(func() {
+			server = credhubtest.NewServer(credhubtest.Version1)
+			server.Seed(credhub.Credential{Name: "/app/token", Type: credhub.Value, Value: "token"})
+			server.InjectFault(http.MethodPut, "/api/v1/data", credhubtest.Fault{Status: http.StatusForbidden})
+			server.InjectFault(http.MethodPost, "/api/v1/", credhubtest.Fault{Status: http.StatusForbidden})
+
+			c.client = func() (credhub.API, error) {
+				return server.NewClient()
+			}
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		it("exits with an error", func() {
+			Expect(run("set", "-n", "/app/token", "-t", "value", "-v", "new-token")).To(Equal(1))
+			Expect(stdout.String()).To(BeEmpty())
+			Expect(stderr.String()).To(HavePrefix("go-credhub: expected a 2xx response, got 403 Forbidden"))
+
+			Expect(run("generate", "-n", "/app/generated")).To(Equal(1))
+			Expect(stdout.String()).To(BeEmpty())
+
+			Expect(run("regenerate", "-n", "/app/token")).To(Equal(1))
+			Expect(stdout.String()).To(BeEmpty())
+
+			Expect(run("permissions", "-n", "/app/token", "-add", "uaa-user:someone", "-op", "read")).To(Equal(1))
+			Expect(stdout.String()).To(BeEmpty())
+		})
+	})
+
+	when("the flags are invalid", func() {
+		it("prints the usage without creating a client", func() {
+			Expect(run("get")).To(Equal(2))
+			Expect(stderr.String()).To(ContainSubstring("one of -n or -i is required"))
+			Expect(stderr.String()).To(ContainSubstring("Usage: go-credhub get"))
+
+			Expect(run("get", "-n", "/app/db", "-o", "xml")).To(Equal(2))
+			Expect(run("find", "-path", "/app", "-paths")).To(Equal(2))
+			Expect(run("permissions", "-n", "/app/db", "-add", "someone")).To(Equal(2))
+			Expect(run("generate", "-n", "/app/x", "-p", "nokey")).To(Equal(2))
+			Expect(run("bogus")).To(Equal(2))
+			Expect(run()).To(Equal(2))
+			Expect(clientCreated).To(BeFalse())
+		})
+
+		it("prints help", func() {
+			Expect(run("help")).To(Equal(0))
+			Expect(stderr.String()).To(ContainSubstring("permissions  list, add or delete"))
+
+			Expect(run("set", "-h")).To(Equal(0))
+			Expect(stderr.String()).To(ContainSubstring("-mode"))
+		})
+	})
+}
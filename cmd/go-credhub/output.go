@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// formats are the values of the -o flag
+var formats = []string{"table", "json", "yaml"}
+
+// printer writes results in the format chosen with -o
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// print writes v as JSON or YAML, or calls table to write it as a table
+func (p *printer) print(v interface{}, table func(w *tabwriter.Writer)) error {
+	switch p.format {
+	case "json":
+		buf, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "%s\n", buf)
+		return err
+	case "yaml":
+		// go through JSON, so that the json field names of the library's
+		// types are used
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		var generic interface{}
+		if err = json.Unmarshal(buf, &generic); err != nil {
+			return err
+		}
+
+		buf, err = yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(buf)
+		return err
+	default:
+		w := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+}
+
+// credential writes a credential
+func (p *printer) credential(cred *credhub.Credential) error {
+	return p.print(cred, func(w *tabwriter.Writer) {
+		credentialTable(w, cred)
+	})
+}
+
+// credentials writes a list of credentials, e.g. the versions of one
+func (p *printer) credentials(creds []credhub.Credential) error {
+	return p.print(creds, func(w *tabwriter.Writer) {
+		for i := range creds {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			credentialTable(w, &creds[i])
+		}
+	})
+}
+
+// value writes a single value, such as a field of a credential. Strings are
+// written as they are in tables, so that they can be used in scripts.
+func (p *printer) value(v interface{}) error {
+	return p.print(v, func(w *tabwriter.Writer) {
+		if s, ok := v.(string); ok {
+			fmt.Fprintln(w, s)
+			return
+		}
+
+		buf, _ := json.Marshal(v)
+		fmt.Fprintf(w, "%s\n", buf)
+	})
+}
+
+func credentialTable(w io.Writer, cred *credhub.Credential) {
+	fmt.Fprintf(w, "id:\t%s\n", cred.ID)
+	fmt.Fprintf(w, "name:\t%s\n", cred.Name)
+	fmt.Fprintf(w, "type:\t%s\n", cred.Type)
+
+	switch value := cred.Value.(type) {
+	case map[string]interface{}:
+		fmt.Fprintln(w, "value:\t")
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %s:\t%s\n", key, tableValue(value[key]))
+		}
+	default:
+		fmt.Fprintf(w, "value:\t%s\n", tableValue(value))
+	}
+
+	fmt.Fprintf(w, "version_created_at:\t%s\n", cred.Created)
+}
+
+// tableValue formats a value for a table cell. Multi-line strings, like PEM
+// certificates, are indented to line up with the cell.
+func tableValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.Replace(strings.TrimSpace(t), "\n", "\n\t", -1)
+	default:
+		buf, _ := json.Marshal(t)
+		return string(buf)
+	}
+}
@@ -57,6 +57,7 @@ func mockCredhubServer() *httptest.Server {
 	router.Handle("/api/v1/permissions", authHandler(deleteV1Permissions)).Methods(http.MethodDelete)
 
 	router.PathPrefix("/badjson").Handler(authHandler(badJSON))
+	router.PathPrefix("/forbidden").Handler(authHandler(forbidden))
 	router.Handle("/version", authHandler(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, `{"version": "1.9.1"}`)
 	}))
@@ -80,6 +81,7 @@ func mockV2CredhubServer() *httptest.Server {
 	router.Handle("/api/v1/data", authHandler(postCredentials)).Methods(http.MethodPost)
 	router.Handle("/api/v1/data/regenerate", authHandler(regenerateCredentials)).Methods(http.MethodPost)
 	router.Handle("/api/v2/permissions", authHandler(postV1Permissions)).Methods(http.MethodPost)
+	router.Handle("/api/v1/interpolate", authHandler(interpolateCredentials)).Methods(http.MethodPost)
 
 	router.Handle("/api/v1/data", authHandler(putCredentials(false))).Methods(http.MethodPut)
 
@@ -87,6 +89,7 @@ func mockV2CredhubServer() *httptest.Server {
 	router.Handle("/api/v2/permissions", authHandler(deleteV1Permissions)).Methods(http.MethodDelete)
 
 	router.PathPrefix("/badjson").Handler(authHandler(badJSON))
+	router.PathPrefix("/forbidden").Handler(authHandler(forbidden))
 	router.Handle("/version", authHandler(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, `{"version": "2.0.0"}`)
 	}))
@@ -387,6 +390,50 @@ func putCredentials(v1 bool) func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func interpolateCredentials(w http.ResponseWriter, r *http.Request) {
+	services := make(map[string][]map[string]interface{})
+	if err := json.NewDecoder(r.Body).Decode(&services); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for serviceType := range services {
+		for i := range services[serviceType] {
+			credRef, ok := services[serviceType][i]["credentials"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			name, ok := credRef["credhub-ref"].(string)
+			if !ok {
+				continue
+			}
+
+			buf, err := ioutil.ReadFile(path.Join("testdata/credentials/byname", name+".json"))
+			if os.IsNotExist(err) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			} else if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			var body struct {
+				Data []credhub.Credential `json:"data"`
+			}
+			if err = json.Unmarshal(buf, &body); err != nil || len(body.Data) == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			services[serviceType][i]["credentials"] = body.Data[0].Value
+		}
+	}
+
+	out, _ := json.Marshal(services)
+	w.Write(out)
+}
+
 func deleteCredentials(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Query().Get("name")
 	if name == "/some-cred" {
@@ -478,6 +525,17 @@ func badJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{invalid}`))
 }
 
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	// exception here for version, so that the client can be created
+	if strings.HasSuffix(r.URL.Path, "/version") {
+		fmt.Fprint(w, `{"version": "1.9.1"}`)
+		return
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprint(w, `{"error": "The request could not be completed because the credential does not exist or you do not have sufficient authorization."}`)
+}
+
 func returnPermissionsFromFile(credentialName string) ([]credhub.Permission, error) {
 	filePath := path.Join("testdata/permissions/v1", credentialName+".json")
 	buf, err := ioutil.ReadFile(filePath)
@@ -0,0 +1,455 @@
+package credhubtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// DefaultSecretKeys are the JSON, form and query keys whose values a Recorder
+// scrubs. Everything below a matching JSON key is scrubbed, except for
+// credhub-ref names.
+var DefaultSecretKeys = []string{
+	"value",
+	"password",
+	"password_hash",
+	"private_key",
+	"credentials",
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"client_secret",
+}
+
+// placeholderRegexp matches the placeholders that replace secrets
+var placeholderRegexp = regexp.MustCompile(`^REDACTED-[0-9]+$`)
+
+// secretHeaders are the headers whose values a Recorder scrubs
+var secretHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// Cassette is the file format written by a Recorder and read by a Replayer
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a scrubbed HTTP request. URL is stored without its scheme
+// and host, so that a cassette can be replayed against any server URL, and with
+// the values of secret query parameters scrubbed.
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is a scrubbed HTTP response
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+/*
+
+NewRecorder creates a Recorder that sends requests through hc, and records
+them and their responses to a cassette file at path when Save is called.
+
+Secrets are replaced with deterministic placeholders of the form REDACTED-n,
+where the same secret always maps to the same placeholder within a cassette.
+This keeps the relationships between requests intact (e.g. a value that is
+set and then read back) without storing the secret itself. To scrub the
+Authorization header, the Recorder must sit below whatever adds it:
+
+	recorder := credhubtest.NewRecorder(http.DefaultClient, "testdata/cassette.json")
+	client, err := credhub.New(url, credhub.NewTokenAuthClient(recorder, tokenSource))
+	...
+	err = recorder.Save()
+
+*/
+func NewRecorder(hc credhub.HTTPClient, path string) *Recorder {
+	return &Recorder{
+		SecretKeys:   DefaultSecretKeys,
+		hc:           hc,
+		path:         path,
+		placeholders: make(map[string]string),
+	}
+}
+
+// Recorder is a credhub.HTTPClient that records the requests sent through it
+type Recorder struct {
+	// SecretKeys are the keys whose values are scrubbed. It defaults to
+	// DefaultSecretKeys.
+	SecretKeys []string
+
+	hc   credhub.HTTPClient
+	path string
+
+	mu           sync.Mutex
+	cassette     Cassette
+	placeholders map[string]string
+}
+
+// Get will do an HTTP Request to the specified URL using the HTTP GET method
+func (r *Recorder) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.Do(req)
+}
+
+// Do will perform the HTTP Request specified with the underlying HTTPClient,
+// and record it and its response
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     r.scrubURL(req.URL),
+			Headers: r.scrubHeaders(req.Header),
+			Body:    r.scrubBody(req.Header.Get("Content-Type"), reqBody),
+		},
+		Response: RecordedResponse{
+			Status:  resp.StatusCode,
+			Headers: r.scrubHeaders(resp.Header),
+			Body:    r.scrubBody(resp.Header.Get("Content-Type"), respBody),
+		},
+	})
+
+	return resp, nil
+}
+
+// Save writes the interactions recorded so far to the cassette file
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, data, 0600)
+}
+
+// placeholder returns the placeholder for a secret. r.mu must be held.
+func (r *Recorder) placeholder(secret string) string {
+	if p, ok := r.placeholders[secret]; ok {
+		return p
+	}
+
+	p := fmt.Sprintf("REDACTED-%d", len(r.placeholders)+1)
+	r.placeholders[secret] = p
+	return p
+}
+
+func (r *Recorder) isSecretKey(key string) bool {
+	for _, k := range r.SecretKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recorder) scrubHeaders(headers http.Header) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	scrubbed := make(http.Header, len(headers))
+	for name, values := range headers {
+		scrubbed[name] = append([]string(nil), values...)
+	}
+
+	for _, name := range secretHeaders {
+		values := scrubbed[http.CanonicalHeaderKey(name)]
+		for i, value := range values {
+			// keep the auth scheme, so that the cassette is still readable
+			if fields := strings.SplitN(value, " ", 2); len(fields) == 2 && !strings.Contains(fields[0], "=") {
+				values[i] = fields[0] + " " + r.placeholder(fields[1])
+			} else {
+				values[i] = r.placeholder(value)
+			}
+		}
+	}
+
+	return scrubbed
+}
+
+func (r *Recorder) scrubURL(u *url.URL) string {
+	uri := u.RequestURI()
+	if u.RawQuery == "" {
+		return uri
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return uri
+	}
+
+	r.scrubValues(query)
+	return strings.SplitN(uri, "?", 2)[0] + "?" + query.Encode()
+}
+
+// scrubValues replaces the values of secret keys in a form or query with their
+// placeholders
+func (r *Recorder) scrubValues(values url.Values) {
+	for _, key := range sortedKeys(values) {
+		if r.isSecretKey(key) {
+			for i := range values[key] {
+				values[key][i] = r.placeholder(values[key][i])
+			}
+		}
+	}
+}
+
+func (r *Recorder) scrubBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			r.scrubValues(form)
+			return form.Encode()
+		}
+	}
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		// not JSON, so there is nothing we know how to scrub
+		return string(body)
+	}
+
+	scrubbed, _ := json.Marshal(r.scrubJSON(v, false))
+	return string(scrubbed)
+}
+
+// scrubJSON replaces every string and number below a secret key with its
+// placeholder
+func (r *Recorder) scrubJSON(v interface{}, secret bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		// visit keys in order, so that placeholders are numbered the same way
+		// every time
+		for _, key := range sortedKeys(t) {
+			if key == "credhub-ref" {
+				continue
+			}
+			t[key] = r.scrubJSON(t[key], secret || r.isSecretKey(key))
+		}
+		return t
+	case []interface{}:
+		for i := range t {
+			t[i] = r.scrubJSON(t[i], secret)
+		}
+		return t
+	case string:
+		if secret {
+			return r.placeholder(t)
+		}
+	case json.Number:
+		if secret {
+			return r.placeholder(t.String())
+		}
+	}
+
+	return v
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch t := m.(type) {
+	case map[string]interface{}:
+		for key := range t {
+			keys = append(keys, key)
+		}
+	case url.Values:
+		for key := range t {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewReplayer creates a Replayer that serves the interactions in the cassette
+// file at path
+func NewReplayer(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cassette Cassette
+	if err := json.NewDecoder(f).Decode(&cassette); err != nil {
+		return nil, err
+	}
+
+	return &Replayer{
+		interactions: cassette.Interactions,
+		used:         make([]bool, len(cassette.Interactions)),
+	}, nil
+}
+
+// Replayer is a credhub.HTTPClient that answers requests from a cassette
+// recorded by a Recorder, without contacting any server. Each request is
+// answered by the first unused interaction with the same method and URL
+// (ignoring scheme and host), so repeated requests are answered in the order
+// they were recorded.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// Get will replay the response to a GET request for the specified URL
+func (p *Replayer) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.Do(req)
+}
+
+// Do will replay the response to the specified request
+func (p *Replayer) Do(req *http.Request) (*http.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	uri := req.URL.RequestURI()
+	for i, interaction := range p.interactions {
+		if p.used[i] || interaction.Request.Method != req.Method || !matchURI(interaction.Request.URL, uri) {
+			continue
+		}
+		p.used[i] = true
+
+		resp := interaction.Response
+		header := make(http.Header, len(resp.Headers))
+		for name, values := range resp.Headers {
+			header[name] = append([]string(nil), values...)
+		}
+		// the body may have changed length when it was scrubbed
+		header.Del("Content-Length")
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", resp.Status, http.StatusText(resp.Status)),
+			StatusCode:    resp.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(resp.Body)),
+			ContentLength: int64(len(resp.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no recorded interaction for %s %s", req.Method, uri)
+}
+
+// matchURI returns true if a request URI is the recorded one. Query
+// parameters may be in any order, and scrubbed values match any value.
+func matchURI(recorded, uri string) bool {
+	if recorded == uri {
+		return true
+	}
+
+	rec, err := url.Parse(recorded)
+	if err != nil {
+		return false
+	}
+
+	req, err := url.Parse(uri)
+	if err != nil || rec.Path != req.Path {
+		return false
+	}
+
+	recQuery, err := url.ParseQuery(rec.RawQuery)
+	if err != nil {
+		return false
+	}
+
+	reqQuery, err := url.ParseQuery(req.RawQuery)
+	if err != nil || len(recQuery) != len(reqQuery) {
+		return false
+	}
+
+	for key, values := range recQuery {
+		if len(values) != len(reqQuery[key]) {
+			return false
+		}
+
+		for i, value := range values {
+			if value != reqQuery[key][i] && !placeholderRegexp.MatchString(value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Remaining returns the number of recorded interactions that have not been
+// replayed yet
+func (p *Replayer) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	remaining := 0
+	for _, used := range p.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,151 @@
+package credhubtest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestCassette(t *testing.T) {
+	spec.Run(t, "Cassette", testCassette, spec.Report(report.Terminal{}))
+}
+
+func testCassette(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server   *credhubtest.Server
+		dir      string
+		cassette string
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		server = credhubtest.NewServer(credhubtest.Version1)
+		server.Seed(credhub.Credential{
+			Name:  "/concourse/main/db",
+			Type:  credhub.User,
+			Value: map[string]interface{}{"username": "admin", "password": "hunter2"},
+		})
+
+		var err error
+		dir, err = ioutil.TempDir("", "cassette")
+		Expect(err).NotTo(HaveOccurred())
+		cassette = filepath.Join(dir, "cassette.json")
+	})
+
+	it.After(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	record := func() {
+		recorder := credhubtest.NewRecorder(server.Client(), cassette)
+		chClient, err := credhub.New(server.URL, credhub.NewTokenAuthClient(recorder, server.TokenSource(credhubtest.DefaultClient, credhubtest.DefaultClientSecret)))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = chClient.Set(credhub.Credential{Name: "/concourse/main/token", Type: credhub.Value, Value: "s3cr3t"}, credhub.Overwrite, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = chClient.GetLatestByName("/concourse/main/token")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = chClient.GetLatestByName("/concourse/main/db")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = chClient.Generate("/concourse/main/key", credhub.RSA, map[string]interface{}{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(recorder.Save()).To(Succeed())
+	}
+
+	it("scrubs secrets from the cassette", func() {
+		record()
+
+		data, err := ioutil.ReadFile(cassette)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("s3cr3t"))
+		Expect(string(data)).NotTo(ContainSubstring("hunter2"))
+		Expect(string(data)).NotTo(ContainSubstring("admin"))
+		Expect(string(data)).NotTo(ContainSubstring("PRIVATE KEY"))
+		Expect(string(data)).To(ContainSubstring(`bearer REDACTED-1`))
+		Expect(string(data)).To(ContainSubstring("/concourse/main/token"))
+	})
+
+	it("replays the recorded responses", func() {
+		record()
+
+		replayer, err := credhubtest.NewReplayer(cassette)
+		Expect(err).NotTo(HaveOccurred())
+
+		chClient, err := credhub.New("https://credhub.example.com:8844", replayer)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chClient.IsV1API()).To(BeTrue())
+
+		set, err := chClient.Set(credhub.Credential{Name: "/concourse/main/token", Type: credhub.Value, Value: "anything"}, credhub.Overwrite, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		token, err := chClient.GetLatestByName("/concourse/main/token")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.ID).To(Equal(set.ID))
+		Expect(token.Value).To(MatchRegexp("^REDACTED-[0-9]+$"))
+		Expect(token.Value).To(Equal(set.Value))
+
+		db, err := chClient.GetLatestByName("/concourse/main/db")
+		Expect(err).NotTo(HaveOccurred())
+		user, err := credhub.UserValue(*db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.Password).To(MatchRegexp("^REDACTED-[0-9]+$"))
+
+		_, err = chClient.Generate("/concourse/main/key", credhub.RSA, map[string]interface{}{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replayer.Remaining()).To(BeZero())
+
+		_, err = chClient.GetLatestByName("/concourse/main/token")
+		Expect(err).To(MatchError(ContainSubstring("no recorded interaction for GET /api/v1/data?")))
+	})
+
+	it("scrubs secrets from query parameters", func() {
+		recorder := credhubtest.NewRecorder(server.Client(), cassette)
+		recorder.SecretKeys = append(recorder.SecretKeys, "name")
+
+		chClient, err := credhub.New(server.URL, credhub.NewTokenAuthClient(recorder, server.TokenSource(credhubtest.DefaultClient, credhubtest.DefaultClientSecret)))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = chClient.GetLatestByName("/concourse/main/db")
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := recorder.Get(server.URL + "/info?access_token=s3cr3t")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(recorder.Save()).To(Succeed())
+
+		data, err := ioutil.ReadFile(cassette)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("s3cr3t"))
+		Expect(string(data)).NotTo(ContainSubstring("concourse"))
+		Expect(string(data)).To(ContainSubstring("access_token=REDACTED-"))
+
+		replayer, err := credhubtest.NewReplayer(cassette)
+		Expect(err).NotTo(HaveOccurred())
+
+		chClient, err = credhub.New("https://credhub.example.com:8844", replayer)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = chClient.GetLatestByName("/concourse/main/db")
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err = replayer.Get("https://credhub.example.com:8844/info?access_token=other")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(replayer.Remaining()).To(BeZero())
+	})
+
+}
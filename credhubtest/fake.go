@@ -0,0 +1,255 @@
+package credhubtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// FakeClient is an in-memory implementation of credhub.API. It behaves like a
+// credhub.Client talking to a Server, without needing any network stack.
+type FakeClient struct {
+	// Actor is the actor returned by WhoAmI. It defaults to the actor of
+	// DefaultClient.
+	Actor string
+
+	version string
+	store   *store
+}
+
+var _ credhub.API = (*FakeClient)(nil)
+
+// errNameNotFound is what credhub.Client returns when no credential has a name
+var errNameNotFound = credhub.NewNotFoundError("Name Not Found")
+
+// NewFakeClient creates an empty FakeClient that emulates a server reporting
+// the given version. See NewServer for the differences between versions.
+func NewFakeClient(version string) *FakeClient {
+	return &FakeClient{
+		Actor:   "uaa-client:" + DefaultClient,
+		version: version,
+		store:   newStore(),
+	}
+}
+
+// Seed adds credentials to the fake. Each credential is added as a new
+// version, with an ID and creation date generated if they are empty.
+func (f *FakeClient) Seed(creds ...credhub.Credential) {
+	f.store.seed(creds...)
+}
+
+// SeedPermissions grants permissions on a credential, merging them with any
+// that the actors already have.
+func (f *FakeClient) SeedPermissions(credentialName string, perms ...credhub.Permission) {
+	f.store.seedPermissions(credentialName, perms...)
+}
+
+// copyCredential returns a copy of a stored credential, so that callers can
+// not modify the store through its value
+func copyCredential(cred credhub.Credential) *credhub.Credential {
+	cred.Value = normalizeJSON(cred.Value)
+	return &cred
+}
+
+func copyCredentials(creds []credhub.Credential) []credhub.Credential {
+	ret := make([]credhub.Credential, 0, len(creds))
+	for _, cred := range creds {
+		ret = append(ret, *copyCredential(cred))
+	}
+	return ret
+}
+
+// statusError returns the same error as Client does for methods that check
+// for a particular status code
+func statusError(err error, expected int) error {
+	if apiErr, ok := err.(*Error); ok {
+		return fmt.Errorf("expected return code %d, got %d", expected, apiErr.Status)
+	}
+	return err
+}
+
+// IsV1API returns true if the fake emulates a 1.x server
+func (f *FakeClient) IsV1API() bool {
+	return isV1(f.version)
+}
+
+// WhoAmI returns Actor
+func (f *FakeClient) WhoAmI() (string, error) {
+	if f.Actor == "" {
+		return "", errors.New("unable to determine the actor for this client's HTTPClient")
+	}
+	return f.Actor, nil
+}
+
+// GetByID will look up a credential by its ID
+func (f *FakeClient) GetByID(id string) (*credhub.Credential, error) {
+	cred, err := f.store.getByID(id)
+	if err != nil {
+		return nil, credhub.ErrNotFound
+	}
+
+	return copyCredential(cred), nil
+}
+
+func (f *FakeClient) getByName(name string, numVersions int) ([]credhub.Credential, error) {
+	creds, err := f.store.getByName(name, numVersions)
+	if err != nil {
+		return nil, errNameNotFound
+	}
+
+	return copyCredentials(creds), nil
+}
+
+// GetAllByName will return all versions of a credential, newest first
+func (f *FakeClient) GetAllByName(name string) ([]credhub.Credential, error) {
+	return f.getByName(name, 0)
+}
+
+// GetVersionsByName will return the latest numVersions versions of a credential, newest first
+func (f *FakeClient) GetVersionsByName(name string, numVersions int) ([]credhub.Credential, error) {
+	return f.getByName(name, numVersions)
+}
+
+// GetLatestByName will return the current version of a credential
+func (f *FakeClient) GetLatestByName(name string) (*credhub.Credential, error) {
+	creds, err := f.getByName(name, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &creds[0], nil
+}
+
+// Set adds a credential. As with a real server, mode and additionalPermissions
+// are only honoured when emulating a 1.x server.
+func (f *FakeClient) Set(credential credhub.Credential, mode credhub.OverwriteMode, additionalPermissions []credhub.Permission) (*credhub.Credential, error) {
+	if f.IsV1API() {
+		if mode == "" {
+			mode = credhub.Converge
+		}
+	} else {
+		mode = credhub.Overwrite
+		additionalPermissions = nil
+	}
+
+	cred, err := f.store.set(credential, mode, additionalPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyCredential(cred), nil
+}
+
+// Generate will create a credential, unless one already exists that was
+// generated with the same parameters
+func (f *FakeClient) Generate(name string, credentialType credhub.CredentialType, parameters map[string]interface{}) (*credhub.Credential, error) {
+	cred, err := f.store.generate(name, credentialType, parameters, credhub.Converge)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyCredential(cred), nil
+}
+
+// Regenerate will generate a new value for a credential using the same
+// parameters as the stored value
+func (f *FakeClient) Regenerate(name string) (*credhub.Credential, error) {
+	cred, err := f.store.regenerate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyCredential(cred), nil
+}
+
+// Delete deletes a credential by name
+func (f *FakeClient) Delete(name string) error {
+	return statusError(f.store.delete(name), http.StatusNoContent)
+}
+
+// ListAllPaths lists all paths that have credentials
+func (f *FakeClient) ListAllPaths() ([]string, error) {
+	return f.store.paths(), nil
+}
+
+// FindByPath retrieves a list of stored credential names which are within the
+// specified path
+func (f *FakeClient) FindByPath(path string) ([]credhub.Credential, error) {
+	return f.store.findByPath(path), nil
+}
+
+// FindByPartialName retrieves a list of stored credential names which contain
+// the search
+func (f *FakeClient) FindByPartialName(partialName string) ([]credhub.Credential, error) {
+	return f.store.findByPartialName(partialName), nil
+}
+
+// GetPermissions returns the permissions of a credential
+func (f *FakeClient) GetPermissions(credentialName string) ([]credhub.Permission, error) {
+	perms, err := f.store.permissionsFor(credentialName)
+	if err != nil {
+		return nil, credhub.ErrNotFound
+	}
+
+	return perms, nil
+}
+
+// AddPermissions adds permissions to a credential
+func (f *FakeClient) AddPermissions(credentialName string, newPerms []credhub.Permission) ([]credhub.Permission, error) {
+	return f.store.addPermissionsV1(credentialName, newPerms)
+}
+
+// DeletePermissions deletes an actor's permissions from a credential
+func (f *FakeClient) DeletePermissions(credentialName, actorID string) error {
+	return statusError(f.store.deletePermissionV1(credentialName, actorID), http.StatusNoContent)
+}
+
+// InterpolateCredentials interpolates any services in a VCAP_SERVICES JSON
+// string whose credentials block consists only of credhub-ref. As with Client,
+// every ref that can not be resolved is reported in a
+// *credhub.InterpolationError.
+func (f *FakeClient) InterpolateCredentials(vcapServices string) (string, error) {
+	services := make(map[string][]map[string]interface{})
+	if err := json.Unmarshal([]byte(vcapServices), &services); err != nil {
+		return "", err
+	}
+
+	refErrs := make(map[string]error)
+	for serviceType := range services {
+		for _, service := range services[serviceType] {
+			credRef, ok := service["credentials"].(map[string]interface{})
+			if !ok || len(credRef) != 1 {
+				continue
+			}
+
+			ref, ok := credRef["credhub-ref"]
+			if !ok {
+				continue
+			}
+
+			name, ok := ref.(string)
+			if !ok {
+				refErrs[fmt.Sprintf("%v", ref)] = errors.New("credhub-ref must be a string")
+				continue
+			}
+
+			cred, err := f.GetLatestByName(name)
+			if err != nil {
+				refErrs[name] = err
+				continue
+			}
+
+			service["credentials"] = cred.Value
+		}
+	}
+
+	if len(refErrs) > 0 {
+		return "", &credhub.InterpolationError{Errors: refErrs}
+	}
+
+	output, _ := json.Marshal(services)
+	return string(output), nil
+}
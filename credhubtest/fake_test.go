@@ -0,0 +1,179 @@
+package credhubtest_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestFakeClient(t *testing.T) {
+	spec.Run(t, "FakeClient", testFakeClient, spec.Report(report.Terminal{}))
+}
+
+func testFakeClient(t *testing.T, when spec.G, it spec.S) {
+	var fake *credhubtest.FakeClient
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		fake = credhubtest.NewFakeClient(credhubtest.Version1)
+		fake.Seed(
+			credhub.Credential{Name: "/app/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "old"}},
+			credhub.Credential{Name: "/app/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "new"}},
+			credhub.Credential{Name: "/app/nested/token", Type: credhub.Value, Value: "token"},
+		)
+	})
+
+	it("implements credhub.API", func() {
+		var api credhub.API = fake
+		Expect(api.IsV1API()).To(BeTrue())
+
+		actor, err := api.WhoAmI()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actor).To(Equal("uaa-client:" + credhubtest.DefaultClient))
+	})
+
+	when("getting credentials", func() {
+		it("returns versions newest first", func() {
+			creds, err := fake.GetAllByName("/app/db")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(2))
+
+			v, err := credhub.UserValue(creds[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v.Password).To(Equal("new"))
+
+			byID, err := fake.GetByID(creds[1].ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(byID.Created).To(Equal(creds[1].Created))
+		})
+
+		it("returns the same errors as the real client", func() {
+			_, err := fake.GetLatestByName("/missing")
+			Expect(err).To(MatchError("Name Not Found"))
+			Expect(errors.Is(err, credhub.ErrNotFound)).To(BeTrue())
+
+			_, err = fake.GetByID("missing")
+			Expect(err).To(Equal(credhub.ErrNotFound))
+
+			Expect(fake.Delete("/missing")).To(MatchError("expected return code 204, got 404"))
+		})
+
+		it("does not let callers modify stored values", func() {
+			cred, err := fake.GetLatestByName("/app/db")
+			Expect(err).NotTo(HaveOccurred())
+			cred.Value.(map[string]interface{})["password"] = "tampered"
+
+			cred, err = fake.GetLatestByName("/app/db")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Value.(map[string]interface{})["password"]).To(Equal("new"))
+		})
+	})
+
+	when("finding credentials", func() {
+		it("finds by path and partial name", func() {
+			creds, err := fake.FindByPath("/app")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(2))
+
+			creds, err = fake.FindByPartialName("TOK")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(1))
+
+			paths, err := fake.ListAllPaths()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(ConsistOf("/", "/app/", "/app/nested/"))
+		})
+	})
+
+	when("setting credentials", func() {
+		it("honours overwrite modes on v1", func() {
+			cred := credhub.Credential{Name: "/app/value", Type: credhub.Value, Value: "a"}
+			first, err := fake.Set(cred, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			same, err := fake.Set(cred, credhub.Converge, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(same.ID).To(Equal(first.ID))
+
+			cred.Value = "b"
+			kept, err := fake.Set(cred, credhub.NoOverwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kept.Value).To(Equal("a"))
+		})
+
+		it("always overwrites on v2", func() {
+			fake = credhubtest.NewFakeClient(credhubtest.Version2)
+			cred := credhub.Credential{Name: "/app/value", Type: credhub.Value, Value: "a"}
+
+			first, err := fake.Set(cred, credhub.NoOverwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			second, err := fake.Set(cred, credhub.NoOverwrite, []credhub.Permission{{Actor: "uaa-user:1", Operations: []credhub.Operation{credhub.Read}}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second.ID).NotTo(Equal(first.ID))
+
+			perms, err := fake.GetPermissions("/app/value")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(BeEmpty())
+		})
+
+		it("rejects invalid values", func() {
+			_, err := fake.Set(credhub.Credential{Name: "/app/json", Type: credhub.JSON, Value: "not an object"}, credhub.Overwrite, nil)
+			Expect(err).To(HaveOccurred())
+
+			_, err = fake.Set(credhub.Credential{Name: "/app/db", Type: credhub.Value, Value: "wrong type"}, credhub.Overwrite, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("generating credentials", func() {
+		it("generates and regenerates", func() {
+			cred, err := fake.Generate("/app/password", credhub.Password, map[string]interface{}{"length": 40})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Value).To(HaveLen(40))
+
+			regenerated, err := fake.Regenerate("/app/password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(regenerated.Value).To(HaveLen(40))
+			Expect(regenerated.Value).NotTo(Equal(cred.Value))
+
+			_, err = fake.Regenerate("/app/nested/token")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("managing permissions", func() {
+		it("adds and deletes them", func() {
+			perms, err := fake.AddPermissions("/app/db", []credhub.Permission{
+				{Actor: "mtls-app:1", Operations: []credhub.Operation{credhub.Read}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(HaveLen(1))
+
+			Expect(fake.DeletePermissions("/app/db", "mtls-app:1")).To(Succeed())
+			Expect(fake.DeletePermissions("/app/db", "mtls-app:1")).To(MatchError("expected return code 204, got 404"))
+
+			_, err = fake.GetPermissions("/missing")
+			Expect(err).To(MatchError("credential not found"))
+		})
+	})
+
+	when("interpolating VCAP_SERVICES", func() {
+		it("resolves credhub-refs", func() {
+			out, err := fake.InterpolateCredentials(`{"p-mysql":[{"name":"db","credentials":{"credhub-ref":"/app/db"}}]}`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchJSON(`{"p-mysql":[{"name":"db","credentials":{"username":"me","password":"new"}}]}`))
+
+			_, err = fake.InterpolateCredentials(`{"p-mysql":[{"name":"db","credentials":{"credhub-ref":"/missing"}},{"name":"bad","credentials":{"credhub-ref":1}}]}`)
+			Expect(err).To(BeAssignableToTypeOf(&credhub.InterpolationError{}))
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveKeyWithValue("/missing", MatchError("Name Not Found")))
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveKey("1"))
+		})
+	})
+}
@@ -0,0 +1,189 @@
+package credhubtest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault describes how the server should misbehave when answering a request.
+// Latency may be combined with any other field, but at most one of
+// ExpiredToken, ResetConnection, Status, MalformedJSON and TruncateBody should
+// be set.
+type Fault struct {
+	// Latency delays the response. The delay is cut short if the client gives
+	// up on the request.
+	Latency time.Duration
+
+	// ExpiredToken expires every token the fake UAA has issued before the
+	// request is handled, so that it fails with 401 invalid_token.
+	ExpiredToken bool
+
+	// ResetConnection closes the connection without sending a response.
+	ResetConnection bool
+
+	// Status answers the request with a Credhub error with this status code,
+	// e.g. 503 or 429.
+	Status int
+
+	// RetryAfter sets the Retry-After header, in whole seconds, on responses
+	// using Status.
+	RetryAfter time.Duration
+
+	// MalformedJSON answers the request with 200 OK and a body that is not
+	// valid JSON.
+	MalformedJSON bool
+
+	// TruncateBody handles the request normally, but only sends the first half
+	// of the response body.
+	TruncateBody bool
+
+	// Count is the number of requests the fault applies to, after which it is
+	// removed. Zero means it applies until ClearFaults is called.
+	Count int
+}
+
+type injectedFault struct {
+	method string
+	path   string
+	fault  Fault
+}
+
+func (f *injectedFault) matches(r *http.Request) bool {
+	if f.method != "" && f.method != r.Method {
+		return false
+	}
+
+	if strings.HasSuffix(f.path, "/") {
+		return strings.HasPrefix(r.URL.Path, f.path)
+	}
+
+	return f.path == "" || f.path == r.URL.Path
+}
+
+type faults struct {
+	mu       sync.Mutex
+	injected []*injectedFault
+}
+
+func (fs *faults) add(method, path string, fault Fault) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.injected = append(fs.injected, &injectedFault{method: method, path: path, fault: fault})
+}
+
+func (fs *faults) clear() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.injected = nil
+}
+
+// next returns the first fault that matches the request, using up one of its
+// requests
+func (fs *faults) next(r *http.Request) (Fault, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for i, f := range fs.injected {
+		if !f.matches(r) {
+			continue
+		}
+
+		if f.fault.Count > 0 {
+			f.fault.Count--
+			if f.fault.Count == 0 {
+				fs.injected = append(fs.injected[:i], fs.injected[i+1:]...)
+			}
+		}
+
+		return f.fault, true
+	}
+
+	return Fault{}, false
+}
+
+// InjectFault makes the server misbehave when answering requests with the
+// given method and path. An empty method matches any method, and an empty path
+// matches any path; a path ending in "/" matches any path it is a prefix of.
+// If several faults match a request, the one injected first is used.
+func (s *Server) InjectFault(method, path string, fault Fault) {
+	s.faults.add(method, path, fault)
+}
+
+// ClearFaults removes every fault injected with InjectFault
+func (s *Server) ClearFaults() {
+	s.faults.clear()
+}
+
+func (s *Server) injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fault, ok := s.faults.next(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fault.Latency > 0 {
+			timer := time.NewTimer(fault.Latency)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		switch {
+		case fault.ExpiredToken:
+			s.uaa.expireTokens()
+			next.ServeHTTP(w, r)
+		case fault.ResetConnection:
+			resetConnection(w)
+		case fault.Status != 0:
+			if fault.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter/time.Second)))
+			}
+			writeError(w, &Error{Status: fault.Status, Message: fmt.Sprintf("injected fault: %d %s", fault.Status, http.StatusText(fault.Status))})
+		case fault.MalformedJSON:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"data": [{"name": `))
+		case fault.TruncateBody:
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, r)
+
+			for name, values := range rec.Header() {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(rec.Code)
+
+			body := bytes.TrimSpace(rec.Body.Bytes())
+			w.Write(body[:len(body)/2])
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// resetConnection closes the underlying connection of a response without
+// writing anything to it
+func resetConnection(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("credhubtest: response writer does not support hijacking")
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(err)
+	}
+
+	conn.Close()
+}
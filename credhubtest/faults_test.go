@@ -0,0 +1,248 @@
+package credhubtest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestFaults(t *testing.T) {
+	spec.Run(t, "Faults", testFaults, spec.Report(report.Terminal{}))
+}
+
+type clientOperation struct {
+	name string
+
+	// hasBody is false for operations whose successful response has no body
+	hasBody bool
+
+	// checksStatus is true for operations that fail on unexpected status codes
+	checksStatus bool
+
+	call func(c *credhub.Client) error
+}
+
+// clientOperations returns every Client operation. They succeed in this order
+// against a server with a generated /faults/password.
+func clientOperations(id string) []clientOperation {
+	return []clientOperation{
+		{"GetByID", true, false, func(c *credhub.Client) error {
+			_, err := c.GetByID(id)
+			return err
+		}},
+		{"GetAllByName", true, true, func(c *credhub.Client) error {
+			_, err := c.GetAllByName("/faults/password")
+			return err
+		}},
+		{"GetVersionsByName", true, true, func(c *credhub.Client) error {
+			_, err := c.GetVersionsByName("/faults/password", 1)
+			return err
+		}},
+		{"GetLatestByName", true, true, func(c *credhub.Client) error {
+			_, err := c.GetLatestByName("/faults/password")
+			return err
+		}},
+		{"Set", true, false, func(c *credhub.Client) error {
+			_, err := c.Set(credhub.Credential{Name: "/faults/value", Type: credhub.Value, Value: "value"}, credhub.Overwrite, nil)
+			return err
+		}},
+		{"Generate", true, false, func(c *credhub.Client) error {
+			_, err := c.Generate("/faults/generated", credhub.Password, map[string]interface{}{})
+			return err
+		}},
+		{"Regenerate", true, false, func(c *credhub.Client) error {
+			_, err := c.Regenerate("/faults/password")
+			return err
+		}},
+		{"ListAllPaths", true, false, func(c *credhub.Client) error {
+			_, err := c.ListAllPaths()
+			return err
+		}},
+		{"FindByPath", true, false, func(c *credhub.Client) error {
+			_, err := c.FindByPath("/faults")
+			return err
+		}},
+		{"FindByPartialName", true, false, func(c *credhub.Client) error {
+			_, err := c.FindByPartialName("password")
+			return err
+		}},
+		{"GetPermissions", true, false, func(c *credhub.Client) error {
+			_, err := c.GetPermissions("/faults/password")
+			return err
+		}},
+		{"AddPermissions", true, false, func(c *credhub.Client) error {
+			_, err := c.AddPermissions("/faults/password", []credhub.Permission{{Actor: "mtls-app:1", Operations: []credhub.Operation{credhub.Read}}})
+			return err
+		}},
+		{"DeletePermissions", false, true, func(c *credhub.Client) error {
+			return c.DeletePermissions("/faults/password", "mtls-app:1")
+		}},
+		{"InterpolateCredentials", true, true, func(c *credhub.Client) error {
+			_, err := c.InterpolateCredentials(`{"p-mysql":[{"credentials":{"credhub-ref":"/faults/password"}}]}`)
+			return err
+		}},
+		{"Delete", false, true, func(c *credhub.Client) error {
+			return c.Delete("/faults/password")
+		}},
+	}
+}
+
+func testFaults(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server     *credhubtest.Server
+		chClient   *credhub.Client
+		operations []clientOperation
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		server = credhubtest.NewServer(credhubtest.Version1)
+
+		var err error
+		chClient, err = server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+
+		// also fetches a token, so that faults on /api/ don't affect it
+		cred, err := chClient.Generate("/faults/password", credhub.Password, map[string]interface{}{})
+		Expect(err).NotTo(HaveOccurred())
+
+		operations = clientOperations(cred.ID)
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	// this makes sure that the failures below are caused by the faults
+	it("runs every operation successfully without faults", func() {
+		for _, op := range operations {
+			Expect(op.call(chClient)).To(Succeed(), op.name)
+		}
+	})
+
+	it("fails every operation when the connection is reset", func() {
+		server.InjectFault("", "/api/", credhubtest.Fault{ResetConnection: true})
+
+		for _, op := range operations {
+			Expect(op.call(chClient)).NotTo(Succeed(), op.name)
+		}
+	})
+
+	it("fails every operation when the response is malformed JSON", func() {
+		server.InjectFault("", "/api/", credhubtest.Fault{MalformedJSON: true})
+
+		for _, op := range operations {
+			Expect(op.call(chClient)).NotTo(Succeed(), op.name)
+		}
+	})
+
+	it("fails every operation with a body when the response is truncated", func() {
+		server.InjectFault("", "/api/", credhubtest.Fault{TruncateBody: true})
+
+		for _, op := range operations {
+			if op.hasBody {
+				Expect(op.call(chClient)).NotTo(Succeed(), op.name)
+			}
+		}
+	})
+
+	it("times out every operation when the server is slow", func() {
+		hc := server.Client()
+		hc.Timeout = 50 * time.Millisecond
+		slowClient, err := credhub.New(server.URL, credhub.NewTokenAuthClient(hc, server.TokenSource(credhubtest.DefaultClient, credhubtest.DefaultClientSecret)))
+		Expect(err).NotTo(HaveOccurred())
+
+		server.InjectFault("", "/api/", credhubtest.Fault{Latency: time.Second})
+
+		for _, op := range operations {
+			start := time.Now()
+			Expect(op.call(slowClient)).NotTo(Succeed(), op.name)
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second), op.name)
+		}
+	})
+
+	it("delays responses without failing them", func() {
+		server.InjectFault(http.MethodGet, "/api/v1/data", credhubtest.Fault{Latency: 100 * time.Millisecond})
+
+		start := time.Now()
+		_, err := chClient.GetLatestByName("/faults/password")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	it("fails operations that check the status code on server errors", func() {
+		server.InjectFault("", "/api/", credhubtest.Fault{Status: http.StatusInternalServerError})
+
+		for _, op := range operations {
+			if op.checksStatus {
+				Expect(op.call(chClient)).NotTo(Succeed(), op.name)
+			}
+		}
+	})
+
+	it("only fails the number of requests given by Count", func() {
+		server.InjectFault(http.MethodGet, "/api/v1/data", credhubtest.Fault{Status: http.StatusServiceUnavailable, Count: 2})
+
+		_, err := chClient.GetLatestByName("/faults/password")
+		Expect(err).To(MatchError(ContainSubstring("503")))
+		_, err = chClient.GetLatestByName("/faults/password")
+		Expect(err).To(MatchError(ContainSubstring("503")))
+		_, err = chClient.GetLatestByName("/faults/password")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it("rate limits with Retry-After", func() {
+		server.InjectFault(http.MethodGet, "/api/v1/data", credhubtest.Fault{Status: http.StatusTooManyRequests, RetryAfter: 30 * time.Second})
+
+		hc := credhub.NewTokenAuthClient(server.Client(), server.TokenSource(credhubtest.DefaultClient, credhubtest.DefaultClientSecret))
+		resp, err := hc.Get(server.URL + "/api/v1/data?name=/faults/password")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Header.Get("Retry-After")).To(Equal("30"))
+	})
+
+	it("expires tokens", func() {
+		server.InjectFault("", "/api/", credhubtest.Fault{ExpiredToken: true, Count: 1})
+
+		_, err := chClient.GetLatestByName("/faults/password")
+		Expect(err).To(MatchError(ContainSubstring("401")))
+
+		// the fault is used up, but the client's token has still expired
+		_, err = chClient.GetLatestByName("/faults/password")
+		Expect(err).To(MatchError(ContainSubstring("401")))
+
+		freshClient, err := server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = freshClient.GetLatestByName("/faults/password")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it("only affects matching requests", func() {
+		server.InjectFault(http.MethodDelete, "/api/v1/data", credhubtest.Fault{ResetConnection: true})
+		server.InjectFault("", "/api/v1/permissions", credhubtest.Fault{ResetConnection: true})
+
+		_, err := chClient.GetLatestByName("/faults/password")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chClient.Delete("/faults/password")).NotTo(Succeed())
+		_, err = chClient.GetPermissions("/faults/password")
+		Expect(err).To(HaveOccurred())
+	})
+
+	it("removes faults with ClearFaults", func() {
+		server.InjectFault("", "", credhubtest.Fault{ResetConnection: true})
+		server.ClearFaults()
+
+		for _, op := range operations {
+			Expect(op.call(chClient)).To(Succeed(), op.name)
+		}
+	})
+}
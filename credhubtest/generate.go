@@ -0,0 +1,346 @@
+package credhubtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+const (
+	lowerChars   = "abcdefghijklmnopqrstuvwxyz"
+	upperChars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	numberChars  = "0123456789"
+	specialChars = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+)
+
+func stringParam(params map[string]interface{}, key, def string) string {
+	if v, ok := params[key].(string); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+func boolParam(params map[string]interface{}, key string) bool {
+	v, _ := params[key].(bool)
+	return v
+}
+
+func intParam(params map[string]interface{}, key string, def int) int {
+	if v, ok := params[key].(float64); ok && v > 0 {
+		return int(v)
+	}
+	return def
+}
+
+func stringsParam(params map[string]interface{}, key string) []string {
+	raw, _ := params[key].([]interface{})
+	ret := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// generateValue creates a new value for a credential. s.mu must be held, since
+// certificates may be signed by a CA stored in s.
+func (s *store) generateValue(credentialType credhub.CredentialType, params map[string]interface{}) (interface{}, error) {
+	switch credentialType {
+	case credhub.Password:
+		return generatePassword(params)
+	case credhub.User:
+		password, err := generatePassword(params)
+		if err != nil {
+			return nil, err
+		}
+
+		username := stringParam(params, "username", "")
+		if username == "" {
+			username = randomString(20, lowerChars)
+		}
+
+		return withPasswordHash(map[string]interface{}{
+			"username": username,
+			"password": password,
+		}), nil
+	case credhub.RSA:
+		key, err := rsa.GenerateKey(rand.Reader, intParam(params, "key_length", 2048))
+		if err != nil {
+			return nil, err
+		}
+
+		public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{
+			"public_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})),
+			"private_key": encodeRSAKey(key),
+		}, nil
+	case credhub.SSH:
+		return generateSSH(params)
+	case credhub.Certificate:
+		return s.generateCertificate(params)
+	default:
+		return nil, badRequest("Credentials of this type cannot be generated. Please adjust the credential type and retry your request.")
+	}
+}
+
+func randomString(length int, charset string) string {
+	max := big.NewInt(int64(len(charset)))
+	buf := make([]byte, length)
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		buf[i] = charset[n.Int64()]
+	}
+	return string(buf)
+}
+
+func generatePassword(params map[string]interface{}) (string, error) {
+	charset := ""
+	if !boolParam(params, "exclude_lower") {
+		charset += lowerChars
+	}
+	if !boolParam(params, "exclude_upper") {
+		charset += upperChars
+	}
+	if !boolParam(params, "exclude_number") {
+		charset += numberChars
+	}
+	if boolParam(params, "include_special") {
+		charset += specialChars
+	}
+
+	if charset == "" {
+		return "", badRequest("The combination of parameters in the request is not allowed. Please validate your input and retry your request.")
+	}
+
+	length := intParam(params, "length", 30)
+	if length < 4 || length > 200 {
+		return "", badRequest("The password length must be between 4 and 200 characters.")
+	}
+
+	return randomString(length, charset), nil
+}
+
+// withPasswordHash adds a password_hash to a user value, in the same format
+// (but not with the same algorithm) as Credhub's SHA-512 crypt hashes
+func withPasswordHash(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	password, _ := m["password"].(string)
+	salt := randomString(8, lowerChars+upperChars+numberChars)
+	sum := sha512.Sum512([]byte(salt + password))
+
+	ret := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		ret[k] = v
+	}
+	ret["password_hash"] = "$6$" + salt + "$" + base64.RawStdEncoding.EncodeToString(sum[:])
+
+	return ret
+}
+
+func encodeRSAKey(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+func generateSSH(params map[string]interface{}) (interface{}, error) {
+	key, err := rsa.GenerateKey(rand.Reader, intParam(params, "key_length", 2048))
+	if err != nil {
+		return nil, err
+	}
+
+	// the OpenSSH wire format for an RSA public key: the key type, the public
+	// exponent and the modulus, each prefixed with its length
+	var wire []byte
+	for _, field := range [][]byte{
+		[]byte("ssh-rsa"),
+		big.NewInt(int64(key.PublicKey.E)).Bytes(),
+		append([]byte{0}, key.PublicKey.N.Bytes()...),
+	} {
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(field)))
+		wire = append(wire, length...)
+		wire = append(wire, field...)
+	}
+
+	public := "ssh-rsa " + base64.StdEncoding.EncodeToString(wire)
+	if comment := stringParam(params, "ssh_comment", ""); comment != "" {
+		public += " " + comment
+	}
+
+	fingerprint := sha256.Sum256(wire)
+
+	return map[string]interface{}{
+		"public_key":             public,
+		"private_key":            encodeRSAKey(key),
+		"public_key_fingerprint": base64.RawStdEncoding.EncodeToString(fingerprint[:]),
+	}, nil
+}
+
+// generateCertificate creates a certificate signed either by itself or by a CA
+// stored in s. s.mu must be held.
+func (s *store) generateCertificate(params map[string]interface{}) (interface{}, error) {
+	caName := stringParam(params, "ca", "")
+	isCA := boolParam(params, "is_ca")
+	selfSign := boolParam(params, "self_sign")
+
+	if caName == "" && !isCA && !selfSign {
+		return nil, badRequest("The combination of parameters in the request is not allowed. Please validate your input and retry your request.")
+	}
+
+	commonName := stringParam(params, "common_name", "")
+	organizations := stringsParam(params, "organization")
+	if org := stringParam(params, "organization", ""); org != "" {
+		organizations = append(organizations, org)
+	}
+
+	if commonName == "" && len(organizations) == 0 {
+		return nil, badRequest("You must provide a common name or organization for a certificate.")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, intParam(params, "key_length", 2048))
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: organizations,
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(0, 0, intParam(params, "duration", 365)),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+
+	for _, name := range stringsParam(params, "alternative_names") {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	for _, usage := range stringsParam(params, "extended_key_usage") {
+		switch usage {
+		case "server_auth":
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		case "client_auth":
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+		case "code_signing":
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageCodeSigning)
+		case "email_protection":
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageEmailProtection)
+		case "timestamping":
+			template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageTimeStamping)
+		}
+	}
+
+	parent := template
+	var signer interface{} = key
+	var caPEM string
+
+	if caName != "" {
+		ca, exists := s.latest(caName)
+		if !exists || ca.Type != credhub.Certificate {
+			return nil, badRequest("The provided CA name could not be found. Please validate your input and retry your request.")
+		}
+
+		caValue, err := credhub.CertificateValue(ca)
+		if err != nil {
+			return nil, err
+		}
+
+		caCert, caKey, err := parseCertificateAndKey(caValue.Certificate, caValue.PrivateKey)
+		if err != nil {
+			return nil, badRequest("The provided CA could not be used to sign the certificate: %s", err)
+		}
+
+		parent = caCert
+		signer = caKey
+		caPEM = caValue.Certificate
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if caPEM == "" {
+		caPEM = certPEM
+	}
+
+	return map[string]interface{}{
+		"ca":          caPEM,
+		"certificate": certPEM,
+		"private_key": encodeRSAKey(key),
+	}, nil
+}
+
+func parseCertificateAndKey(certPEM, keyPEM string) (*x509.Certificate, interface{}, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, nil, badRequest("invalid certificate")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, nil, badRequest("invalid private key")
+	}
+
+	var key interface{}
+	switch {
+	case strings.HasPrefix(keyBlock.Type, "RSA"):
+		key, err = x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	case strings.HasPrefix(keyBlock.Type, "EC"):
+		key, err = x509.ParseECPrivateKey(keyBlock.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	}
+
+	return cert, key, err
+}
@@ -0,0 +1,508 @@
+/*
+Package credhubtest provides an in-memory fake Credhub for testing code that
+uses github.com/cloudfoundry-community/go-credhub.
+
+Example usage:
+
+	server := credhubtest.NewServer(credhubtest.Version2)
+	defer server.Close()
+
+	server.Seed(credhub.Credential{
+		Name:  "/concourse/main/password",
+		Type:  credhub.Password,
+		Value: "hunter2",
+	})
+
+	client, err := server.NewClient()
+	if err != nil {
+		...
+	}
+
+	cred, err := client.GetLatestByName("/concourse/main/password")
+
+*/
+package credhubtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	// Version1 is the version reported by servers emulating the 1.x API
+	Version1 = "1.9.1"
+
+	// Version2 is the version reported by servers emulating the 2.x API
+	Version2 = "2.0.2"
+)
+
+// Server is a fake Credhub and UAA server backed by an in-memory store. It
+// implements the data, permissions, info and version endpoints of Credhub, and
+// the token endpoint of UAA.
+type Server struct {
+	*httptest.Server
+
+	version string
+	store   *store
+	uaa     *fakeUAA
+	faults  faults
+}
+
+// NewServer starts a fake Credhub over TLS that reports the given version.
+// Servers with a 1.x version accept the mode and additional_permissions
+// arguments when setting credentials, while servers with any other version
+// reject them, and also provide the v2 permissions API. Use InjectFault to make
+// the server misbehave. The caller should call Close when finished, to shut it
+// down.
+func NewServer(version string) *Server {
+	s := &Server{
+		version: version,
+		store:   newStore(),
+		uaa:     newFakeUAA(),
+	}
+
+	s.Server = httptest.NewTLSServer(s.injectFaults(s.router()))
+
+	return s
+}
+
+// isV1 returns true if version is a 1.x version
+func isV1(version string) bool {
+	return strings.HasPrefix(version, "1.")
+}
+
+func (s *Server) router() http.Handler {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/info", s.info).Methods(http.MethodGet)
+	router.HandleFunc("/version", s.versionHandler).Methods(http.MethodGet)
+	router.HandleFunc("/oauth/token", s.uaa.serveToken).Methods(http.MethodPost)
+
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(s.authenticate)
+
+	api.HandleFunc("/v1/data", s.getCredentials).Methods(http.MethodGet)
+	api.HandleFunc("/v1/data/{id}", s.getCredentialByID).Methods(http.MethodGet)
+	api.HandleFunc("/v1/data", s.setCredential).Methods(http.MethodPut)
+	api.HandleFunc("/v1/data", s.generateCredential).Methods(http.MethodPost)
+	api.HandleFunc("/v1/data/regenerate", s.regenerateCredential).Methods(http.MethodPost)
+	api.HandleFunc("/v1/data", s.deleteCredential).Methods(http.MethodDelete)
+	api.HandleFunc("/v1/interpolate", s.interpolate).Methods(http.MethodPost)
+
+	api.HandleFunc("/v1/permissions", s.getPermissionsV1).Methods(http.MethodGet)
+	api.HandleFunc("/v1/permissions", s.addPermissionsV1).Methods(http.MethodPost)
+	api.HandleFunc("/v1/permissions", s.deletePermissionV1).Methods(http.MethodDelete)
+
+	if !isV1(s.version) {
+		api.HandleFunc("/v2/permissions", s.findPermissionV2).Methods(http.MethodGet)
+		api.HandleFunc("/v2/permissions", s.addPermissionV2).Methods(http.MethodPost)
+		api.HandleFunc("/v2/permissions/{uuid}", s.getPermissionV2).Methods(http.MethodGet)
+		api.HandleFunc("/v2/permissions/{uuid}", s.updatePermissionV2(false)).Methods(http.MethodPut)
+		api.HandleFunc("/v2/permissions/{uuid}", s.updatePermissionV2(true)).Methods(http.MethodPatch)
+		api.HandleFunc("/v2/permissions/{uuid}", s.deletePermissionV2).Methods(http.MethodDelete)
+	}
+
+	return router
+}
+
+// Seed adds credentials to the server. Each credential is added as a new
+// version, with an ID and creation date generated if they are empty.
+func (s *Server) Seed(creds ...credhub.Credential) {
+	s.store.seed(creds...)
+}
+
+// SeedPermissions grants permissions on a credential, merging them with any
+// that the actors already have.
+func (s *Server) SeedPermissions(credentialName string, perms ...credhub.Permission) {
+	s.store.seedPermissions(credentialName, perms...)
+}
+
+// AddClient allows a UAA client to get tokens with the client_credentials
+// grant. DefaultClient is always allowed.
+func (s *Server) AddClient(clientID, clientSecret string) {
+	s.uaa.addClient(clientID, clientSecret)
+}
+
+// AddUser allows a UAA user to get tokens with the password grant through the
+// credhub_cli client, as the credhub CLI does. It returns the GUID of the user,
+// which forms their actor identity.
+func (s *Server) AddUser(username, password string) string {
+	return s.uaa.addUser(username, password)
+}
+
+// TokenSource returns a token source for the given client of the fake UAA
+func (s *Server) TokenSource(clientID, clientSecret string) oauth2.TokenSource {
+	cfg := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     s.URL + "/oauth/token",
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, s.Server.Client())
+	return cfg.TokenSource(ctx)
+}
+
+// NewClient creates a credhub.Client that trusts the server and authenticates
+// as DefaultClient.
+func (s *Server) NewClient() (*credhub.Client, error) {
+	hc := credhub.NewTokenAuthClient(s.Server.Client(), s.TokenSource(DefaultClient, DefaultClientSecret))
+	return credhub.New(s.URL, hc)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		apiErr = &Error{Status: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	writeJSON(w, apiErr.Status, apiErr)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.uaa.authenticate(r); !ok {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"app": map[string]string{
+			"name": "CredHub",
+		},
+		"auth-server": map[string]string{
+			"url": s.URL,
+		},
+	})
+}
+
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"version": s.version})
+}
+
+func (s *Server) getCredentials(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	switch {
+	case query.Get("name") != "":
+		numVersions := 0
+		if current, _ := strconv.ParseBool(query.Get("current")); current {
+			numVersions = 1
+		} else if versions := query.Get("versions"); versions != "" {
+			var err error
+			if numVersions, err = strconv.Atoi(versions); err != nil || numVersions < 1 {
+				writeError(w, badRequest("The versions parameter must be a positive integer."))
+				return
+			}
+		}
+
+		creds, err := s.store.getByName(query.Get("name"), numVersions)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": creds})
+	case query.Get("paths") == "true":
+		paths := make([]map[string]string, 0)
+		for _, path := range s.store.paths() {
+			paths = append(paths, map[string]string{"path": path})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"paths": paths})
+	case query.Get("name-like") != "":
+		creds := s.store.findByPartialName(query.Get("name-like"))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"credentials": creds})
+	case len(query["path"]) > 0:
+		creds := s.store.findByPath(query.Get("path"))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"credentials": creds})
+	default:
+		writeError(w, badRequest("The query parameter name, path, name-like or paths is required for this request."))
+	}
+}
+
+func (s *Server) getCredentialByID(w http.ResponseWriter, r *http.Request) {
+	cred, err := s.store.getByID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cred)
+}
+
+func (s *Server) setCredential(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		credhub.Credential
+		Mode                  credhub.OverwriteMode `json:"mode"`
+		Overwrite             *bool                 `json:"overwrite"`
+		AdditionalPermissions []credhub.Permission  `json:"additional_permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, badRequest("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+		return
+	}
+
+	mode := body.Mode
+	if isV1(s.version) {
+		if mode == "" {
+			mode = credhub.Converge
+			if body.Overwrite != nil && *body.Overwrite {
+				mode = credhub.Overwrite
+			}
+		}
+	} else {
+		if body.Mode != "" || body.Overwrite != nil || body.AdditionalPermissions != nil {
+			writeError(w, badRequest("The request includes an unrecognized parameter. Please remove it and retry your request."))
+			return
+		}
+		mode = credhub.Overwrite
+	}
+
+	cred, err := s.store.set(body.Credential, mode, body.AdditionalPermissions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cred)
+}
+
+func (s *Server) generateCredential(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name       string                 `json:"name"`
+		Type       credhub.CredentialType `json:"type"`
+		Parameters map[string]interface{} `json:"parameters"`
+		Mode       credhub.OverwriteMode  `json:"mode"`
+		Overwrite  *bool                  `json:"overwrite"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, badRequest("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+		return
+	}
+
+	mode := body.Mode
+	if mode == "" && body.Overwrite != nil {
+		mode = credhub.NoOverwrite
+		if *body.Overwrite {
+			mode = credhub.Overwrite
+		}
+	}
+
+	cred, err := s.store.generate(body.Name, body.Type, body.Parameters, mode)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cred)
+}
+
+func (s *Server) regenerateCredential(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+		writeError(w, badRequest("A credential name must be provided. Please validate your input and retry your request."))
+		return
+	}
+
+	cred, err := s.store.regenerate(body.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cred)
+}
+
+func (s *Server) deleteCredential(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, badRequest("A credential name must be provided. Please validate your input and retry your request."))
+		return
+	}
+
+	if err := s.store.delete(name); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) interpolate(w http.ResponseWriter, r *http.Request) {
+	services := make(map[string][]map[string]interface{})
+	if err := json.NewDecoder(r.Body).Decode(&services); err != nil {
+		writeError(w, badRequest("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+		return
+	}
+
+	for serviceType := range services {
+		for _, service := range services[serviceType] {
+			credRef, ok := service["credentials"].(map[string]interface{})
+			if !ok || len(credRef) != 1 {
+				continue
+			}
+
+			name, ok := credRef["credhub-ref"].(string)
+			if !ok {
+				continue
+			}
+
+			creds, err := s.store.getByName(name, 1)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+
+			// Credhub only interpolates json credentials
+			if creds[0].Type != credhub.JSON {
+				writeError(w, badRequest("The credential '%s' is not the expected type. A credhub-ref credential must be of type 'JSON'.", name))
+				return
+			}
+
+			service["credentials"] = creds[0].Value
+		}
+	}
+
+	writeJSON(w, http.StatusOK, services)
+}
+
+type permissionsV1Body struct {
+	CredentialName string               `json:"credential_name"`
+	Permissions    []credhub.Permission `json:"permissions"`
+}
+
+func (s *Server) getPermissionsV1(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("credential_name")
+
+	perms, err := s.store.permissionsFor(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, permissionsV1Body{
+		CredentialName: normalizeName(name),
+		Permissions:    perms,
+	})
+}
+
+func (s *Server) addPermissionsV1(w http.ResponseWriter, r *http.Request) {
+	var body permissionsV1Body
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, badRequest("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+		return
+	}
+
+	perms, err := s.store.addPermissionsV1(body.CredentialName, body.Permissions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, permissionsV1Body{
+		CredentialName: normalizeName(body.CredentialName),
+		Permissions:    perms,
+	})
+}
+
+func (s *Server) deletePermissionV1(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if err := s.store.deletePermissionV1(query.Get("credential_name"), query.Get("actor")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) findPermissionV2(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	perm, err := s.store.findPermissionV2(query.Get("path"), query.Get("actor"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, perm)
+}
+
+func (s *Server) getPermissionV2(w http.ResponseWriter, r *http.Request) {
+	perm, err := s.store.getPermissionV2(mux.Vars(r)["uuid"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, perm)
+}
+
+func (s *Server) addPermissionV2(w http.ResponseWriter, r *http.Request) {
+	var body PermissionV2
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, badRequest("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+		return
+	}
+
+	perm, err := s.store.addPermissionV2(body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, perm)
+}
+
+func (s *Server) updatePermissionV2(patch bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body PermissionV2
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, badRequest("The request could not be fulfilled because the request path or body did not meet expectation. Please check the documentation for required formatting and retry your request."))
+			return
+		}
+
+		perm, err := s.store.updatePermissionV2(mux.Vars(r)["uuid"], body, patch)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, perm)
+	}
+}
+
+func (s *Server) deletePermissionV2(w http.ResponseWriter, r *http.Request) {
+	perm, err := s.store.deletePermissionV2(mux.Vars(r)["uuid"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, perm)
+}
@@ -0,0 +1,470 @@
+package credhubtest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	. "github.com/onsi/gomega"
+)
+
+func TestServer(t *testing.T) {
+	spec.Run(t, "Server", testServer, spec.Report(report.Terminal{}))
+}
+
+func testServer(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server   *credhubtest.Server
+		chClient *credhub.Client
+	)
+
+	start := func(version string) {
+		var err error
+		server = credhubtest.NewServer(version)
+		chClient, err = server.NewClient()
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		start(credhubtest.Version1)
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	when("seeding credentials", func() {
+		it.Before(func() {
+			server.Seed(
+				credhub.Credential{Name: "/seeded/password", Type: credhub.Password, Value: "old", Created: "2017-01-01T00:00:00Z"},
+				credhub.Credential{Name: "/seeded/password", Type: credhub.Password, Value: "new", Created: "2018-01-01T00:00:00Z"},
+				credhub.Credential{Name: "/seeded/deeper/value", Type: credhub.Value, Value: "v"},
+				credhub.Credential{Name: "/other/user", Type: credhub.User, Value: map[string]string{"username": "me", "password": "pw"}},
+			)
+		})
+
+		it("gets them by name", func() {
+			cred, err := chClient.GetLatestByName("/seeded/password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Value).To(Equal("new"))
+
+			creds, err := chClient.GetAllByName("/seeded/password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(2))
+			Expect(creds[1].Value).To(Equal("old"))
+
+			creds, err = chClient.GetVersionsByName("/seeded/password", 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(1))
+		})
+
+		it("gets them by ID", func() {
+			cred, err := chClient.GetLatestByName("/other/user")
+			Expect(err).NotTo(HaveOccurred())
+
+			byID, err := chClient.GetByID(cred.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(byID.Name).To(Equal("/other/user"))
+
+			_, err = chClient.GetByID("not-an-id")
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("finds them", func() {
+			creds, err := chClient.FindByPath("/seeded")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(2))
+
+			creds, err = chClient.FindByPartialName("PASS")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(1))
+			Expect(creds[0].Name).To(Equal("/seeded/password"))
+
+			paths, err := chClient.ListAllPaths()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(Equal([]string{"/", "/other/", "/seeded/", "/seeded/deeper/"}))
+		})
+
+		it("deletes them", func() {
+			Expect(chClient.Delete("/seeded/password")).To(Succeed())
+
+			_, err := chClient.GetLatestByName("/seeded/password")
+			Expect(err).To(HaveOccurred())
+
+			Expect(chClient.Delete("/seeded/password")).NotTo(Succeed())
+		})
+	})
+
+	when("setting credentials on a v1 server", func() {
+		var user credhub.Credential
+
+		it.Before(func() {
+			user = credhub.Credential{
+				Name:  "/set/user",
+				Type:  credhub.User,
+				Value: credhub.UserValueType{Username: "me", Password: "pw"},
+			}
+		})
+
+		it("honours the overwrite mode", func() {
+			first, err := chClient.Set(user, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			v, err := credhub.UserValue(*first)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v.PasswordHash).NotTo(BeEmpty())
+
+			same, err := chClient.Set(user, credhub.Converge, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(same.ID).To(Equal(first.ID))
+
+			user.Value = credhub.UserValueType{Username: "me", Password: "changed"}
+			kept, err := chClient.Set(user, credhub.NoOverwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kept.ID).To(Equal(first.ID))
+
+			changed, err := chClient.Set(user, credhub.Converge, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed.ID).NotTo(Equal(first.ID))
+
+			creds, err := chClient.GetAllByName("/set/user")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(2))
+		})
+
+		it("grants additional permissions", func() {
+			_, err := chClient.Set(user, credhub.Overwrite, []credhub.Permission{
+				{Actor: "uaa-client:other", Operations: []credhub.Operation{credhub.Read}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			perms, err := chClient.GetPermissions("/set/user")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(ConsistOf(credhub.Permission{Actor: "uaa-client:other", Operations: []credhub.Operation{credhub.Read}}))
+		})
+
+		it("rejects a type change", func() {
+			_, err := chClient.Set(user, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			user.Type = credhub.Value
+			user.Value = "just a value"
+			cred, err := chClient.Set(user, credhub.Overwrite, nil)
+			Expect(err).To(MatchError(ContainSubstring("The credential type cannot be modified")))
+			Expect(cred).To(BeNil())
+		})
+	})
+
+	when("generating credentials", func() {
+		it("generates passwords according to the parameters", func() {
+			cred, err := chClient.Generate("/gen/password", credhub.Password, map[string]interface{}{
+				"length":         12,
+				"exclude_upper":  true,
+				"exclude_number": true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Value).To(MatchRegexp("^[a-z]{12}$"))
+
+			same, err := chClient.Generate("/gen/password", credhub.Password, map[string]interface{}{
+				"length":         12,
+				"exclude_upper":  true,
+				"exclude_number": true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(same.ID).To(Equal(cred.ID))
+
+			regenerated, err := chClient.Regenerate("/gen/password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(regenerated.ID).NotTo(Equal(cred.ID))
+			Expect(regenerated.Value).To(MatchRegexp("^[a-z]{12}$"))
+		})
+
+		it("generates users, keys and certificates", func() {
+			user, err := chClient.Generate("/gen/user", credhub.User, map[string]interface{}{"username": "admin"})
+			Expect(err).NotTo(HaveOccurred())
+			uv, err := credhub.UserValue(*user)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uv.Username).To(Equal("admin"))
+
+			rsa, err := chClient.Generate("/gen/rsa", credhub.RSA, map[string]interface{}{"key_length": 1024})
+			Expect(err).NotTo(HaveOccurred())
+			rv, err := credhub.RSAValue(*rsa)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rv.PrivateKey).To(ContainSubstring("RSA PRIVATE KEY"))
+
+			ssh, err := chClient.Generate("/gen/ssh", credhub.SSH, map[string]interface{}{"key_length": 1024, "ssh_comment": "me@host"})
+			Expect(err).NotTo(HaveOccurred())
+			sv, err := credhub.SSHValue(*ssh)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sv.PublicKey).To(MatchRegexp("^ssh-rsa \\S+ me@host$"))
+
+			ca, err := chClient.Generate("/gen/ca", credhub.Certificate, map[string]interface{}{"is_ca": true, "common_name": "ca", "key_length": 1024})
+			Expect(err).NotTo(HaveOccurred())
+			cav, err := credhub.CertificateValue(*ca)
+			Expect(err).NotTo(HaveOccurred())
+
+			cert, err := chClient.Generate("/gen/cert", credhub.Certificate, map[string]interface{}{"ca": "/gen/ca", "common_name": "leaf", "key_length": 1024})
+			Expect(err).NotTo(HaveOccurred())
+			cv, err := credhub.CertificateValue(*cert)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cv.CA).To(Equal(cav.Certificate))
+		})
+
+		it("cannot generate values", func() {
+			cred, err := chClient.Generate("/gen/value", credhub.Value, map[string]interface{}{})
+			Expect(err).To(MatchError(ContainSubstring("Credentials of this type cannot be generated")))
+			Expect(cred).To(BeNil())
+		})
+
+		it("cannot regenerate statically set credentials", func() {
+			_, err := chClient.Set(credhub.Credential{Name: "/static", Type: credhub.Password, Value: "pw"}, credhub.Overwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			cred, err := chClient.Regenerate("/static")
+			Expect(err).To(MatchError(ContainSubstring("the value was statically set")))
+			Expect(cred).To(BeNil())
+		})
+	})
+
+	when("managing v1 permissions", func() {
+		it.Before(func() {
+			server.Seed(credhub.Credential{Name: "/perms", Type: credhub.Value, Value: "v"})
+			server.SeedPermissions("/perms", credhub.Permission{Actor: "uaa-user:1", Operations: []credhub.Operation{credhub.Read}})
+		})
+
+		it("adds, lists and deletes them", func() {
+			perms, err := chClient.AddPermissions("/perms", []credhub.Permission{
+				{Actor: "uaa-user:1", Operations: []credhub.Operation{credhub.Write}},
+				{Actor: "mtls-app:2", Operations: []credhub.Operation{credhub.Read}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(ConsistOf(
+				credhub.Permission{Actor: "uaa-user:1", Operations: []credhub.Operation{credhub.Read, credhub.Write}},
+				credhub.Permission{Actor: "mtls-app:2", Operations: []credhub.Operation{credhub.Read}},
+			))
+
+			Expect(chClient.DeletePermissions("/perms", "uaa-user:1")).To(Succeed())
+			Expect(chClient.DeletePermissions("/perms", "uaa-user:1")).NotTo(Succeed())
+
+			perms, err = chClient.GetPermissions("/perms")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(HaveLen(1))
+		})
+
+		it("fails for unknown credentials", func() {
+			_, err := chClient.GetPermissions("/unknown")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("emulating a v2 server", func() {
+		it.Before(func() {
+			server.Close()
+			start(credhubtest.Version2)
+		})
+
+		it("reports its version", func() {
+			Expect(chClient.IsV1API()).To(BeFalse())
+		})
+
+		it("always overwrites when setting", func() {
+			cred := credhub.Credential{Name: "/v2/value", Type: credhub.Value, Value: "v"}
+			first, err := chClient.Set(cred, credhub.NoOverwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			second, err := chClient.Set(cred, credhub.NoOverwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second.ID).NotTo(Equal(first.ID))
+		})
+
+		it("provides the v2 permissions API", func() {
+			hc := &http.Client{Transport: server.Client().Transport}
+			token, err := server.TokenSource(credhubtest.DefaultClient, credhubtest.DefaultClientSecret).Token()
+			Expect(err).NotTo(HaveOccurred())
+
+			do := func(method, path string, body interface{}) (*http.Response, credhubtest.PermissionV2) {
+				buf, _ := json.Marshal(body)
+				req, err := http.NewRequest(method, server.URL+path, bytes.NewBuffer(buf))
+				Expect(err).NotTo(HaveOccurred())
+				req.Header.Set("Authorization", "bearer "+token.AccessToken)
+				req.Header.Set("Content-Type", "application/json")
+
+				resp, err := hc.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+
+				var perm credhubtest.PermissionV2
+				json.NewDecoder(resp.Body).Decode(&perm)
+				return resp, perm
+			}
+
+			resp, created := do(http.MethodPost, "/api/v2/permissions", credhubtest.PermissionV2{
+				Path:       "/some/path/*",
+				Actor:      "uaa-client:foo",
+				Operations: []credhub.Operation{credhub.Read},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			Expect(created.UUID).NotTo(BeEmpty())
+
+			resp, _ = do(http.MethodPost, "/api/v2/permissions", created)
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+
+			query := url.Values{"path": {"/some/path/*"}, "actor": {"uaa-client:foo"}}
+			resp, found := do(http.MethodGet, "/api/v2/permissions?"+query.Encode(), nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(found).To(Equal(created))
+
+			// paths are normalized like credential names
+			query.Set("path", "some/path/*")
+			resp, found = do(http.MethodGet, "/api/v2/permissions?"+query.Encode(), nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(found).To(Equal(created))
+
+			resp, relative := do(http.MethodPost, "/api/v2/permissions", credhubtest.PermissionV2{
+				Path:       "other/path",
+				Actor:      "uaa-client:foo",
+				Operations: []credhub.Operation{credhub.Read},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			Expect(relative.Path).To(Equal("/other/path"))
+
+			resp, patched := do(http.MethodPatch, "/api/v2/permissions/"+created.UUID, map[string]interface{}{
+				"operations": []credhub.Operation{credhub.Read, credhub.Write},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(patched.Operations).To(HaveLen(2))
+			Expect(patched.Path).To(Equal("/some/path/*"))
+
+			resp, _ = do(http.MethodPut, "/api/v2/permissions/"+created.UUID, map[string]interface{}{
+				"operations": []credhub.Operation{"bogus"},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+			resp, _ = do(http.MethodDelete, "/api/v2/permissions/"+created.UUID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			resp, _ = do(http.MethodGet, "/api/v2/permissions/"+created.UUID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	when("interpolating VCAP_SERVICES", func() {
+		it("resolves credhub-refs on the server", func() {
+			server.Seed(credhub.Credential{Name: "/service", Type: credhub.JSON, Value: map[string]interface{}{"uri": "mysql://db"}})
+
+			hc := credhub.NewTokenAuthClient(server.Client(), server.TokenSource(credhubtest.DefaultClient, credhubtest.DefaultClientSecret))
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/interpolate", bytes.NewBufferString(`{"p-mysql":[{"credentials":{"credhub-ref":"/service"}},{"credentials":{"credhub-ref":"/service","uri":"kept"}}]}`))
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := hc.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			var body interface{}
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body).To(Equal(map[string]interface{}{
+				"p-mysql": []interface{}{
+					map[string]interface{}{"credentials": map[string]interface{}{"uri": "mysql://db"}},
+					map[string]interface{}{"credentials": map[string]interface{}{"credhub-ref": "/service", "uri": "kept"}},
+				},
+			}))
+		})
+
+		it("only interpolates json credentials, like Credhub", func() {
+			server.Seed(
+				credhub.Credential{Name: "/service", Type: credhub.JSON, Value: map[string]interface{}{"uri": "mysql://db"}},
+				credhub.Credential{Name: "/password", Type: credhub.Password, Value: "hunter2"},
+			)
+			services := `{"p-mysql":[{"credentials":{"credhub-ref":"/service"}}],"p-redis":[{"credentials":{"credhub-ref":"/password"}}]}`
+
+			hc := credhub.NewTokenAuthClient(server.Client(), server.TokenSource(credhubtest.DefaultClient, credhubtest.DefaultClientSecret))
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/interpolate", bytes.NewBufferString(services))
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := hc.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+			interpolated, err := chClient.InterpolateCredentials(services)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated).To(MatchJSON(`{"p-mysql":[{"credentials":{"uri":"mysql://db"}}],"p-redis":[{"credentials":"hunter2"}]}`))
+		})
+
+		it("fails the same way as the client for missing credentials", func() {
+			_, err := chClient.InterpolateCredentials(`{"p-mysql":[{"credentials":{"credhub-ref":"/missing"}}]}`)
+			Expect(err).To(BeAssignableToTypeOf(&credhub.InterpolationError{}))
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveKeyWithValue("/missing", MatchError("Name Not Found")))
+		})
+	})
+
+	when("authenticating", func() {
+		it("serves the UAA endpoint through /info", func() {
+			endpoint, err := credhub.UAAEndpoint(server.URL, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.TokenURL).To(Equal(server.URL + "/oauth/token"))
+		})
+
+		it("identifies the client", func() {
+			server.AddClient("other-client", "other-secret")
+			hc := credhub.NewTokenAuthClient(server.Client(), server.TokenSource("other-client", "other-secret"))
+			other, err := credhub.New(server.URL, hc)
+			Expect(err).NotTo(HaveOccurred())
+
+			actor, err := other.WhoAmI()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actor).To(Equal("uaa-client:other-client"))
+		})
+
+		it("rejects unknown clients and tokens", func() {
+			hc := credhub.NewTokenAuthClient(server.Client(), server.TokenSource("nobody", "nothing"))
+			other, err := credhub.New(server.URL, hc)
+			Expect(err).To(HaveOccurred())
+			Expect(other).To(BeNil())
+
+			resp, err := server.Client().Get(server.URL + "/api/v1/data?paths=true")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		it("issues user tokens that can be refreshed", func() {
+			userID := server.AddUser("admin", "password")
+
+			resp, err := server.Client().PostForm(server.URL+"/oauth/token", url.Values{
+				"grant_type": {"password"},
+				"client_id":  {"credhub_cli"},
+				"username":   {"admin"},
+				"password":   {"password"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			var token struct {
+				AccessToken  string `json:"access_token"`
+				RefreshToken string `json:"refresh_token"`
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&token)).To(Succeed())
+			Expect(token.RefreshToken).NotTo(BeEmpty())
+
+			resp, err = server.Client().PostForm(server.URL+"/oauth/token", url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {"credhub_cli"},
+				"refresh_token": {token.RefreshToken},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(userID).NotTo(BeEmpty())
+		})
+	})
+}
@@ -0,0 +1,677 @@
+package credhubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// Error is an error response from the fake Credhub, carrying the HTTP status
+// code that the server responds with
+type Error struct {
+	Status  int    `json:"-"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func notFound() *Error {
+	return &Error{
+		Status:  http.StatusNotFound,
+		Message: "The request could not be completed because the credential does not exist or you do not have sufficient authorization.",
+	}
+}
+
+func badRequest(format string, args ...interface{}) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// PermissionV2 is a permission entry as managed by the v2 permissions API
+type PermissionV2 struct {
+	UUID       string              `json:"uuid"`
+	Path       string              `json:"path"`
+	Actor      string              `json:"actor"`
+	Operations []credhub.Operation `json:"operations"`
+}
+
+// store holds the credentials and permissions of a fake Credhub. It implements
+// the semantics shared by Server and FakeClient.
+type store struct {
+	mu sync.Mutex
+
+	// versions holds every version of each credential, oldest first
+	versions map[string][]credhub.Credential
+
+	// parameters holds the generation parameters of each generated credential,
+	// so that it can be regenerated
+	parameters map[string]map[string]interface{}
+
+	permissions []*PermissionV2
+
+	lastCreated time.Time
+}
+
+func newStore() *store {
+	return &store{
+		versions:   make(map[string][]credhub.Credential),
+		parameters: make(map[string]map[string]interface{}),
+	}
+}
+
+func normalizeName(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		return "/" + name
+	}
+	return name
+}
+
+func newID() string {
+	guid, err := uuid.NewV4()
+	if err != nil {
+		panic(err)
+	}
+	return guid.String()
+}
+
+// created returns a creation timestamp that is strictly later than every
+// previous one, so that versions always sort in the order they were created
+func (s *store) created() string {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(s.lastCreated) {
+		now = s.lastCreated.Add(time.Millisecond)
+	}
+	s.lastCreated = now
+
+	return now.Format("2006-01-02T15:04:05.000Z")
+}
+
+// add stores a new version of a credential. s.mu must be held.
+func (s *store) add(cred credhub.Credential) credhub.Credential {
+	cred.Name = normalizeName(cred.Name)
+	if cred.ID == "" {
+		cred.ID = newID()
+	}
+	if cred.Created == "" {
+		cred.Created = s.created()
+	}
+
+	s.versions[cred.Name] = append(s.versions[cred.Name], cred)
+	return cred
+}
+
+// latest returns the current version of a credential. s.mu must be held.
+func (s *store) latest(name string) (credhub.Credential, bool) {
+	versions := s.versions[normalizeName(name)]
+	if len(versions) == 0 {
+		return credhub.Credential{}, false
+	}
+
+	return versions[len(versions)-1], true
+}
+
+func (s *store) seed(creds ...credhub.Credential) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cred := range creds {
+		s.add(cred)
+	}
+
+	// seeded credentials may have been created in any order
+	for name := range s.versions {
+		versions := s.versions[name]
+		sort.SliceStable(versions, func(i, j int) bool {
+			return versions[i].Created < versions[j].Created
+		})
+	}
+}
+
+// getByName returns the versions of a credential, newest first. If
+// numVersions is 0 or less, all versions are returned.
+func (s *store) getByName(name string, numVersions int) ([]credhub.Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.versions[normalizeName(name)]
+	if len(versions) == 0 {
+		return nil, notFound()
+	}
+
+	ret := make([]credhub.Credential, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		ret = append(ret, versions[i])
+		if len(ret) == numVersions {
+			break
+		}
+	}
+
+	return ret, nil
+}
+
+func (s *store) getByID(id string) (credhub.Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, versions := range s.versions {
+		for _, cred := range versions {
+			if cred.ID == id {
+				return cred, nil
+			}
+		}
+	}
+
+	return credhub.Credential{}, notFound()
+}
+
+func (s *store) set(cred credhub.Credential, mode credhub.OverwriteMode, perms []credhub.Permission) (credhub.Credential, error) {
+	if cred.Name == "" {
+		return credhub.Credential{}, badRequest("A credential name must be provided. Please validate your input and retry your request.")
+	}
+
+	value, err := validateValue(cred.Type, cred.Value)
+	if err != nil {
+		return credhub.Credential{}, err
+	}
+	cred.Value = withoutPasswordHash(value)
+	cred.ID = ""
+	cred.Created = ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.latest(cred.Name)
+	if exists && existing.Type != cred.Type {
+		return credhub.Credential{}, badRequest("The credential type cannot be modified. Please delete the credential if you wish to create it with a different type.")
+	}
+
+	switch mode {
+	case credhub.Overwrite, "":
+	case credhub.NoOverwrite:
+		if exists {
+			return existing, nil
+		}
+	case credhub.Converge:
+		if exists && reflect.DeepEqual(withoutPasswordHash(existing.Value), cred.Value) {
+			return existing, nil
+		}
+	default:
+		return credhub.Credential{}, badRequest("The request includes an unrecognized mode. Please update or remove the mode and retry your request.")
+	}
+
+	if cred.Type == credhub.User {
+		cred.Value = withPasswordHash(cred.Value)
+	}
+
+	delete(s.parameters, normalizeName(cred.Name))
+	added := s.add(cred)
+	s.addPermissions(added.Name, perms)
+
+	return added, nil
+}
+
+func (s *store) generate(name string, credentialType credhub.CredentialType, params map[string]interface{}, mode credhub.OverwriteMode) (credhub.Credential, error) {
+	if name == "" {
+		return credhub.Credential{}, badRequest("A credential name must be provided. Please validate your input and retry your request.")
+	}
+
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	params = normalizeJSON(params).(map[string]interface{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = normalizeName(name)
+
+	existing, exists := s.latest(name)
+	if exists && existing.Type != credentialType {
+		return credhub.Credential{}, badRequest("The credential type cannot be modified. Please delete the credential if you wish to create it with a different type.")
+	}
+
+	switch mode {
+	case credhub.Overwrite:
+	case credhub.NoOverwrite:
+		if exists {
+			return existing, nil
+		}
+	case credhub.Converge, "":
+		if exists && reflect.DeepEqual(s.parameters[name], params) {
+			return existing, nil
+		}
+	default:
+		return credhub.Credential{}, badRequest("The request includes an unrecognized mode. Please update or remove the mode and retry your request.")
+	}
+
+	value, err := s.generateValue(credentialType, params)
+	if err != nil {
+		return credhub.Credential{}, err
+	}
+
+	added := s.add(credhub.Credential{
+		Name:  name,
+		Type:  credentialType,
+		Value: value,
+	})
+	s.parameters[name] = params
+
+	return added, nil
+}
+
+func (s *store) regenerate(name string) (credhub.Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = normalizeName(name)
+
+	existing, exists := s.latest(name)
+	if !exists {
+		return credhub.Credential{}, notFound()
+	}
+
+	params, generated := s.parameters[name]
+	if !generated {
+		switch existing.Type {
+		case credhub.RSA, credhub.SSH:
+			params = make(map[string]interface{})
+		default:
+			return credhub.Credential{}, badRequest("The credential could not be regenerated because the value was statically set. Only generated credentials may be regenerated.")
+		}
+	}
+
+	value, err := s.generateValue(existing.Type, params)
+	if err != nil {
+		return credhub.Credential{}, err
+	}
+
+	return s.add(credhub.Credential{
+		Name:  name,
+		Type:  existing.Type,
+		Value: value,
+	}), nil
+}
+
+func (s *store) delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = normalizeName(name)
+	if _, exists := s.versions[name]; !exists {
+		return notFound()
+	}
+
+	delete(s.versions, name)
+	delete(s.parameters, name)
+
+	kept := s.permissions[:0]
+	for _, p := range s.permissions {
+		if p.Path != name {
+			kept = append(kept, p)
+		}
+	}
+	s.permissions = kept
+
+	return nil
+}
+
+// find returns the name and creation date of the latest version of each
+// credential that matches, most recently created first
+func (s *store) find(matches func(name string) bool) []credhub.Credential {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := make([]credhub.Credential, 0)
+	for name := range s.versions {
+		if !matches(name) {
+			continue
+		}
+
+		latest, _ := s.latest(name)
+		found = append(found, credhub.Credential{
+			Name:    latest.Name,
+			Created: latest.Created,
+		})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Created > found[j].Created
+	})
+
+	return found
+}
+
+func (s *store) findByPath(path string) []credhub.Credential {
+	prefix := strings.TrimSuffix(normalizeName(path), "/") + "/"
+	return s.find(func(name string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
+
+func (s *store) findByPartialName(partialName string) []credhub.Credential {
+	partialName = strings.ToLower(partialName)
+	return s.find(func(name string) bool {
+		return strings.Contains(strings.ToLower(name), partialName)
+	})
+}
+
+// paths returns every path that contains a credential, including all of their
+// parent paths
+func (s *store) paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := map[string]bool{"/": true}
+	for name := range s.versions {
+		parts := strings.Split(strings.Trim(name, "/"), "/")
+		for i := 1; i < len(parts); i++ {
+			set["/"+strings.Join(parts[:i], "/")+"/"] = true
+		}
+	}
+
+	paths := make([]string, 0, len(set))
+	for path := range set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// permissionsFor returns the v1 view of the permissions on a credential
+func (s *store) permissionsFor(name string) ([]credhub.Permission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = normalizeName(name)
+	if _, exists := s.versions[name]; !exists {
+		return nil, notFound()
+	}
+
+	perms := make([]credhub.Permission, 0)
+	for _, p := range s.permissions {
+		if p.Path == name {
+			perms = append(perms, credhub.Permission{
+				Actor:      p.Actor,
+				Operations: append([]credhub.Operation(nil), p.Operations...),
+			})
+		}
+	}
+
+	return perms, nil
+}
+
+func (s *store) seedPermissions(name string, perms ...credhub.Permission) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addPermissions(normalizeName(name), perms)
+}
+
+// addPermissions merges perms into the permissions for a path. s.mu must be
+// held.
+func (s *store) addPermissions(path string, perms []credhub.Permission) {
+	for _, perm := range perms {
+		entry := s.permission(path, perm.Actor)
+		if entry == nil {
+			entry = &PermissionV2{
+				UUID:  newID(),
+				Path:  path,
+				Actor: perm.Actor,
+			}
+			s.permissions = append(s.permissions, entry)
+		}
+
+		for _, op := range perm.Operations {
+			if !hasOperation(entry.Operations, op) {
+				entry.Operations = append(entry.Operations, op)
+			}
+		}
+	}
+}
+
+func hasOperation(ops []credhub.Operation, op credhub.Operation) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// permission finds the permission entry for an actor on a path. s.mu must be
+// held.
+func (s *store) permission(path, actor string) *PermissionV2 {
+	for _, p := range s.permissions {
+		if p.Path == path && p.Actor == actor {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *store) addPermissionsV1(name string, perms []credhub.Permission) ([]credhub.Permission, error) {
+	s.mu.Lock()
+	name = normalizeName(name)
+	_, exists := s.versions[name]
+	if exists {
+		s.addPermissions(name, perms)
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		return nil, notFound()
+	}
+
+	return s.permissionsFor(name)
+}
+
+func (s *store) deletePermissionV1(name, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = normalizeName(name)
+	for i, p := range s.permissions {
+		if p.Path == name && p.Actor == actor {
+			s.permissions = append(s.permissions[:i], s.permissions[i+1:]...)
+			return nil
+		}
+	}
+
+	return notFound()
+}
+
+func permissionNotFound() *Error {
+	return &Error{
+		Status:  http.StatusNotFound,
+		Message: "The request could not be completed because the permission does not exist or you do not have sufficient authorization.",
+	}
+}
+
+func validatePermissionV2(p PermissionV2) error {
+	if p.Path == "" || p.Actor == "" || len(p.Operations) == 0 {
+		return badRequest("A path, actor and at least one operation must be provided. Please validate your input and retry your request.")
+	}
+
+	for _, op := range p.Operations {
+		switch op {
+		case credhub.Read, credhub.Write, credhub.Delete, credhub.ReadACL, credhub.WriteACL:
+		default:
+			return badRequest("The provided operation is not supported. Valid values include read, write, delete, read_acl, and write_acl.")
+		}
+	}
+
+	return nil
+}
+
+func (s *store) findPermissionV2(path, actor string) (PermissionV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p := s.permission(normalizeName(path), actor); p != nil {
+		return *p, nil
+	}
+
+	return PermissionV2{}, permissionNotFound()
+}
+
+func (s *store) getPermissionV2(id string) (PermissionV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.permissions {
+		if p.UUID == id {
+			return *p, nil
+		}
+	}
+
+	return PermissionV2{}, permissionNotFound()
+}
+
+func (s *store) addPermissionV2(p PermissionV2) (PermissionV2, error) {
+	if err := validatePermissionV2(p); err != nil {
+		return PermissionV2{}, err
+	}
+	p.Path = normalizeName(p.Path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.permission(p.Path, p.Actor) != nil {
+		return PermissionV2{}, &Error{
+			Status:  http.StatusConflict,
+			Message: "A permission entry for this actor and path already exists.",
+		}
+	}
+
+	p.UUID = newID()
+	s.permissions = append(s.permissions, &p)
+
+	return p, nil
+}
+
+func (s *store) updatePermissionV2(id string, update PermissionV2, patch bool) (PermissionV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.permissions {
+		if p.UUID != id {
+			continue
+		}
+
+		updated := *p
+		updated.Operations = update.Operations
+		if !patch {
+			updated.Path = update.Path
+			updated.Actor = update.Actor
+		}
+
+		if err := validatePermissionV2(updated); err != nil {
+			return PermissionV2{}, err
+		}
+		updated.Path = normalizeName(updated.Path)
+
+		*p = updated
+		return updated, nil
+	}
+
+	return PermissionV2{}, permissionNotFound()
+}
+
+func (s *store) deletePermissionV2(id string) (PermissionV2, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.permissions {
+		if p.UUID == id {
+			s.permissions = append(s.permissions[:i], s.permissions[i+1:]...)
+			return *p, nil
+		}
+	}
+
+	return PermissionV2{}, permissionNotFound()
+}
+
+// normalizeJSON round trips a value through encoding/json, so that values
+// can be compared regardless of the Go types they were built from
+func normalizeJSON(v interface{}) interface{} {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var out interface{}
+	if err = json.Unmarshal(buf, &out); err != nil {
+		return v
+	}
+
+	return out
+}
+
+// withoutPasswordHash removes the password_hash that Credhub adds to user
+// values, so that they can be compared with the values they were set with
+func withoutPasswordHash(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	if _, ok = m["password_hash"]; !ok {
+		return value
+	}
+
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != "password_hash" {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// validateValue checks that a value is of the right shape for its type, and
+// returns it in its JSON normalized form
+func validateValue(credentialType credhub.CredentialType, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, badRequest("A non-empty value must be specified for the credential. Please validate and retry your request.")
+	}
+
+	value = normalizeJSON(value)
+
+	switch credentialType {
+	case credhub.Value, credhub.Password:
+		if _, ok := value.(string); !ok {
+			return nil, badRequest("The value of a %s credential must be a string.", credentialType)
+		}
+	case credhub.JSON:
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, badRequest("The value of a json credential must be a JSON object.")
+		}
+	case credhub.User, credhub.RSA, credhub.SSH, credhub.Certificate:
+		m, ok := value.(map[string]interface{})
+		if !ok || len(m) == 0 {
+			return nil, badRequest("The value of a %s credential must be a non-empty object.", credentialType)
+		}
+		for key, v := range m {
+			if _, ok := v.(string); !ok {
+				return nil, badRequest("The %s field of a %s credential must be a string.", key, credentialType)
+			}
+		}
+	default:
+		return nil, badRequest("The request does not include a valid type. Valid values include 'value', 'json', 'password', 'user', 'certificate', 'ssh' and 'rsa'.")
+	}
+
+	return value, nil
+}
@@ -0,0 +1,217 @@
+package credhubtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultClient is the UAA client that every fake UAA accepts
+	DefaultClient = "credhub_client"
+
+	// DefaultClientSecret is the secret of DefaultClient
+	DefaultClientSecret = "secret"
+
+	// cliClient is the client that the credhub CLI uses for password and
+	// refresh token grants
+	cliClient = "credhub_cli"
+)
+
+type uaaUser struct {
+	id       string
+	password string
+}
+
+type issuedToken struct {
+	expiry time.Time
+	claims map[string]interface{}
+}
+
+// fakeUAA issues unsigned JWTs for a small set of clients and users, and
+// remembers them so that the fake Credhub can check them
+type fakeUAA struct {
+	mu sync.Mutex
+
+	clients map[string]string
+	users   map[string]uaaUser
+
+	// tokens maps issued access tokens to their claims
+	tokens map[string]issuedToken
+
+	// refreshTokens maps issued refresh tokens to the claims of the access
+	// tokens they were issued with
+	refreshTokens map[string]map[string]interface{}
+
+	lifetime time.Duration
+}
+
+func newFakeUAA() *fakeUAA {
+	return &fakeUAA{
+		clients:       map[string]string{DefaultClient: DefaultClientSecret, cliClient: ""},
+		users:         make(map[string]uaaUser),
+		tokens:        make(map[string]issuedToken),
+		refreshTokens: make(map[string]map[string]interface{}),
+		lifetime:      time.Hour,
+	}
+}
+
+func (u *fakeUAA) addClient(id, secret string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.clients[id] = secret
+}
+
+func (u *fakeUAA) addUser(username, password string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if user, ok := u.users[username]; ok {
+		user.password = password
+		u.users[username] = user
+		return user.id
+	}
+
+	id := newID()
+	u.users[username] = uaaUser{id: id, password: password}
+	return id
+}
+
+// issue creates a new access token for the claims, and a refresh token for
+// user grants. u.mu must be held.
+func (u *fakeUAA) issue(claims map[string]interface{}) map[string]interface{} {
+	now := time.Now()
+	expiry := now.Add(u.lifetime)
+
+	claims["jti"] = newID()
+	claims["iat"] = now.Unix()
+	claims["exp"] = expiry.Unix()
+	claims["iss"] = "https://uaa.credhubtest/oauth/token"
+
+	payload, _ := json.Marshal(claims)
+	accessToken := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) +
+		"." + base64.RawURLEncoding.EncodeToString(payload) + "."
+
+	u.tokens[accessToken] = issuedToken{expiry: expiry, claims: claims}
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"expires_in":   int(u.lifetime.Seconds()),
+		"scope":        "credhub.read credhub.write",
+		"jti":          claims["jti"],
+	}
+
+	if claims["grant_type"] != "client_credentials" {
+		refreshToken := newID() + "-r"
+		u.refreshTokens[refreshToken] = claims
+		response["refresh_token"] = refreshToken
+	}
+
+	return response
+}
+
+// authenticate checks the bearer token of a request, returning the claims of
+// the token if it is valid
+func (u *fakeUAA) authenticate(r *http.Request) (map[string]interface{}, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil, false
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	token, ok := u.tokens[strings.TrimSpace(header[7:])]
+	if !ok || time.Now().After(token.expiry) {
+		return nil, false
+	}
+
+	return token.claims, true
+}
+
+func (u *fakeUAA) expireTokens() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for accessToken, token := range u.tokens {
+		token.expiry = time.Now().Add(-time.Second)
+		u.tokens[accessToken] = token
+	}
+}
+
+func (u *fakeUAA) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if expected, ok := u.clients[clientID]; !ok || expected != secret {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	var claims map[string]interface{}
+
+	switch r.PostFormValue("grant_type") {
+	case "client_credentials":
+		claims = map[string]interface{}{
+			"grant_type": "client_credentials",
+			"client_id":  clientID,
+			"cid":        clientID,
+			"sub":        clientID,
+		}
+	case "password":
+		username := r.PostFormValue("username")
+		user, ok := u.users[username]
+		if !ok || user.password != r.PostFormValue("password") {
+			writeOAuthError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		claims = map[string]interface{}{
+			"grant_type": "password",
+			"client_id":  clientID,
+			"cid":        clientID,
+			"sub":        user.id,
+			"user_id":    user.id,
+			"user_name":  username,
+		}
+	case "refresh_token":
+		previous, ok := u.refreshTokens[r.PostFormValue("refresh_token")]
+		if !ok || previous["client_id"] != clientID {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_token")
+			return
+		}
+
+		claims = make(map[string]interface{}, len(previous))
+		for k, v := range previous {
+			claims[k] = v
+		}
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, u.issue(claims))
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": http.StatusText(status),
+	})
+}
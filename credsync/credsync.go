@@ -0,0 +1,424 @@
+/*
+Package credsync compares the credentials under a path on two Credhub servers,
+and copies them from one to the other, for foundations that share credentials.
+
+Values are never revealed: they are compared, and shown in diffs, as truncated
+HMAC-SHA256 hashes. The key is random and different for every Diff, so hashes
+can't be used to guess values, and can only be compared within a single diff.
+
+Example usage:
+
+	opts := credsync.Options{
+		Include: []string{"/shared/*"},
+		Exclude: []string{"/shared/local-*"},
+		Mode:    credhub.Converge,
+	}
+
+	diffs, err := credsync.Diff(source, target, "/shared", opts)
+	if err != nil {
+		...
+	}
+
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+
+	results, err := credsync.Sync(source, target, "/shared", opts)
+
+*/
+package credsync
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// Kind is how a credential differs between the source and target
+type Kind string
+
+const (
+	// Unchanged credentials are the same on both servers
+	Unchanged Kind = "unchanged"
+	// Added credentials are only on the source
+	Added Kind = "added"
+	// Changed credentials are on both servers, with different types, values
+	// or permissions
+	Changed Kind = "changed"
+	// Removed credentials are only on the target. Sync never deletes them.
+	Removed Kind = "removed"
+)
+
+// Options control which credentials are compared, and how conflicts are
+// resolved when syncing
+type Options struct {
+	// Include are path.Match patterns for the names of the credentials to
+	// compare. A pattern also matches every credential under a path it
+	// matches, e.g. "/shared/db" includes "/shared/db/password". If it is
+	// empty, every credential is included.
+	Include []string
+
+	// Exclude are patterns, like Include, for credentials to leave out
+	Exclude []string
+
+	// Mode decides what Sync does with credentials that exist on the target:
+	// credhub.Overwrite sets all of them, credhub.NoOverwrite leaves them
+	// alone, and credhub.Converge (the default) sets those that differ
+	Mode credhub.OverwriteMode
+
+	// Permissions compares (and syncs) the permissions of credentials as well,
+	// when both servers have the 1.x API. The permissions of the actors that
+	// the clients authenticate as are ignored.
+	Permissions bool
+}
+
+// Difference is how a single credential differs between the source and target
+type Difference struct {
+	Name string
+	Kind Kind
+
+	// SourceType and SourceHash describe the credential on the source. They
+	// are empty if it is only on the target.
+	SourceType credhub.CredentialType
+	SourceHash string
+
+	// TargetType and TargetHash describe the credential on the target. They
+	// are empty if it is only on the source.
+	TargetType credhub.CredentialType
+	TargetHash string
+
+	// MissingPermissions are the permissions on the source that the target
+	// doesn't have, and ExtraPermissions the ones only on the target, as
+	// "actor: operation, ..."
+	MissingPermissions []string
+	ExtraPermissions   []string
+
+	source *credhub.Credential
+	perms  []credhub.Permission
+}
+
+// String describes the difference without revealing the value
+func (d Difference) String() string {
+	var s string
+	switch d.Kind {
+	case Added:
+		s = fmt.Sprintf("+ %s (%s) %s", d.Name, d.SourceType, d.SourceHash)
+	case Removed:
+		s = fmt.Sprintf("- %s (%s) %s", d.Name, d.TargetType, d.TargetHash)
+	case Changed:
+		switch {
+		case d.SourceType != d.TargetType:
+			s = fmt.Sprintf("~ %s (%s -> %s) %s -> %s", d.Name, d.TargetType, d.SourceType, d.TargetHash, d.SourceHash)
+		case d.SourceHash != d.TargetHash:
+			s = fmt.Sprintf("~ %s (%s) %s -> %s", d.Name, d.SourceType, d.TargetHash, d.SourceHash)
+		default:
+			s = fmt.Sprintf("~ %s (%s) %s", d.Name, d.SourceType, d.SourceHash)
+		}
+	default:
+		s = fmt.Sprintf("  %s (%s) %s", d.Name, d.SourceType, d.SourceHash)
+	}
+
+	for _, perm := range d.MissingPermissions {
+		s += "\n    + permission " + perm
+	}
+	for _, perm := range d.ExtraPermissions {
+		s += "\n    - permission " + perm
+	}
+
+	return s
+}
+
+// Diff compares the credentials under prefix on the source and target, and
+// returns how each differs, in order of name
+func Diff(source, target credhub.API, prefix string, opts Options) ([]Difference, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	sourceCreds, err := latest(source, prefix, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the source: %v", err)
+	}
+
+	targetCreds, err := latest(target, prefix, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the target: %v", err)
+	}
+
+	comparePerms := opts.Permissions && source.IsV1API() && target.IsV1API()
+
+	var sourcePerms, targetPerms map[string][]credhub.Permission
+	if comparePerms {
+		if sourcePerms, err = permissions(source, sourceCreds); err != nil {
+			return nil, fmt.Errorf("unable to read the source: %v", err)
+		}
+		if targetPerms, err = permissions(target, targetCreds); err != nil {
+			return nil, fmt.Errorf("unable to read the target: %v", err)
+		}
+	}
+
+	names := make([]string, 0, len(sourceCreds)+len(targetCreds))
+	for name := range sourceCreds {
+		names = append(names, name)
+	}
+	for name := range targetCreds {
+		if _, ok := sourceCreds[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := make([]Difference, 0, len(names))
+	for _, name := range names {
+		d := Difference{Name: name, Kind: Unchanged}
+
+		s, inSource := sourceCreds[name]
+		if inSource {
+			d.SourceType, d.SourceHash, d.source = s.Type, hash(key, s), s
+		}
+
+		t, inTarget := targetCreds[name]
+		if inTarget {
+			d.TargetType, d.TargetHash = t.Type, hash(key, t)
+		}
+
+		if comparePerms {
+			d.perms = missing(sourcePerms[name], targetPerms[name])
+			d.MissingPermissions = describe(d.perms)
+			if inTarget {
+				d.ExtraPermissions = describe(missing(targetPerms[name], sourcePerms[name]))
+			}
+		}
+
+		switch {
+		case !inTarget:
+			d.Kind = Added
+		case !inSource:
+			d.Kind = Removed
+		case d.SourceType != d.TargetType || d.SourceHash != d.TargetHash:
+			d.Kind = Changed
+		case len(d.MissingPermissions) > 0 || len(d.ExtraPermissions) > 0:
+			d.Kind = Changed
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	return diffs, nil
+}
+
+// Result is the outcome of syncing a single credential
+type Result struct {
+	Difference
+
+	// Set is true if the source's value was set on the target
+	Set bool
+
+	// PermissionsAdded is the number of permissions added to the target
+	PermissionsAdded int
+
+	// Err is why the credential could not be synced
+	Err error
+}
+
+/*
+
+Sync copies the latest version of the credentials under prefix from the source to
+the target, as decided by opts.Mode, and adds the permissions that the target
+is missing if opts.Permissions is set. Credentials that are only on the target,
+and permissions that only it has, are left alone.
+
+A credential that fails doesn't stop the others from being synced; the result of
+each is returned. Credentials whose type differs can not be synced, since
+Credhub doesn't allow types to change.
+
+*/
+func Sync(source, target credhub.API, prefix string, opts Options) ([]Result, error) {
+	mode := opts.Mode
+	switch mode {
+	case "":
+		mode = credhub.Converge
+	case credhub.Overwrite, credhub.NoOverwrite, credhub.Converge:
+	default:
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+
+	diffs, err := Diff(source, target, prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(diffs))
+	for _, d := range diffs {
+		result := Result{Difference: d}
+
+		if d.Kind != Removed {
+			var set bool
+			switch mode {
+			case credhub.Overwrite:
+				set = true
+			case credhub.NoOverwrite:
+				set = d.Kind == Added
+			case credhub.Converge:
+				set = d.Kind == Added || d.SourceType != d.TargetType || d.SourceHash != d.TargetHash
+			}
+
+			if set && d.Kind != Added && d.SourceType != d.TargetType {
+				result.Err = fmt.Errorf("can not change the type of %s from %s to %s", d.Name, d.TargetType, d.SourceType)
+			} else if set {
+				cred := credhub.Credential{Name: d.Name, Type: d.source.Type, Value: credhub.SettableValue(*d.source)}
+				if _, err := target.Set(cred, credhub.Overwrite, nil); err != nil {
+					result.Err = err
+				} else {
+					result.Set = true
+				}
+			}
+		}
+
+		if result.Err == nil && len(d.perms) > 0 {
+			if _, err := target.AddPermissions(d.Name, d.perms); err != nil {
+				result.Err = err
+			} else {
+				result.PermissionsAdded = len(d.perms)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// latest returns the latest version of each included credential under prefix
+func latest(c credhub.API, prefix string, opts Options) (map[string]*credhub.Credential, error) {
+	found, err := c.FindByPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := make(map[string]*credhub.Credential, len(found))
+	for _, f := range found {
+		if !included(f.Name, opts) {
+			continue
+		}
+
+		cred, err := c.GetLatestByName(f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		creds[f.Name] = cred
+	}
+
+	return creds, nil
+}
+
+// permissions returns the permissions of each credential, without those of
+// the client's own actor
+func permissions(c credhub.API, creds map[string]*credhub.Credential) (map[string][]credhub.Permission, error) {
+	actor, err := c.WhoAmI()
+	if err != nil {
+		return nil, err
+	}
+
+	perms := make(map[string][]credhub.Permission, len(creds))
+	for name := range creds {
+		all, err := c.GetPermissions(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+
+		for _, perm := range all {
+			if perm.Actor != actor {
+				perms[name] = append(perms[name], perm)
+			}
+		}
+	}
+
+	return perms, nil
+}
+
+// missing returns the operations in want that have doesn't grant, by actor
+func missing(want, have []credhub.Permission) []credhub.Permission {
+	granted := make(map[string]bool)
+	for _, perm := range have {
+		for _, op := range perm.Operations {
+			granted[perm.Actor+"\x00"+string(op)] = true
+		}
+	}
+
+	var perms []credhub.Permission
+	for _, perm := range want {
+		var ops []credhub.Operation
+		for _, op := range perm.Operations {
+			if !granted[perm.Actor+"\x00"+string(op)] {
+				ops = append(ops, op)
+			}
+		}
+
+		if len(ops) > 0 {
+			perms = append(perms, credhub.Permission{Actor: perm.Actor, Operations: ops})
+		}
+	}
+
+	return perms
+}
+
+func describe(perms []credhub.Permission) []string {
+	var descs []string
+	for _, perm := range perms {
+		ops := make([]string, 0, len(perm.Operations))
+		for _, op := range perm.Operations {
+			ops = append(ops, string(op))
+		}
+		sort.Strings(ops)
+		descs = append(descs, perm.Actor+": "+strings.Join(ops, ", "))
+	}
+	sort.Strings(descs)
+
+	return descs
+}
+
+// included returns true if a credential matches the include patterns and none
+// of the exclude patterns
+func included(name string, opts Options) bool {
+	if len(opts.Include) > 0 && !matchesAny(name, opts.Include) {
+		return false
+	}
+
+	return !matchesAny(name, opts.Exclude)
+}
+
+// matchesAny returns true if name, or any path it is under, matches one of the
+// patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for p := name; p != "/" && p != "."; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hash returns a truncated HMAC-SHA256 of the settable value of a credential,
+// which is the same for equal values on any server
+func hash(key []byte, cred *credhub.Credential) string {
+	// maps are marshalled with sorted keys, so this is canonical
+	buf, _ := json.Marshal(credhub.SettableValue(*cred))
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(buf)
+
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
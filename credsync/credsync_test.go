@@ -0,0 +1,229 @@
+package credsync_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	"github.com/cloudfoundry-community/go-credhub/credsync"
+	. "github.com/onsi/gomega"
+)
+
+func TestCredsync(t *testing.T) {
+	spec.Run(t, "Credsync", testCredsync, spec.Report(report.Terminal{}))
+}
+
+func testCredsync(t *testing.T, when spec.G, it spec.S) {
+	var source, target *credhubtest.FakeClient
+
+	kinds := func(diffs []credsync.Difference) map[string]credsync.Kind {
+		m := make(map[string]credsync.Kind)
+		for _, d := range diffs {
+			m[d.Name] = d.Kind
+		}
+		return m
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		source = credhubtest.NewFakeClient(credhubtest.Version1)
+		source.Seed(
+			credhub.Credential{Name: "/shared/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "secret"}},
+			credhub.Credential{Name: "/shared/token", Type: credhub.Value, Value: "new-token"},
+			credhub.Credential{Name: "/shared/same", Type: credhub.JSON, Value: map[string]interface{}{"a": 1.0}},
+			credhub.Credential{Name: "/shared/typed", Type: credhub.Password, Value: "password"},
+			credhub.Credential{Name: "/shared/local/setting", Type: credhub.Value, Value: "source"},
+			credhub.Credential{Name: "/other/secret", Type: credhub.Value, Value: "other"},
+		)
+
+		target = credhubtest.NewFakeClient(credhubtest.Version1)
+		target.Seed(
+			credhub.Credential{Name: "/shared/token", Type: credhub.Value, Value: "old-token"},
+			credhub.Credential{Name: "/shared/same", Type: credhub.JSON, Value: map[string]interface{}{"a": 1.0}},
+			credhub.Credential{Name: "/shared/typed", Type: credhub.Value, Value: "password"},
+			credhub.Credential{Name: "/shared/target-only", Type: credhub.Value, Value: "mine"},
+		)
+	})
+
+	when("diffing", func() {
+		it("compares names, types and values", func() {
+			diffs, err := credsync.Diff(source, target, "/shared", credsync.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kinds(diffs)).To(Equal(map[string]credsync.Kind{
+				"/shared/db":            credsync.Added,
+				"/shared/local/setting": credsync.Added,
+				"/shared/same":          credsync.Unchanged,
+				"/shared/target-only":   credsync.Removed,
+				"/shared/token":         credsync.Changed,
+				"/shared/typed":         credsync.Changed,
+			}))
+			Expect(diffs[0].Name).To(Equal("/shared/db"))
+		})
+
+		it("doesn't reveal values", func() {
+			diffs, err := credsync.Diff(source, target, "/shared", credsync.Options{})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, d := range diffs {
+				s := d.String()
+				for _, secret := range []string{"secret", "new-token", "old-token", "mine", "source"} {
+					Expect(s).NotTo(ContainSubstring(secret))
+				}
+			}
+
+			Expect(diffs[5].String()).To(MatchRegexp(`^~ /shared/typed \(value -> password\) hmac:[0-9a-f]{16} -> hmac:[0-9a-f]{16}$`))
+			Expect(diffs[5].SourceHash).To(Equal(diffs[5].TargetHash))
+		})
+
+		it("ignores computed fields", func() {
+			target.Seed(credhub.Credential{Name: "/shared/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "secret"}})
+
+			diffs, err := credsync.Diff(source, target, "/shared", credsync.Options{Include: []string{"/shared/db"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(diffs).To(HaveLen(1))
+			Expect(diffs[0].Kind).To(Equal(credsync.Unchanged))
+		})
+
+		it("filters with include and exclude patterns", func() {
+			diffs, err := credsync.Diff(source, target, "/", credsync.Options{
+				Include: []string{"/shared/*"},
+				Exclude: []string{"/shared/local", "/shared/t*"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kinds(diffs)).To(Equal(map[string]credsync.Kind{
+				"/shared/db":   credsync.Added,
+				"/shared/same": credsync.Unchanged,
+			}))
+		})
+
+		it("compares permissions", func() {
+			read := credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read, credhub.Write}}
+			source.SeedPermissions("/shared/same", read)
+			target.SeedPermissions("/shared/same", credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read}})
+			target.SeedPermissions("/shared/same", credhub.Permission{Actor: "uaa-user:extra", Operations: []credhub.Operation{credhub.Delete}})
+
+			diffs, err := credsync.Diff(source, target, "/shared", credsync.Options{Include: []string{"/shared/same"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(diffs[0].Kind).To(Equal(credsync.Unchanged))
+
+			diffs, err = credsync.Diff(source, target, "/shared", credsync.Options{Include: []string{"/shared/same"}, Permissions: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(diffs[0].Kind).To(Equal(credsync.Changed))
+			Expect(diffs[0].MissingPermissions).To(Equal([]string{"uaa-user:reader: write"}))
+			Expect(diffs[0].ExtraPermissions).To(Equal([]string{"uaa-user:extra: delete"}))
+			Expect(diffs[0].String()).To(ContainSubstring("\n    + permission uaa-user:reader: write"))
+		})
+	})
+
+	when("syncing", func() {
+		value := func(name string) interface{} {
+			cred, err := target.GetLatestByName(name)
+			Expect(err).NotTo(HaveOccurred())
+			return cred.Value
+		}
+
+		versions := func(name string) int {
+			creds, err := target.GetAllByName(name)
+			Expect(err).NotTo(HaveOccurred())
+			return len(creds)
+		}
+
+		it("converges by default", func() {
+			results, err := credsync.Sync(source, target, "/shared", credsync.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(6))
+
+			Expect(value("/shared/db")).To(HaveKeyWithValue("password", "secret"))
+			Expect(value("/shared/token")).To(Equal("new-token"))
+			Expect(versions("/shared/same")).To(Equal(1))
+			Expect(value("/shared/target-only")).To(Equal("mine"))
+
+			for _, result := range results {
+				switch result.Name {
+				case "/shared/typed":
+					Expect(result.Err).To(MatchError("can not change the type of /shared/typed from value to password"))
+				case "/shared/db", "/shared/token", "/shared/local/setting":
+					Expect(result.Set).To(BeTrue())
+					Expect(result.Err).NotTo(HaveOccurred())
+				default:
+					Expect(result.Set).To(BeFalse())
+					Expect(result.Err).NotTo(HaveOccurred())
+				}
+			}
+
+			diffs, err := credsync.Diff(source, target, "/shared", credsync.Options{Exclude: []string{"/shared/typed", "/shared/target-only"}})
+			Expect(err).NotTo(HaveOccurred())
+			for _, d := range diffs {
+				Expect(d.Kind).To(Equal(credsync.Unchanged), d.Name)
+			}
+		})
+
+		it("only adds missing credentials without overwriting", func() {
+			_, err := credsync.Sync(source, target, "/shared", credsync.Options{Mode: credhub.NoOverwrite})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(value("/shared/db")).To(HaveKeyWithValue("password", "secret"))
+			Expect(value("/shared/token")).To(Equal("old-token"))
+		})
+
+		it("sets everything when overwriting", func() {
+			_, err := credsync.Sync(source, target, "/shared", credsync.Options{Mode: credhub.Overwrite, Exclude: []string{"/shared/typed"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(value("/shared/token")).To(Equal("new-token"))
+			Expect(versions("/shared/same")).To(Equal(2))
+		})
+
+		it("adds missing permissions", func() {
+			source.SeedPermissions("/shared/db", credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read}})
+
+			results, err := credsync.Sync(source, target, "/shared", credsync.Options{Include: []string{"/shared/db"}, Permissions: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Set).To(BeTrue())
+			Expect(results[0].PermissionsAdded).To(Equal(1))
+
+			perms, err := target.GetPermissions("/shared/db")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(ContainElement(credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read}}))
+		})
+
+		it("doesn't report writes the server rejects as synced", func() {
+			source.SeedPermissions("/shared/db", credhub.Permission{Actor: "uaa-user:reader", Operations: []credhub.Operation{credhub.Read}})
+			opts := credsync.Options{Include: []string{"/shared/db"}, Permissions: true}
+
+			server := credhubtest.NewServer(credhubtest.Version1)
+			defer server.Close()
+
+			client, err := server.NewClient()
+			Expect(err).NotTo(HaveOccurred())
+
+			server.InjectFault(http.MethodPut, "/api/v1/data", credhubtest.Fault{Status: http.StatusForbidden})
+			results, err := credsync.Sync(source, client, "/shared", opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Set).To(BeFalse())
+			Expect(results[0].PermissionsAdded).To(BeZero())
+			Expect(results[0].Err).To(MatchError(ContainSubstring("got 403 Forbidden")))
+
+			server.ClearFaults()
+			server.InjectFault(http.MethodPost, "/api/v1/permissions", credhubtest.Fault{Status: http.StatusForbidden})
+			results, err = credsync.Sync(source, client, "/shared", opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+			Expect(results[0].Set).To(BeTrue())
+			Expect(results[0].PermissionsAdded).To(BeZero())
+			Expect(results[0].Err).To(MatchError(ContainSubstring("got 403 Forbidden")))
+		})
+
+		it("rejects unknown modes", func() {
+			_, err := credsync.Sync(source, target, "/shared", credsync.Options{Mode: "sometimes"})
+			Expect(err).To(MatchError(`unknown mode "sometimes"`))
+		})
+	})
+}
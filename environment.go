@@ -0,0 +1,148 @@
+package credhub
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+/*
+
+NewFromEnvironment creates a Credhub client configured from the same environment
+variables that the credhub CLI uses:
+
+	CREDHUB_SERVER  - the URL of the Credhub server (CREDHUB_API is used if this is unset)
+	CREDHUB_CLIENT  - the UAA client to authenticate as
+	CREDHUB_SECRET  - the secret of the UAA client
+	CREDHUB_CA_CERT - a PEM encoded CA certificate, or a path to one, to trust
+	CREDHUB_PROXY   - the URL of a proxy to use when connecting to Credhub
+
+If CREDHUB_CLIENT and CREDHUB_SECRET are not set, but CF_INSTANCE_CERT and
+CF_INSTANCE_KEY are (i.e. when running inside a Cloud Foundry container), the
+client will authenticate with the instance identity certificate via
+NewCFAppAuthClient.
+
+*/
+func NewFromEnvironment() (*Client, error) {
+	server := os.Getenv("CREDHUB_SERVER")
+	if server == "" {
+		server = os.Getenv("CREDHUB_API")
+	}
+
+	if server == "" {
+		return nil, errors.New("CREDHUB_SERVER is not set")
+	}
+	server = strings.TrimSuffix(server, "/")
+
+	tr, err := environmentTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := os.Getenv("CREDHUB_CLIENT")
+	clientSecret := os.Getenv("CREDHUB_SECRET")
+
+	var hc HTTPClient
+	switch {
+	case clientID != "" && clientSecret != "":
+		baseClient := &http.Client{Transport: tr}
+
+		endpoint, err := uaaEndpoint(baseClient, server)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := &clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     endpoint.TokenURL,
+		}
+
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, baseClient)
+		hc = NewTokenAuthClient(baseClient, cfg.TokenSource(ctx))
+	case clientID != "" || clientSecret != "":
+		return nil, errors.New("both CREDHUB_CLIENT and CREDHUB_SECRET must be set")
+	case os.Getenv("CF_INSTANCE_CERT") != "" && os.Getenv("CF_INSTANCE_KEY") != "":
+		hc, err = NewCFAppAuthClient(tr)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("no credentials found: set CREDHUB_CLIENT and CREDHUB_SECRET, or CF_INSTANCE_CERT and CF_INSTANCE_KEY")
+	}
+
+	return New(server, hc)
+}
+
+func environmentTransport() (*http.Transport, error) {
+	var caCerts []string
+	if caCert := os.Getenv("CREDHUB_CA_CERT"); caCert != "" {
+		caCerts = append(caCerts, caCert)
+	}
+
+	return newTransport(caCerts, false)
+}
+
+// newTransport creates a copy of the default transport that trusts the given CA
+// certificates, and uses the proxy in CREDHUB_PROXY if it is set
+func newTransport(caCerts []string, skipTLSVerify bool) (*http.Transport, error) {
+	tr := copyTransport(http.DefaultTransport.(*http.Transport))
+
+	if len(caCerts) > 0 || skipTLSVerify {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: skipTLSVerify}
+	}
+
+	if len(caCerts) > 0 {
+		pool, err := certPool(caCerts...)
+		if err != nil {
+			return nil, err
+		}
+
+		tr.TLSClientConfig.RootCAs = pool
+	}
+
+	if proxy := os.Getenv("CREDHUB_PROXY"); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CREDHUB_PROXY: %s", err)
+		}
+
+		tr.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return tr, nil
+}
+
+// certPool creates a pool from the system roots plus each of the given
+// certificates, which may either be PEM encoded or a path to a PEM file
+func certPool(certs ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, cert := range certs {
+		pem := []byte(cert)
+		if !strings.Contains(cert, "-----BEGIN") {
+			if pem, err = ioutil.ReadFile(cert); err != nil {
+				return nil, err
+			}
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no valid CA certificates found")
+		}
+	}
+
+	return pool, nil
+}
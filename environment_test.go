@@ -0,0 +1,188 @@
+package credhub_test
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	. "github.com/onsi/gomega"
+)
+
+var environmentVariables = []string{
+	"CREDHUB_SERVER",
+	"CREDHUB_API",
+	"CREDHUB_CLIENT",
+	"CREDHUB_SECRET",
+	"CREDHUB_CA_CERT",
+	"CREDHUB_PROXY",
+	"CF_INSTANCE_CERT",
+	"CF_INSTANCE_KEY",
+}
+
+func TestNewFromEnvironment(t *testing.T) {
+	spec.Run(t, "NewFromEnvironment", testNewFromEnvironment, spec.Report(report.Terminal{}))
+}
+
+func testNewFromEnvironment(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server *httptest.Server
+		caCert string
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		server = mockCredhubServer()
+		caCert = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: server.Certificate().Raw,
+		}))
+
+		for _, v := range environmentVariables {
+			os.Unsetenv(v)
+		}
+	})
+
+	it.After(func() {
+		server.Close()
+
+		for _, v := range environmentVariables {
+			os.Unsetenv(v)
+		}
+	})
+
+	when("client credentials are set", func() {
+		it.Before(func() {
+			os.Setenv("CREDHUB_SERVER", server.URL)
+			os.Setenv("CREDHUB_CLIENT", "user")
+			os.Setenv("CREDHUB_SECRET", "pass")
+		})
+
+		it("authenticates with UAA using a PEM encoded CA certificate", func() {
+			os.Setenv("CREDHUB_CA_CERT", caCert)
+
+			chClient, err := credhub.NewFromEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+
+			cred, err := chClient.GetLatestByName("/concourse/common/sample-password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Value).To(BeEquivalentTo("sample1"))
+		})
+
+		it("reads the CA certificate from a file", func() {
+			f, err := ioutil.TempFile("", "ca-cert")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(f.Name())
+
+			_, err = f.WriteString(caCert)
+			Expect(err).NotTo(HaveOccurred())
+			f.Close()
+
+			os.Setenv("CREDHUB_CA_CERT", f.Name())
+
+			_, err = credhub.NewFromEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it("uses CREDHUB_API when CREDHUB_SERVER is not set", func() {
+			os.Unsetenv("CREDHUB_SERVER")
+			os.Setenv("CREDHUB_API", server.URL)
+			os.Setenv("CREDHUB_CA_CERT", caCert)
+
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it("fails when the secret is wrong", func() {
+			os.Setenv("CREDHUB_CA_CERT", caCert)
+			os.Setenv("CREDHUB_SECRET", "wrong")
+
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails when the server is not trusted", func() {
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails when the CA certificate is invalid", func() {
+			os.Setenv("CREDHUB_CA_CERT", "-----BEGIN CERTIFICATE-----\ngarbage\n-----END CERTIFICATE-----")
+
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails when the proxy is invalid", func() {
+			os.Setenv("CREDHUB_CA_CERT", caCert)
+			os.Setenv("CREDHUB_PROXY", "://bad-proxy")
+
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("running inside a CF container", func() {
+		var mtlsServer *httptest.Server
+
+		it.Before(func() {
+			mtlsServer = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(r.TLS.PeerCertificates) == 0 {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				fmt.Fprint(w, `{"version": "2.0.0"}`)
+			}))
+			mtlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+			mtlsServer.StartTLS()
+
+			os.Setenv("CREDHUB_API", mtlsServer.URL)
+			os.Setenv("CREDHUB_CA_CERT", caCert)
+			os.Setenv("CF_INSTANCE_KEY", "testdata/tls/key")
+			os.Setenv("CF_INSTANCE_CERT", "testdata/tls/cert")
+		})
+
+		it.After(func() {
+			mtlsServer.Close()
+		})
+
+		it("authenticates with the instance identity", func() {
+			chClient, err := credhub.NewFromEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chClient.IsV1API()).To(BeFalse())
+		})
+	})
+
+	when("the environment is incomplete", func() {
+		it("fails without a server", func() {
+			os.Setenv("CREDHUB_CLIENT", "user")
+			os.Setenv("CREDHUB_SECRET", "pass")
+
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails with only a client", func() {
+			os.Setenv("CREDHUB_SERVER", server.URL)
+			os.Setenv("CREDHUB_CLIENT", "user")
+
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails without any credentials", func() {
+			os.Setenv("CREDHUB_SERVER", server.URL)
+
+			_, err := credhub.NewFromEnvironment()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
@@ -0,0 +1,332 @@
+/*
+Package extract moves literal secrets out of YAML files and into Credhub,
+leaving ((name)) placeholders in their place that the interpolate package (or
+BOSH, or Concourse) can resolve.
+
+Example usage:
+
+	keys := []extract.Key{
+		{Path: "/properties/db/password"},
+		{Path: "/properties/tls", Name: "db_tls"},
+	}
+
+	plan, err := extract.NewPlan(manifest, keys, "/concourse/main")
+	if err != nil {
+		...
+	}
+
+	for _, change := range plan.Changes {
+		fmt.Println(change)
+	}
+
+	if err = plan.Apply(client); err != nil {
+		...
+	}
+
+	err = ioutil.WriteFile("manifest.yml", plan.Document, 0644)
+
+*/
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/internal/yamljson"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var errNotFound = errors.New("no value found")
+
+var (
+	placeholderRegexp = regexp.MustCompile(`^\(\(.*\)\)$`)
+	nameRegexp        = regexp.MustCompile(`[^-\w]+`)
+
+	// passwordRegexp matches keys whose last word, separated by _, -, . or a
+	// change of case, names a secret: db_password, apiKey, tokens, but not
+	// keepalive or key_count
+	passwordRegexp = regexp.MustCompile(`(?:^|[-_.])(?i:pass|passwd|password|passphrase|secret|token|key)s?$|[a-z0-9](?:Pass|Passwd|Password|Passphrase|Secret|Token|Key)s?$`)
+)
+
+// Key is the location of a secret in a YAML document, and the name of the
+// credential to store it in
+type Key struct {
+	// Path is the location of the secret, in the form of a BOSH ops file
+	// path, e.g. /instance_groups/0/jobs/1/properties/password
+	Path string
+
+	// Name is the name of the credential, relative to the plan's prefix. If
+	// it is empty, it is made from the path, e.g.
+	// instance_groups_0_jobs_1_properties_password
+	Name string
+}
+
+// ParseKey parses a key of the form path or path=name
+func ParseKey(s string) (Key, error) {
+	parts := strings.SplitN(s, "=", 2)
+
+	key := Key{Path: parts[0]}
+	if len(parts) == 2 {
+		key.Name = parts[1]
+	}
+
+	if !strings.HasPrefix(key.Path, "/") {
+		return Key{}, fmt.Errorf("invalid key %q: paths must start with /", s)
+	}
+
+	if len(parts) == 2 && key.Name == "" {
+		return Key{}, fmt.Errorf("invalid key %q: name must not be empty", s)
+	}
+
+	return key, nil
+}
+
+// Change is a single secret that a Plan moves into Credhub
+type Change struct {
+	// Path is where the secret is in the document
+	Path string
+
+	// Credential is the credential the secret will be stored as
+	Credential credhub.Credential
+
+	// Placeholder is what the secret is replaced with in the document
+	Placeholder string
+}
+
+// String describes the change without revealing the secret
+func (c Change) String() string {
+	return fmt.Sprintf("%s -> %s (%s) as %s", c.Path, c.Credential.Name, c.Credential.Type, c.Placeholder)
+}
+
+// Plan is the set of changes needed to extract secrets from a document
+type Plan struct {
+	// Changes are the secrets to store, in the order of the keys
+	Changes []Change
+
+	// Document is the YAML document with the secrets replaced by
+	// placeholders
+	Document []byte
+}
+
+/*
+
+NewPlan works out how to extract the secrets at each of the keys from a YAML
+document. Credentials are named under prefix, and the placeholders refer to
+them relative to prefix, so the document should be interpolated with the same
+prefix. NewPlan doesn't change anything; use Apply to store the credentials.
+
+The type of each credential is chosen from its value:
+
+  - maps are stored as json credentials, unless they hold a certificate,
+    private_key and optional ca, in which case they are certificates
+  - strings holding a PEM certificate are stored as certificates, and replaced
+    by ((name.certificate))
+  - strings under keys that name passwords, secrets, tokens or keys (e.g.
+    db_password or apiKey) are stored as passwords
+  - other strings are stored as values
+
+Numbers and booleans can't be extracted, since credentials are strings and the
+interpolated document would change their type; extract the map that holds them
+instead, which is stored as json.
+
+Comments and formatting in the document are not preserved.
+
+*/
+func NewPlan(doc []byte, keys []Key, prefix string) (*Plan, error) {
+	var root interface{}
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+
+	// decode maps into MapSlices, so that the order of the keys is kept
+	if _, ok := root.(map[interface{}]interface{}); ok {
+		var ms yaml.MapSlice
+		if err := yaml.Unmarshal(doc, &ms); err != nil {
+			return nil, err
+		}
+		root = ms
+	}
+
+	prefix = "/" + strings.Trim(prefix, "/")
+	plan := new(Plan)
+	names := make(map[string]string)
+
+	for _, key := range keys {
+		segments, err := splitPath(key.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := key.Name
+		if name == "" {
+			name = nameRegexp.ReplaceAllString(strings.Join(segments, "_"), "_")
+		}
+
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be stored as %s", other, key.Path, name)
+		}
+		names[name] = key.Path
+
+		var change *Change
+		root, err = replace(root, segments, func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok && placeholderRegexp.MatchString(s) {
+				return nil, fmt.Errorf("%s is already a placeholder", key.Path)
+			}
+
+			cred, field, err := credential(segments[len(segments)-1], value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key.Path, err)
+			}
+			cred.Name = strings.TrimSuffix(prefix, "/") + "/" + name
+
+			placeholder := "((" + name + field + "))"
+			change = &Change{Path: key.Path, Credential: cred, Placeholder: placeholder}
+			return placeholder, nil
+		})
+		if err == errNotFound {
+			return nil, fmt.Errorf("%s: no value found", key.Path)
+		} else if err != nil {
+			return nil, err
+		}
+
+		plan.Changes = append(plan.Changes, *change)
+	}
+
+	out, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	plan.Document = out
+
+	return plan, nil
+}
+
+// Apply stores the credentials of the plan. Credentials that already exist
+// with the same value are left alone on servers that support it. The error is
+// nil only if every credential was stored, so that the document can safely
+// replace the manifest.
+func (p *Plan) Apply(c credhub.API) error {
+	for _, change := range p.Changes {
+		cred, err := c.Set(change.Credential, credhub.Converge, nil)
+		if err == nil && (cred == nil || cred.ID == "" || cred.Name != change.Credential.Name) {
+			err = errors.New("the server did not return the stored credential")
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to store %s as %s: %v", change.Path, change.Credential.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// splitPath splits an ops file path into its segments, unescaping ~1 and ~0
+func splitPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") || path == "/" {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+
+	segments := strings.Split(path[1:], "/")
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+	}
+
+	return segments, nil
+}
+
+// replace returns node with the value at segments replaced with the result of
+// fn
+func replace(node interface{}, segments []string, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	if len(segments) == 0 {
+		return fn(node)
+	}
+
+	segment := segments[0]
+
+	switch t := node.(type) {
+	case yaml.MapSlice:
+		for i, item := range t {
+			if fmt.Sprint(item.Key) == segment {
+				value, err := replace(item.Value, segments[1:], fn)
+				if err != nil {
+					return nil, err
+				}
+				t[i].Value = value
+				return t, nil
+			}
+		}
+	case []interface{}:
+		i, err := strconv.Atoi(segment)
+		if err == nil && i >= 0 && i < len(t) {
+			value, err := replace(t[i], segments[1:], fn)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = value
+			return t, nil
+		}
+	}
+
+	return nil, errNotFound
+}
+
+// credential returns the credential to store a value as, and the field of it
+// the placeholder should select
+func credential(key string, value interface{}) (credhub.Credential, string, error) {
+	switch t := value.(type) {
+	case nil:
+		return credhub.Credential{}, "", errors.New("value is empty")
+	case []interface{}:
+		return credhub.Credential{}, "", errors.New("lists can not be stored as credentials; extract the map that holds the list instead")
+	case yaml.MapSlice:
+		v, err := yamljson.Convert(t)
+		if err != nil {
+			return credhub.Credential{}, "", err
+		}
+
+		if m, ok := v.(map[string]interface{}); ok && isCertificate(m) {
+			return credhub.Credential{Type: credhub.Certificate, Value: m}, "", nil
+		}
+
+		return credhub.Credential{Type: credhub.JSON, Value: v}, "", nil
+	case string:
+		if strings.Contains(t, "-----BEGIN CERTIFICATE-----") {
+			return credhub.Credential{Type: credhub.Certificate, Value: map[string]interface{}{"certificate": t}}, ".certificate", nil
+		}
+
+		credType := credhub.Value
+		if passwordRegexp.MatchString(key) {
+			credType = credhub.Password
+		}
+
+		return credhub.Credential{Type: credType, Value: t}, "", nil
+	}
+
+	return credhub.Credential{}, "", fmt.Errorf("%T values can not be stored as credentials, which are strings; quote the value, or extract the map that holds it instead", value)
+}
+
+// isCertificate returns true if m has the fields of a certificate credential
+func isCertificate(m map[string]interface{}) bool {
+	for key, value := range m {
+		if _, ok := value.(string); !ok {
+			return false
+		}
+
+		switch key {
+		case "ca", "certificate", "private_key":
+		default:
+			return false
+		}
+	}
+
+	_, hasCert := m["certificate"]
+	_, hasKey := m["private_key"]
+	return hasCert && hasKey
+}
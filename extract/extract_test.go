@@ -0,0 +1,227 @@
+package extract_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	"github.com/cloudfoundry-community/go-credhub/extract"
+	"github.com/cloudfoundry-community/go-credhub/interpolate"
+	. "github.com/onsi/gomega"
+)
+
+// emptySetAPI accepts writes without storing them, as a client that doesn't
+// check the response status did when the server refused them
+type emptySetAPI struct {
+	credhub.API
+}
+
+func (emptySetAPI) Set(credhub.Credential, credhub.OverwriteMode, []credhub.Permission) (*credhub.Credential, error) {
+	return &credhub.Credential{}, nil
+}
+
+func TestExtract(t *testing.T) {
+	spec.Run(t, "Extract", testExtract, spec.Report(report.Terminal{}))
+}
+
+const manifest = `name: app
+instance_groups:
+- name: web
+  jobs:
+  - name: server
+    properties:
+      db:
+        host: db.example.com
+        password: hunter2
+        port: 5432
+      ca_cert: |
+        -----BEGIN CERTIFICATE-----
+        MIIB
+        -----END CERTIFICATE-----
+      tls:
+        certificate: CERT
+        private_key: KEY
+      settings:
+        retries: 3
+        hosts:
+        - a
+        - b
+      hosts:
+      - a
+`
+
+func testExtract(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("parsing keys", func() {
+		it("parses paths with and without names", func() {
+			Expect(extract.ParseKey("/a/b")).To(Equal(extract.Key{Path: "/a/b"}))
+			Expect(extract.ParseKey("/a/b=name")).To(Equal(extract.Key{Path: "/a/b", Name: "name"}))
+
+			_, err := extract.ParseKey("a/b")
+			Expect(err).To(HaveOccurred())
+			_, err = extract.ParseKey("/a/b=")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("planning", func() {
+		keys := []extract.Key{
+			{Path: "/instance_groups/0/jobs/0/properties/db/password"},
+			{Path: "/instance_groups/0/jobs/0/properties/db/host", Name: "db_host"},
+			{Path: "/instance_groups/0/jobs/0/properties/ca_cert", Name: "ca"},
+			{Path: "/instance_groups/0/jobs/0/properties/tls", Name: "tls"},
+			{Path: "/instance_groups/0/jobs/0/properties/settings", Name: "settings"},
+		}
+
+		it("chooses a type for each secret", func() {
+			plan, err := extract.NewPlan([]byte(manifest), keys, "/concourse/main/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Changes).To(HaveLen(5))
+
+			Expect(plan.Changes[0].Credential).To(Equal(credhub.Credential{
+				Name:  "/concourse/main/instance_groups_0_jobs_0_properties_db_password",
+				Type:  credhub.Password,
+				Value: "hunter2",
+			}))
+			Expect(plan.Changes[0].Placeholder).To(Equal("((instance_groups_0_jobs_0_properties_db_password))"))
+
+			Expect(plan.Changes[1].Credential).To(Equal(credhub.Credential{Name: "/concourse/main/db_host", Type: credhub.Value, Value: "db.example.com"}))
+
+			Expect(plan.Changes[2].Credential.Type).To(Equal(credhub.Certificate))
+			Expect(plan.Changes[2].Credential.Value).To(Equal(map[string]interface{}{"certificate": "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"}))
+			Expect(plan.Changes[2].Placeholder).To(Equal("((ca.certificate))"))
+
+			Expect(plan.Changes[3].Credential.Type).To(Equal(credhub.Certificate))
+			Expect(plan.Changes[3].Credential.Value).To(Equal(map[string]interface{}{"certificate": "CERT", "private_key": "KEY"}))
+
+			Expect(plan.Changes[4].Credential.Type).To(Equal(credhub.JSON))
+			Expect(plan.Changes[4].Credential.Value).To(Equal(map[string]interface{}{"retries": 3, "hosts": []interface{}{"a", "b"}}))
+		})
+
+		it("rewrites the document with placeholders", func() {
+			plan, err := extract.NewPlan([]byte(manifest), keys, "/concourse/main")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(plan.Document)).To(Equal(`name: app
+instance_groups:
+- name: web
+  jobs:
+  - name: server
+    properties:
+      db:
+        host: ((db_host))
+        password: ((instance_groups_0_jobs_0_properties_db_password))
+        port: 5432
+      ca_cert: ((ca.certificate))
+      tls: ((tls))
+      settings: ((settings))
+      hosts:
+      - a
+`))
+		})
+
+		it("describes changes without revealing secrets", func() {
+			plan, err := extract.NewPlan([]byte(manifest), keys[:1], "/concourse/main")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Changes[0].String()).To(Equal("/instance_groups/0/jobs/0/properties/db/password -> /concourse/main/instance_groups_0_jobs_0_properties_db_password (password) as ((instance_groups_0_jobs_0_properties_db_password))"))
+			Expect(plan.Changes[0].String()).NotTo(ContainSubstring("hunter2"))
+		})
+
+		it("fails for keys that can't be extracted", func() {
+			for _, key := range []extract.Key{
+				{Path: "/instance_groups/0/jobs/0/properties/missing"},
+				{Path: "/instance_groups/1"},
+				{Path: "/instance_groups/0/jobs/0/properties/hosts"},
+				{Path: "//"},
+			} {
+				_, err := extract.NewPlan([]byte(manifest), []extract.Key{key}, "/concourse/main")
+				Expect(err).To(HaveOccurred(), key.Path)
+			}
+
+			_, err := extract.NewPlan([]byte(manifest), []extract.Key{{Path: "/name", Name: "x"}, {Path: "/instance_groups/0/name", Name: "x"}}, "/concourse/main")
+			Expect(err).To(MatchError("/name and /instance_groups/0/name would both be stored as x"))
+
+			_, err = extract.NewPlan([]byte("a: ((b))"), []extract.Key{{Path: "/a"}}, "/concourse/main")
+			Expect(err).To(MatchError("/a is already a placeholder"))
+		})
+
+		it("fails for numbers and booleans, which would become strings", func() {
+			_, err := extract.NewPlan([]byte(manifest), []extract.Key{{Path: "/instance_groups/0/jobs/0/properties/db/port"}}, "/concourse/main")
+			Expect(err).To(MatchError(ContainSubstring("/instance_groups/0/jobs/0/properties/db/port: int values can not be stored as credentials")))
+
+			_, err = extract.NewPlan([]byte("enabled: true"), []extract.Key{{Path: "/enabled"}}, "/concourse/main")
+			Expect(err).To(MatchError(ContainSubstring("/enabled: bool values can not be stored as credentials")))
+
+			plan, err := extract.NewPlan([]byte(`port: "5432"`), []extract.Key{{Path: "/port"}}, "/concourse/main")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Changes[0].Credential.Value).To(Equal("5432"))
+		})
+
+		it("stores values under keys that name secrets as passwords", func() {
+			types := map[string]credhub.CredentialType{
+				"password":       credhub.Password,
+				"db_password":    credhub.Password,
+				"DB_PASSWORD":    credhub.Password,
+				"client-secret":  credhub.Password,
+				"api_key":        credhub.Password,
+				"apiKey":         credhub.Password,
+				"tokens":         credhub.Password,
+				"keepalive":      credhub.Value,
+				"monkey":         credhub.Value,
+				"key_count":      credhub.Value,
+				"passthrough":    credhub.Value,
+				"token_endpoint": credhub.Value,
+			}
+
+			for key, credType := range types {
+				plan, err := extract.NewPlan([]byte(key+": x"), []extract.Key{{Path: "/" + key}}, "/concourse/main")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(plan.Changes[0].Credential.Type).To(Equal(credType), key)
+			}
+		})
+	})
+
+	when("applying a plan", func() {
+		it("stores the credentials so the document can be interpolated back", func() {
+			fake := credhubtest.NewFakeClient(credhubtest.Version1)
+
+			keys := []extract.Key{
+				{Path: "/instance_groups/0/jobs/0/properties/db/password"},
+				{Path: "/instance_groups/0/jobs/0/properties/ca_cert", Name: "ca"},
+				{Path: "/instance_groups/0/jobs/0/properties/tls", Name: "tls"},
+				{Path: "/instance_groups/0/jobs/0/properties/settings", Name: "settings"},
+			}
+
+			plan, err := extract.NewPlan([]byte(manifest), keys, "/concourse/main")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Apply(fake)).To(Succeed())
+
+			cred, err := fake.GetLatestByName("/concourse/main/instance_groups_0_jobs_0_properties_db_password")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Value).To(Equal("hunter2"))
+
+			// applying again doesn't create new versions
+			Expect(plan.Apply(fake)).To(Succeed())
+			creds, err := fake.GetAllByName("/concourse/main/tls")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(HaveLen(1))
+
+			restored, err := interpolate.New(fake, "/concourse/main").YAML(plan.Document)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(MatchYAML(manifest))
+		})
+
+		it("fails if a credential wasn't stored", func() {
+			fake := credhubtest.NewFakeClient(credhubtest.Version1)
+
+			plan, err := extract.NewPlan([]byte(manifest), []extract.Key{{Path: "/instance_groups/0/jobs/0/properties/db/password", Name: "db"}}, "/concourse/main")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Apply(emptySetAPI{fake})).To(MatchError("unable to store /instance_groups/0/jobs/0/properties/db/password as /concourse/main/db: the server did not return the stored credential"))
+		})
+	})
+}
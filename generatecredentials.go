@@ -34,6 +34,10 @@ func (c *Client) Generate(name string, credentialType CredentialType, parameters
 	}
 	defer resp.Body.Close()
 
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
+
 	cred := new(Credential)
 	unmarshaller := json.NewDecoder(resp.Body)
 	err = unmarshaller.Decode(cred)
@@ -70,6 +74,10 @@ func (c *Client) Regenerate(name string) (*Credential, error) {
 	}
 	defer resp.Body.Close()
 
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
+
 	cred := new(Credential)
 	unmarshaller := json.NewDecoder(resp.Body)
 	err = unmarshaller.Decode(cred)
@@ -88,6 +88,30 @@ func testGenerateCredentials(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("the server refuses the write", func() {
+			it.Before(func() {
+				var err error
+				chClient, err = credhub.New(server.URL+"/forbidden", getAuthenticatedClient(server.Client()))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			when("Generating credentials", func() {
+				it("fails", func() {
+					cred, err := chClient.Generate("/example-generated", credhub.Password, map[string]interface{}{"length": 30})
+					Expect(err).To(MatchError(HavePrefix("expected a 2xx response, got 403 Forbidden")))
+					Expect(cred).To(BeNil())
+				})
+			})
+
+			when("Regenerating credentials", func() {
+				it("fails", func() {
+					cred, err := chClient.Regenerate("/example-password")
+					Expect(err).To(MatchError(HavePrefix("expected a 2xx response, got 403 Forbidden")))
+					Expect(cred).To(BeNil())
+				})
+			})
+		})
+
 		when("generating a credential with invalid params", func() {
 			it("fails", func() {
 				badParams := map[string]interface{}{
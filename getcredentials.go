@@ -10,6 +10,32 @@ import (
 	"strings"
 )
 
+// ErrNotFound is returned when a credential doesn't exist. The errors returned
+// by the lookups by name have a different message, but errors.Is reports them
+// as ErrNotFound.
+var ErrNotFound = errors.New("credential not found")
+
+// errNameNotFound is returned when no credential has a name
+var errNameNotFound = NewNotFoundError("Name Not Found")
+
+// NewNotFoundError returns an error with its own message, which errors.Is
+// reports as ErrNotFound. It is for implementations of API, so that they can
+// report missing credentials the same way as Client.
+func NewNotFoundError(message string) error {
+	return notFoundError(message)
+}
+
+// notFoundError is a not found error with its own message
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
 // GetByID will look up a credental by its ID. Since each version of a named
 // credential has a different ID, this will always return at most one value.
 func (c *Client) GetByID(id string) (*Credential, error) {
@@ -20,7 +46,7 @@ func (c *Client) GetByID(id string) (*Credential, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 404 {
-		return nil, errors.New("credential not found")
+		return nil, ErrNotFound
 	}
 
 	marshaller := json.NewDecoder(resp.Body)
@@ -82,7 +108,7 @@ func (c *Client) getByName(name string, latest bool, numVersions int) ([]Credent
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, errors.New("Name Not Found")
+		return nil, errNameNotFound
 	}
 
 	if resp.StatusCode != http.StatusOK {
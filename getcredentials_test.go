@@ -1,6 +1,7 @@
 package credhub_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -151,7 +152,8 @@ func testGetCredentials(t *testing.T, when spec.G, it spec.S) {
 
 	getNonexistentName := func() {
 		_, err := chClient.GetAllByName("/concourse/common/not-real")
-		Expect(err).To(HaveOccurred())
+		Expect(err).To(MatchError("Name Not Found"))
+		Expect(errors.Is(err, credhub.ErrNotFound)).To(BeTrue())
 	}
 
 	getCertificateByName := func() {
@@ -196,7 +198,7 @@ func testGetCredentials(t *testing.T, when spec.G, it spec.S) {
 			Expect(cred.Name).To(BeEquivalentTo("/by-id"))
 
 			badcred, err := chClient.GetByID("4567")
-			Expect(err).To(HaveOccurred())
+			Expect(err).To(Equal(credhub.ErrNotFound))
 			Expect(badcred).To(BeNil())
 		})
 	})
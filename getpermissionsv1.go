@@ -2,7 +2,6 @@ package credhub
 
 import (
 	"encoding/json"
-	"errors"
 	"net/url"
 )
 
@@ -20,7 +19,7 @@ func (c *Client) GetPermissions(credentialName string) ([]Permission, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 404 {
-		return nil, errors.New("credential not found")
+		return nil, ErrNotFound
 	}
 
 	retBody := struct {
@@ -1,6 +1,10 @@
 package credhub
 
-import "net/http"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
 
 // HTTPClient is an interface that http.Client conforms to, and is useful for
 // mocking purposes.
@@ -8,3 +12,20 @@ type HTTPClient interface {
 	Get(url string) (resp *http.Response, err error)
 	Do(req *http.Request) (*http.Response, error)
 }
+
+// checkStatus returns an error if a response isn't a 2xx, with the reason
+// Credhub gave if there is one
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error != "" {
+		return fmt.Errorf("expected a 2xx response, got %d %s: %s", resp.StatusCode, http.StatusText(resp.StatusCode), body.Error)
+	}
+
+	return fmt.Errorf("expected a 2xx response, got %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+}
@@ -0,0 +1,100 @@
+package credhub
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// InstanceIdentity is the identity of a Cloud Foundry app instance, as encoded
+// in the organizational units of its instance identity certificate
+type InstanceIdentity struct {
+	AppGUID   string
+	SpaceGUID string
+	OrgGUID   string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Actor returns the Credhub actor that the app authenticates as when using
+// its instance identity certificate
+func (i *InstanceIdentity) Actor() string {
+	return AppActor(i.AppGUID)
+}
+
+// AppActor returns the Credhub actor for the CF app with the given GUID, which
+// is useful for granting an app permissions on a credential
+func AppActor(appGUID string) string {
+	return "mtls-app:" + appGUID
+}
+
+// LoadInstanceIdentity reads the instance identity certificate that Cloud
+// Foundry provides in CF_INSTANCE_CERT. See ParseInstanceIdentity.
+func LoadInstanceIdentity() (*InstanceIdentity, error) {
+	path := os.Getenv("CF_INSTANCE_CERT")
+	if path == "" {
+		return nil, errors.New("CF_INSTANCE_CERT is not set")
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseInstanceIdentity(buf)
+}
+
+// ParseInstanceIdentity parses a PEM encoded CF instance identity certificate,
+// such as the one that CFAppAuthClient authenticates with. If the PEM contains
+// a chain, the first certificate is used. An error is returned if the
+// certificate has expired or is not yet valid.
+func ParseInstanceIdentity(certPEM []byte) (*InstanceIdentity, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return instanceIdentity(cert, time.Now())
+}
+
+func instanceIdentity(cert *x509.Certificate, now time.Time) (*InstanceIdentity, error) {
+	identity := &InstanceIdentity{
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		switch {
+		case strings.HasPrefix(ou, "app:"):
+			identity.AppGUID = strings.TrimPrefix(ou, "app:")
+		case strings.HasPrefix(ou, "space:"):
+			identity.SpaceGUID = strings.TrimPrefix(ou, "space:")
+		case strings.HasPrefix(ou, "organization:"):
+			identity.OrgGUID = strings.TrimPrefix(ou, "organization:")
+		}
+	}
+
+	if identity.AppGUID == "" {
+		return nil, errors.New("instance identity certificate does not contain an app GUID")
+	}
+
+	if now.Before(cert.NotBefore) {
+		return nil, fmt.Errorf("instance identity certificate is not valid until %s", cert.NotBefore.Format(time.RFC3339))
+	}
+
+	if now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("instance identity certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	return identity, nil
+}
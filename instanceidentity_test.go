@@ -0,0 +1,109 @@
+package credhub_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	. "github.com/onsi/gomega"
+)
+
+func TestInstanceIdentity(t *testing.T) {
+	spec.Run(t, "InstanceIdentity", testInstanceIdentity, spec.Report(report.Terminal{}))
+}
+
+func testInstanceIdentity(t *testing.T, when spec.G, it spec.S) {
+	var ous []string
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		ous = []string{
+			"organization:0c8bd1b1-5c5e-4d1e-9a59-1f7d0a0e6d1a",
+			"space:7e1b2c3d-4e5f-4a6b-8c9d-0e1f2a3b4c5d",
+			"app:a7070559-6be0-4ffc-ad5d-7f7abe5f2a80",
+		}
+	})
+
+	when("parsing a valid certificate", func() {
+		it("returns the GUIDs and actor", func() {
+			cert, _ := instanceIdentityCert(ous, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+			identity, err := credhub.ParseInstanceIdentity(cert)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identity.OrgGUID).To(Equal("0c8bd1b1-5c5e-4d1e-9a59-1f7d0a0e6d1a"))
+			Expect(identity.SpaceGUID).To(Equal("7e1b2c3d-4e5f-4a6b-8c9d-0e1f2a3b4c5d"))
+			Expect(identity.AppGUID).To(Equal("a7070559-6be0-4ffc-ad5d-7f7abe5f2a80"))
+			Expect(identity.Actor()).To(Equal("mtls-app:a7070559-6be0-4ffc-ad5d-7f7abe5f2a80"))
+		})
+
+		it("uses the first certificate of a chain", func() {
+			cert, _ := instanceIdentityCert(ous, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+			intermediate, _ := instanceIdentityCert(nil, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+			identity, err := credhub.ParseInstanceIdentity(append(cert, intermediate...))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identity.AppGUID).To(Equal("a7070559-6be0-4ffc-ad5d-7f7abe5f2a80"))
+		})
+
+		it("loads the certificate from CF_INSTANCE_CERT", func() {
+			cert, _ := instanceIdentityCert(ous, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+			f, err := ioutil.TempFile("", "instance-cert")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(f.Name())
+			f.Write(cert)
+			f.Close()
+
+			os.Setenv("CF_INSTANCE_CERT", f.Name())
+			defer os.Unsetenv("CF_INSTANCE_CERT")
+
+			identity, err := credhub.LoadInstanceIdentity()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identity.SpaceGUID).To(Equal("7e1b2c3d-4e5f-4a6b-8c9d-0e1f2a3b4c5d"))
+		})
+	})
+
+	when("the certificate is outside its validity window", func() {
+		it("fails when it has expired", func() {
+			cert, _ := instanceIdentityCert(ous, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+
+			_, err := credhub.ParseInstanceIdentity(cert)
+			Expect(err).To(MatchError(ContainSubstring("expired")))
+		})
+
+		it("fails when it is not yet valid", func() {
+			cert, _ := instanceIdentityCert(ous, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+
+			_, err := credhub.ParseInstanceIdentity(cert)
+			Expect(err).To(MatchError(ContainSubstring("not valid until")))
+		})
+	})
+
+	when("the input is not an instance identity certificate", func() {
+		it("fails without an app GUID", func() {
+			cert, _ := instanceIdentityCert([]string{"space:7e1b2c3d-4e5f-4a6b-8c9d-0e1f2a3b4c5d"}, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+
+			_, err := credhub.ParseInstanceIdentity(cert)
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails without a certificate", func() {
+			_, err := credhub.ParseInstanceIdentity([]byte("not a certificate"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails without CF_INSTANCE_CERT", func() {
+			os.Unsetenv("CF_INSTANCE_CERT")
+			_, err := credhub.LoadInstanceIdentity()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	it("builds actors for other apps", func() {
+		Expect(credhub.AppActor("some-guid")).To(Equal("mtls-app:some-guid"))
+	})
+}
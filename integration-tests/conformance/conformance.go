@@ -0,0 +1,373 @@
+/*
+Package conformance is a test suite that exercises every operation of
+credhub.API, and checks that the results match the behaviour of a real Credhub.
+
+It can be run against any implementation of credhub.API, so it is used both to
+check that the fakes in the credhubtest package behave like Credhub, and to
+check that a real Credhub (e.g. after a server upgrade) still works with the
+client:
+
+	func TestConformance(t *testing.T) {
+		client, err := credhub.NewFromEnvironment()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conformance.Run(t, client, "/conformance")
+	}
+
+*/
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	. "github.com/onsi/gomega"
+)
+
+/*
+
+Run runs the conformance suite against client. Every credential the suite
+creates is named under prefix, which should be a path that holds no other
+credentials (e.g. "/conformance"), since everything under it is deleted after
+each test.
+
+Behaviour that differs between Credhub versions (overwrite modes and v1
+permissions) is only checked when client.IsV1API() is true.
+
+*/
+func Run(t *testing.T, client credhub.API, prefix string) {
+	prefix = "/" + strings.Trim(prefix, "/")
+
+	spec.Run(t, "Conformance", func(t *testing.T, when spec.G, it spec.S) {
+		testConformance(t, when, it, client, prefix)
+	}, spec.Report(report.Terminal{}))
+}
+
+func testConformance(t *testing.T, when spec.G, it spec.S, client credhub.API, prefix string) {
+	name := func(suffix string) string {
+		return prefix + "/" + suffix
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	it.After(func() {
+		creds, err := client.FindByPath(prefix)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, cred := range creds {
+			Expect(client.Delete(cred.Name)).To(Succeed())
+		}
+	})
+
+	set := func(cred credhub.Credential) *credhub.Credential {
+		stored, err := client.Set(cred, credhub.Overwrite, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.ID).NotTo(BeEmpty())
+		Expect(stored.Name).To(Equal(cred.Name))
+		Expect(stored.Type).To(Equal(cred.Type))
+		return stored
+	}
+
+	it("identifies the client", func() {
+		actor, err := client.WhoAmI()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actor).To(MatchRegexp(`^[a-z-]+:.+$`))
+	})
+
+	when("setting and getting credentials", func() {
+		it("round-trips every settable type", func() {
+			creds := []credhub.Credential{
+				{Name: name("value"), Type: credhub.Value, Value: "some value"},
+				{Name: name("password"), Type: credhub.Password, Value: "some password"},
+				{Name: name("json"), Type: credhub.JSON, Value: map[string]interface{}{"key": "value", "nested": map[string]interface{}{"list": []interface{}{"a", "b"}}}},
+				{Name: name("user"), Type: credhub.User, Value: map[string]interface{}{"username": "someone", "password": "some password"}},
+			}
+
+			for _, cred := range creds {
+				stored := set(cred)
+
+				latest, err := client.GetLatestByName(cred.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(latest.ID).To(Equal(stored.ID))
+				Expect(latest.Type).To(Equal(cred.Type))
+
+				if cred.Type == credhub.User {
+					user, err := credhub.UserValue(*latest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(user.Username).To(Equal("someone"))
+					Expect(user.Password).To(Equal("some password"))
+					Expect(user.PasswordHash).NotTo(BeEmpty())
+					continue
+				}
+
+				expected, _ := json.Marshal(cred.Value)
+				actual, _ := json.Marshal(latest.Value)
+				Expect(actual).To(MatchJSON(expected), string(cred.Type))
+			}
+		})
+
+		it("gets credentials by ID", func() {
+			stored := set(credhub.Credential{Name: name("by-id"), Type: credhub.Value, Value: "v1"})
+
+			cred, err := client.GetByID(stored.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Name).To(Equal(stored.Name))
+			Expect(cred.Value).To(Equal("v1"))
+
+			_, err = client.GetByID("00000000-0000-0000-0000-000000000000")
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("keeps every version, newest first", func() {
+			for i := 1; i <= 3; i++ {
+				set(credhub.Credential{Name: name("versions"), Type: credhub.Value, Value: fmt.Sprintf("v%d", i)})
+				// versions are ordered by their creation time
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			all, err := client.GetAllByName(name("versions"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(all).To(HaveLen(3))
+			Expect(all[0].Value).To(Equal("v3"))
+			Expect(all[2].Value).To(Equal("v1"))
+
+			some, err := client.GetVersionsByName(name("versions"), 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(some).To(HaveLen(2))
+			Expect(some[0].Value).To(Equal("v3"))
+			Expect(some[1].Value).To(Equal("v2"))
+
+			latest, err := client.GetLatestByName(name("versions"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(latest.Value).To(Equal("v3"))
+		})
+
+		it("fails to get credentials that do not exist", func() {
+			_, err := client.GetLatestByName(name("missing"))
+			Expect(err).To(HaveOccurred())
+
+			_, err = client.GetAllByName(name("missing"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("honours overwrite modes on v1 servers", func() {
+			if !client.IsV1API() {
+				return
+			}
+
+			first := set(credhub.Credential{Name: name("modes"), Type: credhub.Value, Value: "first"})
+
+			kept, err := client.Set(credhub.Credential{Name: name("modes"), Type: credhub.Value, Value: "second"}, credhub.NoOverwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kept.ID).To(Equal(first.ID))
+			Expect(kept.Value).To(Equal("first"))
+
+			converged, err := client.Set(credhub.Credential{Name: name("modes"), Type: credhub.Value, Value: "first"}, credhub.Converge, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(converged.ID).To(Equal(first.ID))
+
+			changed, err := client.Set(credhub.Credential{Name: name("modes"), Type: credhub.Value, Value: "second"}, credhub.Converge, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed.ID).NotTo(Equal(first.ID))
+			Expect(changed.Value).To(Equal("second"))
+		})
+
+		it("always overwrites on v2 servers", func() {
+			if client.IsV1API() {
+				return
+			}
+
+			first := set(credhub.Credential{Name: name("modes"), Type: credhub.Value, Value: "first"})
+
+			second, err := client.Set(credhub.Credential{Name: name("modes"), Type: credhub.Value, Value: "first"}, credhub.NoOverwrite, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second.ID).NotTo(Equal(first.ID))
+		})
+	})
+
+	when("generating credentials", func() {
+		it("generates every generatable type", func() {
+			password, err := client.Generate(name("gen-password"), credhub.Password, map[string]interface{}{"length": 40})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(password.Value).To(HaveLen(40))
+
+			userCred, err := client.Generate(name("gen-user"), credhub.User, map[string]interface{}{"username": "generated"})
+			Expect(err).NotTo(HaveOccurred())
+			user, err := credhub.UserValue(*userCred)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(user.Username).To(Equal("generated"))
+			Expect(user.Password).NotTo(BeEmpty())
+
+			rsaCred, err := client.Generate(name("gen-rsa"), credhub.RSA, map[string]interface{}{})
+			Expect(err).NotTo(HaveOccurred())
+			rsa, err := credhub.RSAValue(*rsaCred)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rsa.PrivateKey).To(ContainSubstring("PRIVATE KEY"))
+			Expect(rsa.PublicKey).To(ContainSubstring("PUBLIC KEY"))
+
+			sshCred, err := client.Generate(name("gen-ssh"), credhub.SSH, map[string]interface{}{})
+			Expect(err).NotTo(HaveOccurred())
+			ssh, err := credhub.SSHValue(*sshCred)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ssh.PublicKey).To(HavePrefix("ssh-rsa "))
+			Expect(ssh.PublicKeyFingerprint).NotTo(BeEmpty())
+
+			caCred, err := client.Generate(name("gen-ca"), credhub.Certificate, map[string]interface{}{"is_ca": true, "common_name": "conformance-ca"})
+			Expect(err).NotTo(HaveOccurred())
+			ca, err := credhub.CertificateValue(*caCred)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ca.Certificate).To(ContainSubstring("BEGIN CERTIFICATE"))
+
+			certCred, err := client.Generate(name("gen-cert"), credhub.Certificate, map[string]interface{}{"ca": name("gen-ca"), "common_name": "conformance"})
+			Expect(err).NotTo(HaveOccurred())
+			cert, err := credhub.CertificateValue(*certCred)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cert.CA).To(Equal(ca.Certificate))
+			Expect(cert.PrivateKey).To(ContainSubstring("PRIVATE KEY"))
+		})
+
+		it("does not regenerate credentials with the same parameters", func() {
+			first, err := client.Generate(name("gen-same"), credhub.Password, map[string]interface{}{})
+			Expect(err).NotTo(HaveOccurred())
+
+			second, err := client.Generate(name("gen-same"), credhub.Password, map[string]interface{}{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second.ID).To(Equal(first.ID))
+			Expect(second.Value).To(Equal(first.Value))
+		})
+
+		it("regenerates credentials with their stored parameters", func() {
+			first, err := client.Generate(name("regen"), credhub.Password, map[string]interface{}{"length": 24})
+			Expect(err).NotTo(HaveOccurred())
+
+			regenerated, err := client.Regenerate(name("regen"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(regenerated.ID).NotTo(Equal(first.ID))
+			Expect(regenerated.Value).To(HaveLen(24))
+			Expect(regenerated.Value).NotTo(Equal(first.Value))
+		})
+	})
+
+	when("deleting credentials", func() {
+		it("deletes every version", func() {
+			set(credhub.Credential{Name: name("delete-me"), Type: credhub.Value, Value: "v1"})
+			set(credhub.Credential{Name: name("delete-me"), Type: credhub.Value, Value: "v2"})
+
+			Expect(client.Delete(name("delete-me"))).To(Succeed())
+
+			_, err := client.GetAllByName(name("delete-me"))
+			Expect(err).To(HaveOccurred())
+
+			Expect(client.Delete(name("delete-me"))).NotTo(Succeed())
+		})
+	})
+
+	when("finding credentials", func() {
+		it.Before(func() {
+			set(credhub.Credential{Name: name("find/one"), Type: credhub.Value, Value: "1"})
+			set(credhub.Credential{Name: name("find/nested/two"), Type: credhub.Value, Value: "2"})
+			set(credhub.Credential{Name: name("elsewhere-conformance-needle"), Type: credhub.Value, Value: "3"})
+		})
+
+		it("finds credentials by path", func() {
+			creds, err := client.FindByPath(name("find"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, cred := range creds {
+				names = append(names, cred.Name)
+			}
+			Expect(names).To(ConsistOf(name("find/one"), name("find/nested/two")))
+		})
+
+		it("finds credentials by partial name", func() {
+			creds, err := client.FindByPartialName("conformance-needle")
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, cred := range creds {
+				names = append(names, cred.Name)
+			}
+			Expect(names).To(ContainElement(name("elsewhere-conformance-needle")))
+			Expect(names).NotTo(ContainElement(name("find/one")))
+		})
+
+		it("lists paths on v1 servers", func() {
+			if !client.IsV1API() {
+				return
+			}
+
+			paths, err := client.ListAllPaths()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths).To(ContainElement(name("find/")))
+			Expect(paths).To(ContainElement(name("find/nested/")))
+		})
+	})
+
+	when("managing permissions on v1 servers", func() {
+		it("adds, gets and deletes permissions", func() {
+			if !client.IsV1API() {
+				return
+			}
+
+			set(credhub.Credential{Name: name("permissions"), Type: credhub.Value, Value: "v"})
+
+			actor := "mtls-app:conformance-app"
+			perms, err := client.AddPermissions(name("permissions"), []credhub.Permission{
+				{Actor: actor, Operations: []credhub.Operation{credhub.Read, credhub.Write}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(ContainElement(credhub.Permission{Actor: actor, Operations: []credhub.Operation{credhub.Read, credhub.Write}}))
+
+			perms, err = client.GetPermissions(name("permissions"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(ContainElement(credhub.Permission{Actor: actor, Operations: []credhub.Operation{credhub.Read, credhub.Write}}))
+
+			Expect(client.DeletePermissions(name("permissions"), actor)).To(Succeed())
+
+			perms, err = client.GetPermissions(name("permissions"))
+			Expect(err).NotTo(HaveOccurred())
+			for _, perm := range perms {
+				Expect(perm.Actor).NotTo(Equal(actor))
+			}
+		})
+
+		it("grants additional permissions when setting", func() {
+			if !client.IsV1API() {
+				return
+			}
+
+			actor := "mtls-app:conformance-set"
+			_, err := client.Set(credhub.Credential{Name: name("set-permissions"), Type: credhub.Value, Value: "v"}, credhub.Overwrite, []credhub.Permission{
+				{Actor: actor, Operations: []credhub.Operation{credhub.Read}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			perms, err := client.GetPermissions(name("set-permissions"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(perms).To(ContainElement(credhub.Permission{Actor: actor, Operations: []credhub.Operation{credhub.Read}}))
+		})
+	})
+
+	when("interpolating VCAP_SERVICES", func() {
+		it("replaces credhub-refs with credential values", func() {
+			set(credhub.Credential{Name: name("service"), Type: credhub.JSON, Value: map[string]interface{}{"uri": "mysql://db"}})
+
+			vcap := fmt.Sprintf(`{"p-mysql":[{"name":"db","credentials":{"credhub-ref":%q}},{"name":"plain","credentials":{"uri":"unchanged"}}]}`, name("service"))
+			out, err := client.InterpolateCredentials(vcap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchJSON(`{"p-mysql":[{"name":"db","credentials":{"uri":"mysql://db"}},{"name":"plain","credentials":{"uri":"unchanged"}}]}`))
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package conformance_test
+
+import (
+	"os"
+	"testing"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	"github.com/cloudfoundry-community/go-credhub/integration-tests/conformance"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+func TestFakeServer(t *testing.T) {
+	for _, version := range []string{credhubtest.Version1, credhubtest.Version2} {
+		t.Run(version, func(t *testing.T) {
+			server := credhubtest.NewServer(version)
+			defer server.Close()
+
+			client, err := server.NewClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conformance.Run(t, client, "/conformance")
+		})
+	}
+}
+
+func TestFakeClient(t *testing.T) {
+	for _, version := range []string{credhubtest.Version1, credhubtest.Version2} {
+		t.Run(version, func(t *testing.T) {
+			conformance.Run(t, credhubtest.NewFakeClient(version), "/conformance")
+		})
+	}
+}
+
+// TestCredhub runs the suite against the Credhub configured by the same
+// environment variables as the credhub CLI, if there is one
+func TestCredhub(t *testing.T) {
+	if os.Getenv("CREDHUB_SERVER") == "" && os.Getenv("CREDHUB_API") == "" {
+		t.Skip("CREDHUB_SERVER is not set")
+	}
+
+	client, err := credhub.NewFromEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conformance.Run(t, client, "/go-credhub-conformance/"+id.String())
+}
@@ -0,0 +1,61 @@
+// Package yamljson converts values decoded from YAML into values that can be
+// sent to Credhub as JSON.
+package yamljson
+
+import (
+	"fmt"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Convert converts the maps decoded from YAML, which can have keys of any
+// type, into maps with string keys, recursively. It returns an error if a key
+// is not a string.
+func Convert(value interface{}) (interface{}, error) {
+	switch t := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for key, item := range t {
+			if err := set(m, key, item); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(t))
+		for _, item := range t {
+			if err := set(m, item.Key, item.Value); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, item := range t {
+			v, err := Convert(item)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		return s, nil
+	default:
+		return t, nil
+	}
+}
+
+// set converts an item of a YAML map, and adds it to m
+func set(m map[string]interface{}, key, item interface{}) error {
+	s, ok := key.(string)
+	if !ok {
+		return fmt.Errorf("key %v is not a string", key)
+	}
+
+	v, err := Convert(item)
+	if err != nil {
+		return err
+	}
+
+	m[s] = v
+	return nil
+}
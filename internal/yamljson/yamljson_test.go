@@ -0,0 +1,46 @@
+package yamljson_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/cloudfoundry-community/go-credhub/internal/yamljson"
+	. "github.com/onsi/gomega"
+)
+
+func TestYAMLJSON(t *testing.T) {
+	spec.Run(t, "YAMLJSON", testYAMLJSON, spec.Report(report.Terminal{}))
+}
+
+func testYAMLJSON(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	it("converts maps and ordered maps", func() {
+		doc := "hosts: [a, {name: b}]\nnested:\n  retries: 3\n"
+		expected := map[string]interface{}{
+			"hosts":  []interface{}{"a", map[string]interface{}{"name": "b"}},
+			"nested": map[string]interface{}{"retries": 3},
+		}
+
+		var m map[interface{}]interface{}
+		Expect(yaml.Unmarshal([]byte(doc), &m)).To(Succeed())
+		Expect(yamljson.Convert(m)).To(Equal(expected))
+
+		var ms yaml.MapSlice
+		Expect(yaml.Unmarshal([]byte(doc), &ms)).To(Succeed())
+		Expect(yamljson.Convert(ms)).To(Equal(expected))
+	})
+
+	it("rejects keys that aren't strings", func() {
+		var m map[interface{}]interface{}
+		Expect(yaml.Unmarshal([]byte("nested: {1: x}"), &m)).To(Succeed())
+
+		_, err := yamljson.Convert(m)
+		Expect(err).To(MatchError("key 1 is not a string"))
+	})
+}
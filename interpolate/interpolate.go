@@ -0,0 +1,306 @@
+/*
+Package interpolate resolves BOSH and Concourse style ((variable)) placeholders
+in YAML, JSON and plain text documents with credentials from Credhub.
+
+A placeholder names a credential, optionally followed by fields to select from
+its value, separated by dots:
+
+	password: ((db_password))
+	username: ((db_user.username))
+	ca:       ((/bosh/director/ssl.ca))
+
+Names that don't start with "/" are relative to the Interpolator's prefix.
+
+In YAML and JSON documents, a string that consists only of a placeholder is
+replaced by the credential's value, whatever its type. Placeholders within a
+longer string (and every placeholder in plain text) must resolve to a string,
+number or boolean.
+
+*/
+package interpolate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// variablePattern matches the variable in a placeholder: a credential name and
+// the fields to select from it
+const variablePattern = `[-/\.\w\pL]+`
+
+var (
+	placeholderRegexp = regexp.MustCompile(`\(\(\s*(` + variablePattern + `)\s*\)\)`)
+	variableRegexp    = regexp.MustCompile(`^` + variablePattern + `$`)
+)
+
+// IsVariable reports whether name can be used as the variable of a
+// placeholder, e.g. "db.password" for ((db.password))
+func IsVariable(name string) bool {
+	return variableRegexp.MatchString(name)
+}
+
+// MissingVariablesError is returned when placeholders refer to credentials, or
+// fields of credentials, that do not exist. Every missing variable in the
+// document is reported.
+type MissingVariablesError struct {
+	// Names are the missing variables, as they were written in the document
+	Names []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return "Expected to find variables: " + strings.Join(e.Names, ", ")
+}
+
+// Interpolator resolves placeholders with credentials from Credhub
+type Interpolator struct {
+	client credhub.API
+	prefix string
+}
+
+// New creates an Interpolator that looks credentials up with client. Relative
+// names are looked up under prefix (e.g. "/concourse/main"), or under "/" if
+// prefix is empty.
+func New(client credhub.API, prefix string) *Interpolator {
+	return &Interpolator{
+		client: client,
+		prefix: "/" + strings.Trim(prefix, "/"),
+	}
+}
+
+// YAML interpolates a YAML document, preserving the order of its keys
+func (i *Interpolator) YAML(doc []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(doc, &v); err != nil {
+		return nil, err
+	}
+
+	// decode maps into MapSlices, so that the order of the keys is kept
+	if _, ok := v.(map[interface{}]interface{}); ok {
+		var ms yaml.MapSlice
+		if err := yaml.Unmarshal(doc, &ms); err != nil {
+			return nil, err
+		}
+		v = ms
+	}
+
+	interpolated, err := i.Value(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(interpolated)
+}
+
+// JSON interpolates a JSON document
+func (i *Interpolator) JSON(doc []byte) ([]byte, error) {
+	var v interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	interpolated, err := i.Value(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(interpolated)
+}
+
+// Text interpolates plain text, where every placeholder must resolve to a
+// string, number or boolean
+func (i *Interpolator) Text(text string) (string, error) {
+	r := i.newResolution()
+
+	out := placeholderRegexp.ReplaceAllStringFunc(text, r.embed)
+
+	if err := r.err(); err != nil {
+		return "", err
+	}
+
+	return out, nil
+}
+
+// Value interpolates a decoded YAML or JSON document, returning a copy of it
+// with every placeholder resolved
+func (i *Interpolator) Value(v interface{}) (interface{}, error) {
+	r := i.newResolution()
+
+	interpolated := r.walk(v)
+	if err := r.err(); err != nil {
+		return nil, err
+	}
+
+	return interpolated, nil
+}
+
+// resolution holds the state of interpolating a single document
+type resolution struct {
+	*Interpolator
+
+	// values caches the value of each credential, so that each is only
+	// looked up once
+	values map[string]interface{}
+
+	missing map[string]struct{}
+	errs    []error
+}
+
+func (i *Interpolator) newResolution() *resolution {
+	return &resolution{
+		Interpolator: i,
+		values:       make(map[string]interface{}),
+		missing:      make(map[string]struct{}),
+	}
+}
+
+func (r *resolution) err() error {
+	if len(r.errs) > 0 {
+		return r.errs[0]
+	}
+
+	if len(r.missing) > 0 {
+		names := make([]string, 0, len(r.missing))
+		for name := range r.missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return &MissingVariablesError{Names: names}
+	}
+
+	return nil
+}
+
+// credentialName returns the absolute name of a credential
+func (r *resolution) credentialName(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+
+	return strings.TrimSuffix(r.prefix, "/") + "/" + name
+}
+
+// resolve returns the value of a variable, recording it as missing if it does
+// not exist
+func (r *resolution) resolve(variable string) (interface{}, bool) {
+	parts := strings.Split(variable, ".")
+	name := r.credentialName(parts[0])
+
+	value, ok := r.values[name]
+	if !ok {
+		cred, err := r.client.GetLatestByName(name)
+		switch {
+		case errors.Is(err, credhub.ErrNotFound):
+			value = nil
+		case err != nil:
+			r.errs = append(r.errs, fmt.Errorf("unable to look up %s: %v", name, err))
+			return nil, false
+		default:
+			value = cred.Value
+		}
+		r.values[name] = value
+	}
+
+	if value == nil {
+		r.missing[variable] = struct{}{}
+		return nil, false
+	}
+
+	for _, field := range parts[1:] {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			r.missing[variable] = struct{}{}
+			return nil, false
+		}
+
+		if value, ok = obj[field]; !ok {
+			r.missing[variable] = struct{}{}
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// embed returns the value of a placeholder as a string, for use within a
+// longer string
+func (r *resolution) embed(placeholder string) string {
+	variable := placeholderRegexp.FindStringSubmatch(placeholder)[1]
+
+	value, ok := r.resolve(variable)
+	if !ok {
+		return placeholder
+	}
+
+	switch t := value.(type) {
+	case string:
+		return t
+	case json.Number, int, int64, uint64, float64, bool:
+		return fmt.Sprint(t)
+	default:
+		r.errs = append(r.errs, fmt.Errorf("expected variable %s to be a string, number or boolean, but it was %T", variable, value))
+		return placeholder
+	}
+}
+
+// walk returns a copy of v with every placeholder resolved
+func (r *resolution) walk(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if m := placeholderRegexp.FindStringSubmatchIndex(t); m != nil && m[0] == 0 && m[1] == len(t) {
+			value, ok := r.resolve(t[m[2]:m[3]])
+			if !ok {
+				return t
+			}
+			return value
+		}
+
+		return placeholderRegexp.ReplaceAllStringFunc(t, r.embed)
+	case yaml.MapSlice:
+		ms := make(yaml.MapSlice, len(t))
+		for i, item := range t {
+			ms[i] = yaml.MapItem{Key: r.walkKey(item.Key), Value: r.walk(item.Value)}
+		}
+		return ms
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(t))
+		for key, value := range t {
+			m[r.walkKey(key)] = r.walk(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			m[placeholderRegexp.ReplaceAllStringFunc(key, r.embed)] = r.walk(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			s[i] = r.walk(value)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// walkKey resolves the placeholders in a YAML map key, which must resolve to a
+// string
+func (r *resolution) walkKey(key interface{}) interface{} {
+	if s, ok := key.(string); ok {
+		return placeholderRegexp.ReplaceAllStringFunc(s, r.embed)
+	}
+	return key
+}
@@ -0,0 +1,160 @@
+package interpolate_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	"github.com/cloudfoundry-community/go-credhub/interpolate"
+	. "github.com/onsi/gomega"
+)
+
+func TestInterpolate(t *testing.T) {
+	spec.Run(t, "Interpolate", testInterpolate, spec.Report(report.Terminal{}))
+}
+
+// countingClient counts the lookups made through it
+type countingClient struct {
+	credhub.API
+	lookups map[string]int
+}
+
+func (c *countingClient) GetLatestByName(name string) (*credhub.Credential, error) {
+	c.lookups[name]++
+	return c.API.GetLatestByName(name)
+}
+
+func testInterpolate(t *testing.T, when spec.G, it spec.S) {
+	var (
+		client       *countingClient
+		interpolator *interpolate.Interpolator
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		fake := credhubtest.NewFakeClient(credhubtest.Version2)
+		fake.Seed(
+			credhub.Credential{Name: "/concourse/main/db_password", Type: credhub.Password, Value: "hunter2"},
+			credhub.Credential{Name: "/concourse/main/db_user", Type: credhub.User, Value: map[string]interface{}{"username": "admin", "password": "s3cret"}},
+			credhub.Credential{Name: "/concourse/main/config", Type: credhub.JSON, Value: map[string]interface{}{"port": 5432, "tls": map[string]interface{}{"enabled": true}}},
+			credhub.Credential{Name: "/bosh/ssl", Type: credhub.Certificate, Value: map[string]interface{}{"ca": "CA", "certificate": "CERT", "private_key": "KEY"}},
+		)
+
+		client = &countingClient{API: fake, lookups: make(map[string]int)}
+		interpolator = interpolate.New(client, "/concourse/main")
+	})
+
+	when("interpolating YAML", func() {
+		it("replaces placeholders and keeps the order of keys", func() {
+			doc := `
+zeta: ((db_password))
+alpha:
+  user: ((db_user.username))
+  url: postgres://((db_user.username)):((db_user.password))@db:((config.port))/app
+  tls: ((config.tls.enabled))
+  ssl: ((/bosh/ssl))
+list:
+- (( db_password ))
+- plain
+`
+
+			out, err := interpolator.YAML([]byte(doc))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal(`zeta: hunter2
+alpha:
+  user: admin
+  url: postgres://admin:s3cret@db:5432/app
+  tls: true
+  ssl:
+    ca: CA
+    certificate: CERT
+    private_key: KEY
+list:
+- hunter2
+- plain
+`))
+		})
+
+		it("looks up each credential once", func() {
+			_, err := interpolator.YAML([]byte("a: ((db_user.username))\nb: ((db_user.password))\nc: ((db_user))\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.lookups).To(Equal(map[string]int{"/concourse/main/db_user": 1}))
+		})
+
+		it("interpolates keys", func() {
+			out, err := interpolator.YAML([]byte("((db_user.username)): ((db_password))\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("admin: hunter2\n"))
+		})
+
+		it("fails on invalid YAML", func() {
+			_, err := interpolator.YAML([]byte("a: [b"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("interpolating JSON", func() {
+		it("replaces placeholders with values of any type", func() {
+			out, err := interpolator.JSON([]byte(`{"user": "((db_user))", "port": "((config.port))", "big": 12345678901234567890, "dsn": "((db_user.username))@db"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchJSON(`{"user": {"username": "admin", "password": "s3cret"}, "port": 5432, "big": 12345678901234567890, "dsn": "admin@db"}`))
+		})
+	})
+
+	when("interpolating text", func() {
+		it("replaces placeholders within the text", func() {
+			out, err := interpolator.Text("DB_PASSWORD=((db_password))\nDB_PORT=((config.port))\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal("DB_PASSWORD=hunter2\nDB_PORT=5432\n"))
+		})
+
+		it("fails for values that aren't strings, numbers or booleans", func() {
+			_, err := interpolator.Text("USER=((db_user))")
+			Expect(err).To(MatchError(ContainSubstring("expected variable db_user to be a string, number or boolean")))
+		})
+	})
+
+	when("using a prefix", func() {
+		it("defaults to the root", func() {
+			out, err := interpolate.New(client, "").Text("((bosh/ssl.ca))")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal("CA"))
+		})
+
+		it("ignores surrounding slashes", func() {
+			out, err := interpolate.New(client, "/concourse/main/").Text("((db_password))")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal("hunter2"))
+		})
+	})
+
+	when("variables are missing", func() {
+		it("reports all of them", func() {
+			doc := `
+a: ((missing))
+b: ((db_user.missing))
+c: ((db_password.field))
+d: prefix-((/also/missing))
+e: ((missing))
+`
+			out, err := interpolator.YAML([]byte(doc))
+			Expect(out).To(BeNil())
+			Expect(err).To(BeAssignableToTypeOf(&interpolate.MissingVariablesError{}))
+			Expect(err.(*interpolate.MissingVariablesError).Names).To(Equal([]string{"/also/missing", "db_password.field", "db_user.missing", "missing"}))
+			Expect(err).To(MatchError("Expected to find variables: /also/missing, db_password.field, db_user.missing, missing"))
+		})
+	})
+
+	it("recognizes variables", func() {
+		Expect(interpolate.IsVariable("db_user.username")).To(BeTrue())
+		Expect(interpolate.IsVariable("/bosh/director/ssl.ca")).To(BeTrue())
+		Expect(interpolate.IsVariable("")).To(BeFalse())
+		Expect(interpolate.IsVariable(" db")).To(BeFalse())
+		Expect(interpolate.IsVariable("db password")).To(BeFalse())
+		Expect(interpolate.IsVariable("db)")).To(BeFalse())
+	})
+}
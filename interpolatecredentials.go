@@ -1,38 +1,79 @@
 package credhub
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type vcapService map[string]interface{}
 
 // InterpolateCredentials will take a string representation of a VCAP_SERVICES
 // json variable, and interpolate any services whose credentials block consists
-// only of credhub-ref. It will return the interpolated JSON as a string
+// only of credhub-ref. It will return the interpolated JSON as a string.
+//
+// The credentials are interpolated by the server in a single request, unless
+// the server does not support it or rejects the request (Credhub only
+// interpolates json credentials), in which case each distinct credhub-ref is
+// looked up concurrently. If any refs can not be resolved, the error is an
+// *InterpolationError listing all of them.
 func (c *Client) InterpolateCredentials(vcapServices string) (string, error) {
 	var err error
 
-	type vcapService map[string]interface{}
-
 	services := make(map[string][]vcapService)
 	if err = json.Unmarshal([]byte(vcapServices), &services); err != nil {
 		return "", err
 	}
 
-	for serviceType := range services {
-		for i := range services[serviceType] {
-			credRefIntf := services[serviceType][i]["credentials"]
-			credRef, ok := credRefIntf.(map[string]interface{})
-			if ok && len(credRef) == 1 {
-				ref, ok := credRef["credhub-ref"]
-				if ok {
-					var resolvedCreds []Credential
-					credName := ref.(string)
-					resolvedCreds, err = c.getByName(credName, true, 1)
-					if err != nil {
-						return "", err
-					}
-
-					services[serviceType][i]["credentials"] = resolvedCreds[0].Value
-				}
-			}
+	names, refErrs := collectRefs(services)
+	if len(refErrs) > 0 {
+		// the server would reject the malformed refs, so look up the others
+		// here to report every problem at once
+		return "", c.interpolateServices(services)
+	}
+
+	if len(names) == 0 {
+		output, _ := json.Marshal(services)
+		return string(output), nil
+	}
+
+	buf, _ := json.Marshal(services)
+
+	req, err := http.NewRequest("POST", c.url+"/api/v1/interpolate", bytes.NewBuffer(buf))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		interpolated := make(map[string][]vcapService)
+		if err = json.NewDecoder(resp.Body).Decode(&interpolated); err != nil {
+			return "", err
+		}
+		services = interpolated
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusBadRequest:
+		// older servers don't have the interpolate endpoint. Newer ones also
+		// return 404 for a missing credential, which the fallback reports in
+		// the usual way, and 400 for refs to credentials that aren't json,
+		// which the fallback resolves.
+		if err = c.interpolateServices(services); err != nil {
+			return "", err
 		}
+	default:
+		return "", fmt.Errorf("expected return code 200, got %d", resp.StatusCode)
 	}
 
 	// can't really encounter an error here, since everything has come from
@@ -40,3 +81,138 @@ func (c *Client) InterpolateCredentials(vcapServices string) (string, error) {
 	output, _ := json.Marshal(services)
 	return string(output), nil
 }
+
+// interpolationConcurrency is the most credentials that are looked up at once
+// when interpolating without the server's help
+const interpolationConcurrency = 8
+
+// InterpolationError is returned when some credhub-refs could not be
+// resolved. Every ref that failed is reported, not just the first.
+type InterpolationError struct {
+	// Errors maps each credhub-ref that could not be resolved to the reason
+	// why. Refs that are not strings are formatted with %v.
+	Errors map[string]error
+}
+
+func (e *InterpolationError) Error() string {
+	refs := make([]string, 0, len(e.Errors))
+	for ref := range e.Errors {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	msgs := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", ref, e.Errors[ref]))
+	}
+
+	return "unable to resolve credhub-refs: " + strings.Join(msgs, "; ")
+}
+
+// collectRefs returns the distinct credential names referred to by services,
+// and an error for each credhub-ref that is not a name
+func collectRefs(services map[string][]vcapService) (map[string]struct{}, map[string]error) {
+	names := make(map[string]struct{})
+	refErrs := make(map[string]error)
+
+	for serviceType := range services {
+		for _, service := range services[serviceType] {
+			ref, ok := credhubRef(service)
+			if !ok {
+				continue
+			}
+
+			name, ok := ref.(string)
+			if !ok {
+				refErrs[fmt.Sprintf("%v", ref)] = errors.New("credhub-ref must be a string")
+				continue
+			}
+
+			names[name] = struct{}{}
+		}
+	}
+
+	return names, refErrs
+}
+
+// interpolateServices replaces the credhub-ref credentials of services by
+// looking up each distinct credential
+func (c *Client) interpolateServices(services map[string][]vcapService) error {
+	names, refErrs := collectRefs(services)
+
+	values := resolveRefs(c.latestValue, names, refErrs)
+	if len(refErrs) > 0 {
+		return &InterpolationError{Errors: refErrs}
+	}
+
+	for serviceType := range services {
+		for _, service := range services[serviceType] {
+			if ref, ok := credhubRef(service); ok {
+				service["credentials"] = values[ref.(string)]
+			}
+		}
+	}
+
+	return nil
+}
+
+// credhubRef returns the credhub-ref of a service whose credentials block
+// consists only of credhub-ref
+func credhubRef(service vcapService) (interface{}, bool) {
+	credRef, ok := service["credentials"].(map[string]interface{})
+	if !ok || len(credRef) != 1 {
+		return nil, false
+	}
+
+	ref, ok := credRef["credhub-ref"]
+	return ref, ok
+}
+
+// latestValue returns the value of the current version of a credential
+func (c *Client) latestValue(name string) (interface{}, error) {
+	creds, err := c.getByName(name, true, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(creds) == 0 {
+		return nil, errNameNotFound
+	}
+
+	return creds[0].Value, nil
+}
+
+// resolveRefs looks up the value of each named credential with lookup, at most
+// interpolationConcurrency at a time. Failed lookups are added to errs.
+func resolveRefs(lookup func(name string) (interface{}, error), names map[string]struct{}, errs map[string]error) map[string]interface{} {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, interpolationConcurrency)
+		values = make(map[string]interface{}, len(names))
+	)
+
+	for name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			value, err := lookup(name)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs[name] = err
+				return
+			}
+			values[name] = value
+		}(name)
+	}
+
+	wg.Wait()
+	return values
+}
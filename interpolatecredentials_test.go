@@ -2,8 +2,13 @@ package credhub_test
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
@@ -16,6 +21,57 @@ func TestInterpolateCredentials(t *testing.T) {
 	spec.Run(t, "InterpolateCredentials", testInterpolateCredentials, spec.Report(report.Terminal{}))
 }
 
+// pathRecordingClient records the method and path of every request
+type pathRecordingClient struct {
+	credhub.HTTPClient
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (c *pathRecordingClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *pathRecordingClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, req.Method+" "+req.URL.Path)
+	c.mu.Unlock()
+
+	return c.HTTPClient.Do(req)
+}
+
+// concurrencyCountingClient records the most GET requests in flight at once
+type concurrencyCountingClient struct {
+	credhub.HTTPClient
+
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (c *concurrencyCountingClient) Get(url string) (*http.Response, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.max {
+		c.max = c.inFlight
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	return c.HTTPClient.Get(url)
+}
+
 func testInterpolateCredentials(t *testing.T, when spec.G, it spec.S) {
 	var (
 		server   *httptest.Server
@@ -74,6 +130,109 @@ func testInterpolateCredentials(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("the server can interpolate credentials", func() {
+		var (
+			v2Server *httptest.Server
+			recorder *pathRecordingClient
+		)
+
+		vcapServices := `{"p-config-server":[{"credentials":{"credhub-ref":"/service-cred-ref"},"name":"config-server"}]}`
+
+		it.Before(func() {
+			var err error
+			v2Server = mockV2CredhubServer()
+			recorder = &pathRecordingClient{HTTPClient: getAuthenticatedClient(v2Server.Client())}
+			chClient, err = credhub.New(v2Server.URL, recorder)
+			Expect(err).NotTo(HaveOccurred())
+			recorder.requests = nil
+		})
+
+		it.After(func() {
+			v2Server.Close()
+		})
+
+		it("interpolates in a single request", func() {
+			interpolated, err := chClient.InterpolateCredentials(vcapServices)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.requests).To(Equal([]string{"POST /api/v1/interpolate"}))
+			Expect(vcapServicesDeepEnoughEquals(vcapServices, interpolated)).To(BeTrue())
+		})
+
+		it("produces the same output as the server without it", func() {
+			interpolated, err := chClient.InterpolateCredentials(vcapServices)
+			Expect(err).NotTo(HaveOccurred())
+
+			v1Client, err := credhub.New(server.URL, getAuthenticatedClient(server.Client()))
+			Expect(err).NotTo(HaveOccurred())
+			fallback, err := v1Client.InterpolateCredentials(vcapServices)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(interpolated).To(Equal(fallback))
+		})
+
+		it("reports missing credentials like the server without it", func() {
+			_, err := chClient.InterpolateCredentials(`{"p-config-server":[{"credentials":{"credhub-ref":"/this-does-not-exist"}}]}`)
+			Expect(err).To(BeAssignableToTypeOf(&credhub.InterpolationError{}))
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveKeyWithValue("/this-does-not-exist", MatchError("Name Not Found")))
+		})
+	})
+
+	when("the server can not interpolate credentials", func() {
+		var recorder *pathRecordingClient
+
+		it.Before(func() {
+			var err error
+			recorder = &pathRecordingClient{HTTPClient: getAuthenticatedClient(server.Client())}
+			chClient, err = credhub.New(server.URL, recorder)
+			Expect(err).NotTo(HaveOccurred())
+			recorder.requests = nil
+		})
+
+		it("looks up each credential once", func() {
+			vcapServices := `{"p-config-server":[{"credentials":{"credhub-ref":"/service-cred-ref"}},{"credentials":{"credhub-ref":"/service-cred-ref"}}]}`
+
+			interpolated, err := chClient.InterpolateCredentials(vcapServices)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.requests).To(Equal([]string{"POST /api/v1/interpolate", "GET /api/v1/data"}))
+
+			interpolatedObj := make(map[string][]map[string]interface{})
+			Expect(json.Unmarshal([]byte(interpolated), &interpolatedObj)).To(Succeed())
+			Expect(interpolatedObj["p-config-server"][0]["credentials"]).To(HaveKey("password"))
+			Expect(interpolatedObj["p-config-server"][1]["credentials"]).To(HaveKey("password"))
+		})
+
+		it("reports every credential that could not be resolved", func() {
+			vcapServices := `{"a":[{"credentials":{"credhub-ref":"/missing-1"}},{"credentials":{"credhub-ref":"/service-cred-ref"}}],"b":[{"credentials":{"credhub-ref":"/missing-2"}}]}`
+
+			interpolated, err := chClient.InterpolateCredentials(vcapServices)
+			Expect(interpolated).To(BeZero())
+			Expect(err).To(BeAssignableToTypeOf(&credhub.InterpolationError{}))
+
+			refErrs := err.(*credhub.InterpolationError).Errors
+			Expect(refErrs).To(HaveLen(2))
+			Expect(refErrs).To(HaveKey("/missing-1"))
+			Expect(refErrs).To(HaveKey("/missing-2"))
+			Expect(err.Error()).To(Equal("unable to resolve credhub-refs: /missing-1: Name Not Found; /missing-2: Name Not Found"))
+		})
+
+		it("bounds the number of concurrent lookups", func() {
+			counter := &concurrencyCountingClient{HTTPClient: getAuthenticatedClient(server.Client())}
+			countingClient, err := credhub.New(server.URL, counter)
+			Expect(err).NotTo(HaveOccurred())
+
+			services := make([]string, 0, 30)
+			for i := 0; i < 30; i++ {
+				services = append(services, fmt.Sprintf(`{"credentials":{"credhub-ref":"/missing-%d"}}`, i))
+			}
+
+			_, err = countingClient.InterpolateCredentials(`{"p-config-server":[` + strings.Join(services, ",") + `]}`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveLen(30))
+			Expect(counter.max).To(BeNumerically(">", 1))
+			Expect(counter.max).To(BeNumerically("<=", 8))
+		})
+	})
+
 	when("testing edge cases", func() {
 		when("getting invalid VCAP_SERVICES json", func() {
 			it("fails", func() {
@@ -84,6 +243,27 @@ func testInterpolateCredentials(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("the credential ref is not a string", func() {
+			it("fails without making any requests", func() {
+				recorder := &pathRecordingClient{HTTPClient: getAuthenticatedClient(server.Client())}
+				chClient, err := credhub.New(server.URL, recorder)
+				Expect(err).NotTo(HaveOccurred())
+				recorder.requests = nil
+
+				vcapServices := `{"p-config-server":[{"credentials":{"credhub-ref":42}},{"credentials":{"credhub-ref":{"name":"/service-cred-ref"}}}]}`
+
+				var interpolated string
+				Expect(func() {
+					interpolated, err = chClient.InterpolateCredentials(vcapServices)
+				}).NotTo(Panic())
+				Expect(interpolated).To(BeZero())
+				Expect(err).To(BeAssignableToTypeOf(&credhub.InterpolationError{}))
+				Expect(err.(*credhub.InterpolationError).Errors).To(HaveLen(2))
+				Expect(err.(*credhub.InterpolationError).Errors).To(HaveKey("42"))
+				Expect(recorder.requests).To(BeEmpty())
+			})
+		})
+
 		when("the credential ref does not exist", func() {
 			it("fails", func() {
 				vcapServices := `
@@ -0,0 +1,161 @@
+package credhub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// InterpolateJSON replaces every credhub-ref object in a JSON document with
+// the value of the credential it refers to, and returns the resulting document.
+// See InterpolateValue for the form of credhub-ref objects.
+func InterpolateJSON(c API, doc []byte) ([]byte, error) {
+	var v interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	interpolated, err := InterpolateValue(c, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(interpolated)
+}
+
+/*
+
+InterpolateValue replaces every credhub-ref object at any depth of v, which
+should be made up of the types encoding/json decodes into an interface{}, with
+the value of the credential it refers to. v is not modified; a copy with the
+credentials interpolated is returned.
+
+A credhub-ref object is an object whose only keys are "credhub-ref" and,
+optionally, "field":
+
+	{"credhub-ref": "/concourse/main/db"}
+	{"credhub-ref": "/concourse/main/db", "field": "password"}
+
+The first form is replaced with the whole value of the latest version of the
+credential, and the second with a single field of it, which only works for
+credentials whose value is an object (e.g. user, certificate and json
+credentials).
+
+Each credential is only looked up once, however many times it is referred to.
+If any refs can not be resolved, the error is an *InterpolationError listing
+all of them, keyed by name, or by name.field for missing fields.
+
+*/
+func InterpolateValue(c API, v interface{}) (interface{}, error) {
+	names := make(map[string]struct{})
+	refErrs := make(map[string]error)
+	collectJSONRefs(v, names, refErrs)
+
+	values := resolveRefs(func(name string) (interface{}, error) {
+		cred, err := c.GetLatestByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return cred.Value, nil
+	}, names, refErrs)
+
+	if len(refErrs) > 0 {
+		return nil, &InterpolationError{Errors: refErrs}
+	}
+
+	interpolated := replaceJSONRefs(v, values, refErrs)
+	if len(refErrs) > 0 {
+		return nil, &InterpolationError{Errors: refErrs}
+	}
+
+	return interpolated, nil
+}
+
+// jsonRef returns the name and field of a credhub-ref object
+func jsonRef(m map[string]interface{}) (ref interface{}, field interface{}, ok bool) {
+	ref, ok = m["credhub-ref"]
+	if !ok {
+		return nil, nil, false
+	}
+
+	field, hasField := m["field"]
+	switch {
+	case len(m) == 1:
+		return ref, nil, true
+	case len(m) == 2 && hasField:
+		return ref, field, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// collectJSONRefs adds the names of every credhub-ref in v to names, and an
+// error for every malformed one to refErrs
+func collectJSONRefs(v interface{}, names map[string]struct{}, refErrs map[string]error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if ref, field, ok := jsonRef(t); ok {
+			name, ok := ref.(string)
+			if !ok {
+				refErrs[fmt.Sprintf("%v", ref)] = errors.New("credhub-ref must be a string")
+				return
+			}
+
+			if _, ok := field.(string); field != nil && !ok {
+				refErrs[fmt.Sprintf("%s.%v", name, field)] = errors.New("field must be a string")
+				return
+			}
+
+			names[name] = struct{}{}
+			return
+		}
+
+		for _, value := range t {
+			collectJSONRefs(value, names, refErrs)
+		}
+	case []interface{}:
+		for _, value := range t {
+			collectJSONRefs(value, names, refErrs)
+		}
+	}
+}
+
+// replaceJSONRefs returns a copy of v with every credhub-ref replaced by its
+// value, adding an error to refErrs for every field that does not exist
+func replaceJSONRefs(v interface{}, values map[string]interface{}, refErrs map[string]error) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if ref, field, ok := jsonRef(t); ok {
+			name := ref.(string)
+			value := values[name]
+			if field == nil {
+				return value
+			}
+
+			obj, _ := value.(map[string]interface{})
+			fieldValue, ok := obj[field.(string)]
+			if !ok {
+				refErrs[name+"."+field.(string)] = fmt.Errorf("credential has no field %q", field)
+			}
+			return fieldValue
+		}
+
+		m := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			m[key] = replaceJSONRefs(value, values, refErrs)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			s[i] = replaceJSONRefs(value, values, refErrs)
+		}
+		return s
+	default:
+		return v
+	}
+}
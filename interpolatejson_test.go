@@ -0,0 +1,136 @@
+package credhub_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+func TestInterpolateJSON(t *testing.T) {
+	spec.Run(t, "InterpolateJSON", testInterpolateJSON, spec.Report(report.Terminal{}))
+}
+
+func testInterpolateJSON(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server   *httptest.Server
+		recorder *pathRecordingClient
+		chClient *credhub.Client
+	)
+
+	it.Before(func() {
+		var err error
+		RegisterTestingT(t)
+		server = mockCredhubServer()
+		recorder = &pathRecordingClient{HTTPClient: getAuthenticatedClient(server.Client())}
+		chClient, err = credhub.New(server.URL, recorder)
+		Expect(err).NotTo(HaveOccurred())
+		recorder.requests = nil
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	when("interpolating a JSON document", func() {
+		it("replaces credhub-refs at any depth", func() {
+			doc := `{
+				"database": {
+					"credentials": {"credhub-ref": "/concourse/common/sample-user"},
+					"password": {"credhub-ref": "/concourse/common/sample-user", "field": "password"},
+					"replicas": [{"name": "a", "token": {"credhub-ref": "/concourse/common/sample-value"}}]
+				},
+				"port": 12345678901234567890,
+				"plain": {"credhub-ref": "/concourse/common/sample-value", "other": "key"}
+			}`
+
+			interpolated, err := credhub.InterpolateJSON(chClient, []byte(doc))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated).To(MatchJSON(`{
+				"database": {
+					"credentials": {"username": "me", "password": "somesupersecretpassword", "password_hash": "$apr1$8Nv3lOEE$/fg3T/a3oVzOQWj9Pd6vl0"},
+					"password": "somesupersecretpassword",
+					"replicas": [{"name": "a", "token": "sample2"}]
+				},
+				"port": 12345678901234567890,
+				"plain": {"credhub-ref": "/concourse/common/sample-value", "other": "key"}
+			}`))
+		})
+
+		it("looks up each credential once", func() {
+			doc := `[{"credhub-ref": "/concourse/common/sample-user", "field": "username"}, {"credhub-ref": "/concourse/common/sample-user", "field": "password"}]`
+
+			interpolated, err := credhub.InterpolateJSON(chClient, []byte(doc))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated).To(MatchJSON(`["me", "somesupersecretpassword"]`))
+			Expect(recorder.requests).To(Equal([]string{"GET /api/v1/data"}))
+		})
+
+		it("fails on invalid JSON", func() {
+			_, err := credhub.InterpolateJSON(chClient, []byte(`{invalid}`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("interpolating a decoded value", func() {
+		it("does not modify the value", func() {
+			var v interface{}
+			Expect(json.Unmarshal([]byte(`{"token": {"credhub-ref": "/concourse/common/sample-value"}}`), &v)).To(Succeed())
+
+			interpolated, err := credhub.InterpolateValue(chClient, v)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated).To(Equal(map[string]interface{}{"token": "sample2"}))
+			Expect(v).To(Equal(map[string]interface{}{"token": map[string]interface{}{"credhub-ref": "/concourse/common/sample-value"}}))
+		})
+
+		it("returns values without refs unchanged", func() {
+			interpolated, err := credhub.InterpolateValue(chClient, "just a string")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interpolated).To(Equal("just a string"))
+			Expect(recorder.requests).To(BeEmpty())
+		})
+	})
+
+	when("refs can not be resolved", func() {
+		it("reports all of them", func() {
+			doc := `{
+				"missing": {"credhub-ref": "/this-does-not-exist"},
+				"no-field": {"credhub-ref": "/concourse/common/sample-user", "field": "nope"},
+				"not-an-object": {"credhub-ref": "/concourse/common/sample-value", "field": "nope"},
+				"bad-ref": {"credhub-ref": 42},
+				"bad-field": {"credhub-ref": "/concourse/common/sample-user", "field": true}
+			}`
+
+			var interpolated []byte
+			var err error
+			Expect(func() {
+				interpolated, err = credhub.InterpolateJSON(chClient, []byte(doc))
+			}).NotTo(Panic())
+			Expect(interpolated).To(BeNil())
+			Expect(err).To(BeAssignableToTypeOf(&credhub.InterpolationError{}))
+
+			refErrs := err.(*credhub.InterpolationError).Errors
+			Expect(refErrs).To(HaveKeyWithValue("/this-does-not-exist", MatchError("Name Not Found")))
+			Expect(refErrs).To(HaveKey("42"))
+			Expect(refErrs).To(HaveKey("/concourse/common/sample-user.true"))
+		})
+
+		it("reports missing fields", func() {
+			doc := `{
+				"no-field": {"credhub-ref": "/concourse/common/sample-user", "field": "nope"},
+				"not-an-object": {"credhub-ref": "/concourse/common/sample-value", "field": "nope"}
+			}`
+
+			_, err := credhub.InterpolateJSON(chClient, []byte(doc))
+			Expect(err).To(BeAssignableToTypeOf(&credhub.InterpolationError{}))
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveLen(2))
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveKey("/concourse/common/sample-user.nope"))
+			Expect(err.(*credhub.InterpolationError).Errors).To(HaveKey("/concourse/common/sample-value.nope"))
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package credhub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// tokenClaims decodes the claims of a JWT access token. The signature is not
+// verified; Credhub will do that when the token is presented to it.
+func tokenClaims(accessToken string) (map[string]interface{}, error) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// unknownTokenLifetime is how long an access token is used before it is
+// refreshed, if its expiry can't be read from it (e.g. because it is an opaque
+// token rather than a JWT)
+const unknownTokenLifetime = time.Minute
+
+// tokenExpiry returns the expiry time of a JWT access token, or a short time
+// from now if it cannot be determined, so that the token is soon refreshed
+// rather than used forever
+func tokenExpiry(accessToken string) time.Time {
+	claims, err := tokenClaims(accessToken)
+	if err != nil {
+		return time.Now().Add(unknownTokenLifetime)
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Now().Add(unknownTokenLifetime)
+	}
+
+	return time.Unix(int64(exp), 0)
+}
@@ -0,0 +1,370 @@
+/*
+Package kubesecret renders credentials as Kubernetes Secret manifests, so
+workloads on Kubernetes can use credentials kept in Credhub, e.g. by committing
+the manifests for GitOps tooling to apply.
+
+Each credential is rendered as a v1 Secret, with a type and keys that follow
+the Kubernetes conventions for its type of credential:
+
+	certificate  kubernetes.io/tls         tls.crt, tls.key and ca.crt
+	user         kubernetes.io/basic-auth  username and password
+	ssh          kubernetes.io/ssh-auth    ssh-privatekey and ssh-publickey
+	rsa          Opaque                    private_key and public_key
+	json         Opaque                    a key for each value, flattened with
+	                                       dots, e.g. "db.hosts.0"
+	value        Opaque                    value
+	password     Opaque                    password
+
+Example usage:
+
+	results, err := kubesecret.Export(client, "/concourse/main", file, kubesecret.Options{
+		Namespace: "ci",
+		Rules: []kubesecret.Rule{
+			{Pattern: `^/concourse/main/(.*)-tls$`, Name: "$1-tls-secret"},
+		},
+	})
+	if err != nil {
+		...
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s: %v\n", result.Name, result.Err)
+		}
+	}
+
+*/
+package kubesecret
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The types of Secret that credentials are rendered as
+const (
+	Opaque    = "Opaque"
+	TLS       = "kubernetes.io/tls"
+	BasicAuth = "kubernetes.io/basic-auth"
+	SSHAuth   = "kubernetes.io/ssh-auth"
+)
+
+// NameAnnotation is the annotation that records the name of the credential a
+// Secret was rendered from
+const NameAnnotation = "credhub/name"
+
+// Secret is a v1 Secret manifest
+type Secret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   Metadata          `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+// Metadata is the metadata of a Secret manifest
+type Metadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Rule renames the credentials whose names match Pattern, a regular
+// expression, to Name, which can refer to submatches as in
+// regexp.Regexp.Expand, e.g. "$1"
+type Rule struct {
+	Pattern string
+	Name    string
+}
+
+// Options control how credentials are rendered
+type Options struct {
+	// Namespace is the namespace of every Secret. If it is empty, the Secrets
+	// are created in the namespace they are applied to.
+	Namespace string
+
+	// Labels are added to every Secret
+	Labels map[string]string
+
+	// Rules name the Secrets of the credentials that match them, and the
+	// first one that matches is used. Credentials that match none are named
+	// after their path under the exported prefix, in lower case with "/" and
+	// "_" replaced by "-", e.g. "/concourse/main/db_admin" exported from
+	// "/concourse" becomes "main-db-admin".
+	Rules []Rule
+}
+
+// Result is the outcome of rendering a single credential
+type Result struct {
+	// Name is the name of the credential
+	Name string
+
+	// Secret is the name of the Secret it was rendered as
+	Secret string
+
+	// Err is why the credential could not be rendered
+	Err error
+}
+
+// validName matches the names Kubernetes accepts for Secrets, which are DNS
+// subdomains
+var validName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// validKey matches the keys Kubernetes accepts in the data of Secrets
+var validKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+/*
+
+Export writes a Secret for the latest version of every credential under prefix
+(e.g. "/concourse") to w, as a stream of YAML documents in order of credential
+name.
+
+A credential that can't be read or rendered, or whose Secret would have the same
+name as an earlier one's, is left out of the stream, and its result has the
+reason; the results of the others are returned too. The error is only non-nil
+if a rule is invalid, the credentials can't be listed or the stream can't be
+written.
+
+*/
+func Export(c credhub.API, prefix string, w io.Writer, opts Options) ([]Result, error) {
+	rules, err := compile(opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := c.FindByPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(found))
+	for _, cred := range found {
+		names = append(names, cred.Name)
+	}
+	sort.Strings(names)
+
+	rendered := make(map[string]string, len(names))
+	results := make([]Result, 0, len(names))
+	for _, name := range names {
+		result := Result{Name: name, Secret: secretName(name, prefix, rules)}
+
+		var cred *credhub.Credential
+		var secret *Secret
+		var out []byte
+
+		switch {
+		case !validName.MatchString(result.Secret) || len(result.Secret) > 253:
+			result.Err = fmt.Errorf("%q is not a valid secret name", result.Secret)
+		case rendered[result.Secret] != "":
+			result.Err = fmt.Errorf("%s is also rendered as %s", rendered[result.Secret], result.Secret)
+		}
+
+		if result.Err == nil {
+			cred, result.Err = c.GetLatestByName(name)
+		}
+
+		if result.Err == nil {
+			secret, result.Err = NewSecret(*cred, result.Secret, opts)
+		}
+
+		if result.Err == nil {
+			out, result.Err = yaml.Marshal(secret)
+		}
+
+		if result.Err == nil {
+			rendered[result.Secret] = name
+			if _, err = fmt.Fprintf(w, "---\n%s", out); err != nil {
+				return nil, err
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// NewSecret renders a credential as a Secret with the given name
+func NewSecret(cred credhub.Credential, name string, opts Options) (*Secret, error) {
+	values, secretType, err := data(cred)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &Secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: Metadata{
+			Name:        name,
+			Namespace:   opts.Namespace,
+			Labels:      opts.Labels,
+			Annotations: map[string]string{NameAnnotation: cred.Name},
+		},
+		Type: secretType,
+		Data: make(map[string]string, len(values)),
+	}
+
+	for key, value := range values {
+		if !validKey.MatchString(key) {
+			return nil, fmt.Errorf("%q is not a valid secret key", key)
+		}
+		secret.Data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	return secret, nil
+}
+
+// data returns the keys and values of the Secret for a credential, and the
+// type of Secret
+func data(cred credhub.Credential) (map[string]string, string, error) {
+	switch cred.Type {
+	case credhub.Value, credhub.Password:
+		s, ok := cred.Value.(string)
+		if !ok {
+			return nil, "", fmt.Errorf("the value of a %s credential must be a string", cred.Type)
+		}
+		return map[string]string{string(cred.Type): s}, Opaque, nil
+	case credhub.JSON:
+		m, ok := cred.Value.(map[string]interface{})
+		if !ok {
+			return nil, "", errors.New("the value of a json credential must be an object")
+		}
+
+		values := make(map[string]string)
+		for key, value := range m {
+			if err := flatten(key, value, values); err != nil {
+				return nil, "", err
+			}
+		}
+		return values, Opaque, nil
+	}
+
+	m, ok := cred.Value.(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("the value of a %s credential must be an object", cred.Type)
+	}
+
+	field := func(key string) string {
+		s, _ := m[key].(string)
+		return s
+	}
+
+	switch cred.Type {
+	case credhub.Certificate:
+		if field("certificate") == "" {
+			return nil, "", errors.New("the certificate has no certificate")
+		}
+
+		// tls Secrets must have both keys, even if there is no private key
+		values := map[string]string{
+			"tls.crt": field("certificate"),
+			"tls.key": field("private_key"),
+		}
+		if ca := field("ca"); ca != "" {
+			values["ca.crt"] = ca
+		}
+		return values, TLS, nil
+	case credhub.User:
+		return map[string]string{"username": field("username"), "password": field("password")}, BasicAuth, nil
+	case credhub.SSH:
+		if field("private_key") == "" {
+			return nil, "", errors.New("the ssh key has no private key")
+		}
+		return map[string]string{"ssh-privatekey": field("private_key"), "ssh-publickey": field("public_key")}, SSHAuth, nil
+	case credhub.RSA:
+		return map[string]string{"private_key": field("private_key"), "public_key": field("public_key")}, Opaque, nil
+	}
+
+	return nil, "", fmt.Errorf("unknown type %q", cred.Type)
+}
+
+// flatten adds a key for each value under key in a JSON value, joining the
+// keys of nested objects and the indexes of arrays with dots. Strings are
+// added as they are, and other values (including empty objects and arrays) as
+// JSON.
+func flatten(key string, value interface{}, values map[string]string) error {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		if len(t) > 0 {
+			for k, v := range t {
+				if err := flatten(key+"."+k, v, values); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case []interface{}:
+		if len(t) > 0 {
+			for i, v := range t {
+				if err := flatten(key+"."+strconv.Itoa(i), v, values); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	if _, ok := values[key]; ok {
+		return fmt.Errorf("the key %q is used more than once", key)
+	}
+
+	if s, ok := value.(string); ok {
+		values[key] = s
+		return nil
+	}
+
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	values[key] = string(buf)
+
+	return nil
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	name    string
+}
+
+func compile(rules []Rule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %v", r.Pattern, err)
+		}
+		compiled = append(compiled, rule{pattern: pattern, name: r.Name})
+	}
+
+	return compiled, nil
+}
+
+// secretName returns the name of the Secret for a credential, from the first
+// rule that matches it, or its path under prefix
+func secretName(name, prefix string, rules []rule) string {
+	for _, r := range rules {
+		if m := r.pattern.FindStringSubmatchIndex(name); m != nil {
+			return string(r.pattern.ExpandString(nil, r.name, name, m))
+		}
+	}
+
+	rel := name
+	if p := strings.TrimSuffix(prefix, "/"); strings.HasPrefix(name, p+"/") {
+		rel = strings.TrimPrefix(name, p+"/")
+	}
+
+	rel = strings.ToLower(strings.Trim(rel, "/"))
+	return strings.NewReplacer("/", "-", "_", "-").Replace(rel)
+}
@@ -0,0 +1,177 @@
+package kubesecret_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	yaml "gopkg.in/yaml.v2"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	"github.com/cloudfoundry-community/go-credhub/kubesecret"
+	. "github.com/onsi/gomega"
+)
+
+func TestKubeSecret(t *testing.T) {
+	spec.Run(t, "KubeSecret", testKubeSecret, spec.Report(report.Terminal{}))
+}
+
+func testKubeSecret(t *testing.T, when spec.G, it spec.S) {
+	decoded := func(secret *kubesecret.Secret) map[string]string {
+		m := make(map[string]string, len(secret.Data))
+		for key, value := range secret.Data {
+			buf, err := base64.StdEncoding.DecodeString(value)
+			Expect(err).NotTo(HaveOccurred())
+			m[key] = string(buf)
+		}
+		return m
+	}
+
+	render := func(credType credhub.CredentialType, value interface{}) *kubesecret.Secret {
+		secret, err := kubesecret.NewSecret(credhub.Credential{Name: "/test/cred", Type: credType, Value: value}, "cred", kubesecret.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		return secret
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("rendering credentials", func() {
+		it("renders certificates as tls secrets", func() {
+			secret := render(credhub.Certificate, map[string]interface{}{"ca": "CA", "certificate": "CERT", "private_key": "KEY"})
+			Expect(secret.APIVersion).To(Equal("v1"))
+			Expect(secret.Kind).To(Equal("Secret"))
+			Expect(secret.Metadata.Name).To(Equal("cred"))
+			Expect(secret.Metadata.Annotations).To(Equal(map[string]string{kubesecret.NameAnnotation: "/test/cred"}))
+			Expect(secret.Type).To(Equal(kubesecret.TLS))
+			Expect(decoded(secret)).To(Equal(map[string]string{"tls.crt": "CERT", "tls.key": "KEY", "ca.crt": "CA"}))
+
+			secret = render(credhub.Certificate, map[string]interface{}{"certificate": "CERT"})
+			Expect(decoded(secret)).To(Equal(map[string]string{"tls.crt": "CERT", "tls.key": ""}))
+		})
+
+		it("renders users as basic-auth secrets", func() {
+			secret := render(credhub.User, map[string]interface{}{"username": "admin", "password": "hunter2", "password_hash": "hash"})
+			Expect(secret.Type).To(Equal(kubesecret.BasicAuth))
+			Expect(decoded(secret)).To(Equal(map[string]string{"username": "admin", "password": "hunter2"}))
+		})
+
+		it("renders ssh keys as ssh-auth secrets", func() {
+			secret := render(credhub.SSH, map[string]interface{}{"public_key": "ssh-rsa PUBLIC", "private_key": "PRIVATE", "public_key_fingerprint": "FP"})
+			Expect(secret.Type).To(Equal(kubesecret.SSHAuth))
+			Expect(decoded(secret)).To(Equal(map[string]string{"ssh-privatekey": "PRIVATE", "ssh-publickey": "ssh-rsa PUBLIC"}))
+		})
+
+		it("renders other credentials as opaque secrets", func() {
+			secret := render(credhub.Value, "v")
+			Expect(secret.Type).To(Equal(kubesecret.Opaque))
+			Expect(decoded(secret)).To(Equal(map[string]string{"value": "v"}))
+
+			Expect(decoded(render(credhub.Password, "p"))).To(Equal(map[string]string{"password": "p"}))
+			Expect(decoded(render(credhub.RSA, map[string]interface{}{"public_key": "PUBLIC", "private_key": "PRIVATE"}))).To(Equal(map[string]string{"public_key": "PUBLIC", "private_key": "PRIVATE"}))
+		})
+
+		it("flattens json", func() {
+			secret := render(credhub.JSON, map[string]interface{}{
+				"host": "db",
+				"port": 5432.0,
+				"tls":  true,
+				"replicas": []interface{}{
+					"a",
+					map[string]interface{}{"host": "b"},
+				},
+				"empty": map[string]interface{}{},
+				"none":  nil,
+			})
+			Expect(secret.Type).To(Equal(kubesecret.Opaque))
+			Expect(decoded(secret)).To(Equal(map[string]string{
+				"host":            "db",
+				"port":            "5432",
+				"tls":             "true",
+				"replicas.0":      "a",
+				"replicas.1.host": "b",
+				"empty":           "{}",
+				"none":            "null",
+			}))
+
+			Expect(decoded(render(credhub.JSON, map[string]interface{}{}))).To(BeEmpty())
+		})
+
+		it("rejects values it can't render", func() {
+			cred := credhub.Credential{Name: "/test/cred", Type: credhub.JSON, Value: map[string]interface{}{"a.b": "x", "a": map[string]interface{}{"b": "y"}}}
+			_, err := kubesecret.NewSecret(cred, "cred", kubesecret.Options{})
+			Expect(err).To(MatchError(`the key "a.b" is used more than once`))
+
+			cred.Value = map[string]interface{}{"a b": "x"}
+			_, err = kubesecret.NewSecret(cred, "cred", kubesecret.Options{})
+			Expect(err).To(MatchError(`"a b" is not a valid secret key`))
+
+			cred = credhub.Credential{Name: "/test/cred", Type: credhub.SSH, Value: map[string]interface{}{"public_key": "PUBLIC"}}
+			_, err = kubesecret.NewSecret(cred, "cred", kubesecret.Options{})
+			Expect(err).To(MatchError("the ssh key has no private key"))
+		})
+	})
+
+	when("exporting", func() {
+		var fake *credhubtest.FakeClient
+
+		it.Before(func() {
+			fake = credhubtest.NewFakeClient(credhubtest.Version2)
+			fake.Seed(
+				credhub.Credential{Name: "/concourse/main/DB_admin", Type: credhub.User, Value: map[string]interface{}{"username": "admin", "password": "secret"}},
+				credhub.Credential{Name: "/concourse/main/web-tls", Type: credhub.Certificate, Value: map[string]interface{}{"certificate": "CERT", "private_key": "KEY"}},
+				credhub.Credential{Name: "/concourse/main/db-admin", Type: credhub.Value, Value: "collides"},
+				credhub.Credential{Name: "/concourse/main/bad:name", Type: credhub.Value, Value: "x"},
+				credhub.Credential{Name: "/elsewhere/token", Type: credhub.Value, Value: "x"},
+			)
+		})
+
+		it("writes a secret for each credential", func() {
+			buf := new(bytes.Buffer)
+			results, err := kubesecret.Export(fake, "/concourse", buf, kubesecret.Options{
+				Namespace: "ci",
+				Labels:    map[string]string{"app": "concourse"},
+				Rules: []kubesecret.Rule{
+					{Pattern: `^/concourse/main/(.*)-tls$`, Name: "$1-certs"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(results).To(Equal([]kubesecret.Result{
+				{Name: "/concourse/main/DB_admin", Secret: "main-db-admin"},
+				{Name: "/concourse/main/bad:name", Secret: "main-bad:name", Err: results[1].Err},
+				{Name: "/concourse/main/db-admin", Secret: "main-db-admin", Err: results[2].Err},
+				{Name: "/concourse/main/web-tls", Secret: "web-certs"},
+			}))
+			Expect(results[1].Err).To(MatchError(`"main-bad:name" is not a valid secret name`))
+			Expect(results[2].Err).To(MatchError("/concourse/main/DB_admin is also rendered as main-db-admin"))
+
+			docs := strings.Split(buf.String(), "---\n")
+			Expect(docs).To(HaveLen(3))
+			Expect(docs[0]).To(BeEmpty())
+
+			var secret kubesecret.Secret
+			Expect(yaml.Unmarshal([]byte(docs[2]), &secret)).To(Succeed())
+			Expect(secret.Metadata).To(Equal(kubesecret.Metadata{
+				Name:        "web-certs",
+				Namespace:   "ci",
+				Labels:      map[string]string{"app": "concourse"},
+				Annotations: map[string]string{kubesecret.NameAnnotation: "/concourse/main/web-tls"},
+			}))
+			Expect(secret.Type).To(Equal(kubesecret.TLS))
+			Expect(decoded(&secret)).To(Equal(map[string]string{"tls.crt": "CERT", "tls.key": "KEY"}))
+		})
+
+		it("rejects invalid rules", func() {
+			_, err := kubesecret.Export(fake, "/concourse", new(bytes.Buffer), kubesecret.Options{
+				Rules: []kubesecret.Rule{{Pattern: "(", Name: "x"}},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
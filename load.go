@@ -0,0 +1,413 @@
+package credhub
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	certificateType = reflect.TypeOf((*x509.Certificate)(nil))
+	signerType      = reflect.TypeOf((*crypto.Signer)(nil)).Elem()
+	bytesType       = reflect.TypeOf([]byte(nil))
+)
+
+// LoadError is returned by Load when some fields could not be loaded. Every
+// field that failed is reported, not just the first.
+type LoadError struct {
+	// Errors maps the path of each field that could not be loaded (e.g.
+	// "DB.Password") to the reason why
+	Errors map[string]error
+}
+
+func (e *LoadError) Error() string {
+	fields := make([]string, 0, len(e.Errors))
+	for field := range e.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", field, e.Errors[field]))
+	}
+
+	return "unable to load credentials: " + strings.Join(msgs, "; ")
+}
+
+/*
+
+Load fills the fields of the struct that v points to with credentials, as
+directed by their credhub struct tags:
+
+	type Config struct {
+		DB struct {
+			Username string `credhub:"db,field=username"`
+			Password string `credhub:"db,field=password"`
+		}
+		APIKey string            `credhub:"/shared/api-key,optional"`
+		Cert   *x509.Certificate `credhub:"tls,type=certificate"`
+		Key    crypto.Signer     `credhub:"tls"`
+	}
+
+A tag starts with the name of a credential. Names that don't start with "/" are
+relative to "/"; use LoadWithPrefix to put them under a different path. The
+name may be followed by these options:
+
+	field=NAME  use a single field of the credential's value
+	type=TYPE   fail unless the credential is of this type
+	optional    leave the field alone if the credential or field doesn't exist
+	prefix      load the nested struct with names relative to this name
+
+Untagged struct fields (and fields tagged "-") are skipped, except for structs
+and pointers to structs, which are loaded with the same prefix.
+
+The value is converted to the type of the field:
+
+	*x509.Certificate  the certificate of a certificate credential, or a PEM
+	                   encoded certificate
+	crypto.Signer      the private key of a certificate, rsa or ssh credential,
+	                   or a PEM encoded private key
+	[]byte             the bytes of a string, or the value encoded as JSON
+	string             the string, or the value encoded as JSON
+	anything else      the value decoded as JSON, e.g. into a UserValueType
+
+Each credential is only looked up once. If any fields can not be loaded, the
+error is a *LoadError listing all of them, and the fields that could be loaded
+are still set.
+
+*/
+func Load(c API, v interface{}) error {
+	return LoadWithPrefix(c, "/", v)
+}
+
+// LoadWithPrefix is like Load, but relative names are looked up under prefix
+// (e.g. "/concourse/main")
+func LoadWithPrefix(c API, prefix string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("credhub: Load expects a non-nil pointer to a struct, got %T", v)
+	}
+
+	fieldErrs := make(map[string]error)
+	bd := &binder{errs: fieldErrs, binding: make(map[reflect.Type]bool)}
+	bindings := bd.bindStruct(rv.Elem(), "", "/"+strings.Trim(prefix, "/"))
+
+	names := make(map[string]struct{})
+	for _, b := range bindings {
+		names[b.name] = struct{}{}
+	}
+
+	lookupErrs := make(map[string]error)
+	creds := resolveRefs(func(name string) (interface{}, error) {
+		return c.GetLatestByName(name)
+	}, names, lookupErrs)
+
+	for _, b := range bindings {
+		if err, ok := lookupErrs[b.name]; ok {
+			if !(b.optional && errors.Is(err, ErrNotFound)) {
+				fieldErrs[b.path] = fmt.Errorf("%s: %v", b.name, err)
+			}
+			continue
+		}
+
+		err := b.assign(creds[b.name].(*Credential))
+		switch {
+		case err == errNoField && b.optional:
+		case err == errNoField:
+			fieldErrs[b.path] = fmt.Errorf("%s: credential has no field %q", b.name, b.field)
+		case err != nil:
+			fieldErrs[b.path] = fmt.Errorf("%s: %v", b.name, err)
+		}
+	}
+
+	if len(fieldErrs) > 0 {
+		return &LoadError{Errors: fieldErrs}
+	}
+
+	return nil
+}
+
+var errNoField = errors.New("no such field")
+
+// binding is a struct field to be loaded from a credential
+type binding struct {
+	path     string
+	dst      reflect.Value
+	name     string
+	field    string
+	credType CredentialType
+	optional bool
+}
+
+// binder finds the fields of a struct to load
+type binder struct {
+	// errs has an error for every field with a malformed tag
+	errs map[string]error
+
+	// binding holds the struct types being bound, so that recursive types
+	// aren't followed forever
+	binding map[reflect.Type]bool
+}
+
+// bindStruct returns the bindings of the tagged fields of v and its nested
+// structs
+func (bd *binder) bindStruct(v reflect.Value, path, prefix string) []binding {
+	var bindings []binding
+
+	t := v.Type()
+	if bd.binding[t] {
+		return nil
+	}
+	bd.binding[t] = true
+	defer delete(bd.binding, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		fieldPath := sf.Name
+		if path != "" {
+			fieldPath = path + "." + sf.Name
+		}
+
+		tag, tagged := sf.Tag.Lookup("credhub")
+		if tag == "-" {
+			continue
+		}
+
+		if !tagged {
+			bindings = append(bindings, bd.bindNested(v.Field(i), fieldPath, prefix)...)
+			continue
+		}
+
+		b := binding{path: fieldPath, dst: v.Field(i)}
+		isPrefix := false
+
+		parts := strings.Split(tag, ",")
+		for _, opt := range parts[1:] {
+			switch {
+			case opt == "optional":
+				b.optional = true
+			case opt == "prefix":
+				isPrefix = true
+			case strings.HasPrefix(opt, "field="):
+				b.field = strings.TrimPrefix(opt, "field=")
+			case strings.HasPrefix(opt, "type="):
+				b.credType = CredentialType(strings.TrimPrefix(opt, "type="))
+			default:
+				bd.errs[fieldPath] = fmt.Errorf("unknown option %q in credhub tag", opt)
+			}
+		}
+
+		if parts[0] == "" {
+			bd.errs[fieldPath] = errors.New("credhub tag has no credential name")
+			continue
+		}
+
+		b.name = parts[0]
+		if !strings.HasPrefix(b.name, "/") {
+			b.name = strings.TrimSuffix(prefix, "/") + "/" + b.name
+		}
+
+		if isPrefix {
+			if !isStruct(v.Field(i).Type()) {
+				bd.errs[fieldPath] = errors.New("the prefix option can only be used on structs")
+				continue
+			}
+			bindings = append(bindings, bd.bindNested(v.Field(i), fieldPath, b.name)...)
+			continue
+		}
+
+		bindings = append(bindings, b)
+	}
+
+	return bindings
+}
+
+// isStruct returns true if t is a struct, or a pointer to one, that is loaded
+// field by field rather than as a value
+func isStruct(t reflect.Type) bool {
+	if t == certificateType {
+		return false
+	}
+
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
+}
+
+// bindNested returns the bindings of a nested struct field. Nil pointers are
+// only allocated if the struct they point to has fields to load.
+func (bd *binder) bindNested(v reflect.Value, path, prefix string) []binding {
+	switch {
+	case !isStruct(v.Type()):
+		return nil
+	case v.Kind() == reflect.Struct:
+		return bd.bindStruct(v, path, prefix)
+	case !v.IsNil():
+		return bd.bindStruct(v.Elem(), path, prefix)
+	}
+
+	nested := reflect.New(v.Type().Elem())
+	bindings := bd.bindStruct(nested.Elem(), path, prefix)
+	if len(bindings) > 0 {
+		v.Set(nested)
+	}
+
+	return bindings
+}
+
+// assign sets the field of a binding from a credential, returning errNoField if
+// the binding's field isn't in the credential's value
+func (b binding) assign(cred *Credential) error {
+	if b.credType != "" && cred.Type != b.credType {
+		return fmt.Errorf("expected a %s credential, got %s", b.credType, cred.Type)
+	}
+
+	value := cred.Value
+	if b.field != "" {
+		obj, _ := value.(map[string]interface{})
+		fieldValue, ok := obj[b.field]
+		if !ok {
+			return errNoField
+		}
+		value = fieldValue
+	}
+
+	switch b.dst.Type() {
+	case certificateType:
+		certPEM, err := pemValue(cred, value, b.field == "", func(c Credential) (string, error) {
+			cert, err := CertificateValue(c)
+			return cert.Certificate, err
+		})
+		if err != nil {
+			return err
+		}
+
+		cert, err := parseCertificate(certPEM)
+		if err != nil {
+			return err
+		}
+		b.dst.Set(reflect.ValueOf(cert))
+		return nil
+	case signerType:
+		keyPEM, err := pemValue(cred, value, b.field == "", privateKey)
+		if err != nil {
+			return err
+		}
+
+		key, err := parsePrivateKey(keyPEM)
+		if err != nil {
+			return err
+		}
+		b.dst.Set(reflect.ValueOf(key))
+		return nil
+	case bytesType:
+		if s, ok := value.(string); ok {
+			b.dst.SetBytes([]byte(s))
+			return nil
+		}
+
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		b.dst.SetBytes(buf)
+		return nil
+	}
+
+	if b.dst.Kind() == reflect.String {
+		s, ok := value.(string)
+		if !ok {
+			buf, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			s = string(buf)
+		}
+		b.dst.SetString(s)
+		return nil
+	}
+
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, b.dst.Addr().Interface())
+}
+
+// pemValue returns the PEM to parse for a field: the value itself if it is a
+// string, or the part of the whole credential that fromCred selects
+func pemValue(cred *Credential, value interface{}, whole bool, fromCred func(Credential) (string, error)) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	if !whole {
+		return "", fmt.Errorf("expected a PEM encoded string, got %T", value)
+	}
+
+	return fromCred(*cred)
+}
+
+// privateKey returns the private key of a certificate, rsa or ssh credential
+func privateKey(cred Credential) (string, error) {
+	switch cred.Type {
+	case Certificate:
+		v, err := CertificateValue(cred)
+		return v.PrivateKey, err
+	case RSA:
+		v, err := RSAValue(cred)
+		return v.PrivateKey, err
+	case SSH:
+		v, err := SSHValue(cred)
+		return v.PrivateKey, err
+	default:
+		return "", fmt.Errorf("%s credentials do not have private keys", cred.Type)
+	}
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parsePrivateKey(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
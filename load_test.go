@@ -0,0 +1,180 @@
+package credhub_test
+
+import (
+	"crypto"
+	"crypto/x509"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+)
+
+func TestLoad(t *testing.T) {
+	spec.Run(t, "Load", testLoad, spec.Report(report.Terminal{}))
+}
+
+func testLoad(t *testing.T, when spec.G, it spec.S) {
+	var fake *credhubtest.FakeClient
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		cert, err := ioutil.ReadFile("testdata/tls/cert")
+		Expect(err).NotTo(HaveOccurred())
+		key, err := ioutil.ReadFile("testdata/tls/key")
+		Expect(err).NotTo(HaveOccurred())
+
+		fake = credhubtest.NewFakeClient(credhubtest.Version2)
+		fake.Seed(
+			credhub.Credential{Name: "/prod/db", Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "secret", "password_hash": "hash"}},
+			credhub.Credential{Name: "/prod/tls", Type: credhub.Certificate, Value: map[string]interface{}{"certificate": string(cert), "private_key": string(key)}},
+			credhub.Credential{Name: "/prod/settings", Type: credhub.JSON, Value: map[string]interface{}{"port": 5432, "hosts": []interface{}{"a", "b"}}},
+			credhub.Credential{Name: "/prod/nested/token", Type: credhub.Value, Value: "token"},
+			credhub.Credential{Name: "/shared/api-key", Type: credhub.Password, Value: "api-key"},
+		)
+	})
+
+	it("loads tagged fields, relative to the prefix", func() {
+		var cfg struct {
+			Username string                `credhub:"db,field=username"`
+			Password []byte                `credhub:"/prod/db,field=password"`
+			User     credhub.UserValueType `credhub:"db,type=user"`
+			APIKey   string                `credhub:"/shared/api-key"`
+			Settings string                `credhub:"settings"`
+			Port     int                   `credhub:"settings,field=port"`
+			Hosts    []string              `credhub:"settings,field=hosts"`
+			Ignored  string
+		}
+
+		Expect(credhub.LoadWithPrefix(fake, "/prod", &cfg)).To(Succeed())
+		Expect(cfg.Username).To(Equal("me"))
+		Expect(cfg.Password).To(Equal([]byte("secret")))
+		Expect(cfg.User).To(Equal(credhub.UserValueType{Username: "me", Password: "secret", PasswordHash: "hash"}))
+		Expect(cfg.APIKey).To(Equal("api-key"))
+		Expect(cfg.Settings).To(MatchJSON(`{"port": 5432, "hosts": ["a", "b"]}`))
+		Expect(cfg.Port).To(Equal(5432))
+		Expect(cfg.Hosts).To(Equal([]string{"a", "b"}))
+		Expect(cfg.Ignored).To(BeEmpty())
+	})
+
+	it("looks each credential up once", func() {
+		counter := &countingAPI{API: fake}
+
+		var cfg struct {
+			Username string `credhub:"/prod/db,field=username"`
+			Password string `credhub:"/prod/db,field=password"`
+		}
+
+		Expect(credhub.Load(counter, &cfg)).To(Succeed())
+		Expect(counter.gets).To(Equal(1))
+	})
+
+	it("loads certificates and private keys", func() {
+		var cfg struct {
+			Cert     *x509.Certificate `credhub:"tls,type=certificate"`
+			CertPEM  *x509.Certificate `credhub:"tls,field=certificate"`
+			Key      crypto.Signer     `credhub:"tls"`
+			KeyField crypto.Signer     `credhub:"tls,field=private_key"`
+		}
+
+		Expect(credhub.LoadWithPrefix(fake, "prod", &cfg)).To(Succeed())
+		Expect(cfg.Cert).NotTo(BeNil())
+		Expect(cfg.Cert.Subject.CommonName).To(HavePrefix("app:"))
+		Expect(cfg.CertPEM).To(Equal(cfg.Cert))
+		Expect(cfg.Key).NotTo(BeNil())
+		Expect(cfg.Key.Public()).To(Equal(cfg.Cert.PublicKey))
+		Expect(cfg.KeyField).To(Equal(cfg.Key))
+	})
+
+	it("loads nested structs", func() {
+		type Token struct {
+			Value string `credhub:"token"`
+		}
+
+		var cfg struct {
+			DB struct {
+				Password string `credhub:"db,field=password"`
+			}
+			Token  *Token `credhub:"nested,prefix"`
+			Unused *struct {
+				Value string
+			}
+		}
+
+		Expect(credhub.LoadWithPrefix(fake, "/prod", &cfg)).To(Succeed())
+		Expect(cfg.DB.Password).To(Equal("secret"))
+		Expect(cfg.Token).To(Equal(&Token{Value: "token"}))
+		Expect(cfg.Unused).To(BeNil())
+	})
+
+	it("handles recursive types", func() {
+		type Node struct {
+			Value string `credhub:"/prod/nested/token"`
+			Next  *Node
+		}
+
+		var node Node
+		Expect(credhub.Load(fake, &node)).To(Succeed())
+		Expect(node.Value).To(Equal("token"))
+		Expect(node.Next).To(BeNil())
+	})
+
+	it("leaves optional fields alone if they don't exist", func() {
+		cfg := struct {
+			Missing string `credhub:"/prod/missing,optional"`
+			Field   string `credhub:"/prod/db,field=missing,optional"`
+		}{Missing: "default", Field: "default"}
+
+		Expect(credhub.Load(fake, &cfg)).To(Succeed())
+		Expect(cfg.Missing).To(Equal("default"))
+		Expect(cfg.Field).To(Equal("default"))
+	})
+
+	it("reports every field that could not be loaded", func() {
+		var cfg struct {
+			Username string            `credhub:"db,field=username"`
+			Missing  string            `credhub:"missing"`
+			Field    string            `credhub:"db,field=missing"`
+			Type     string            `credhub:"db,type=certificate"`
+			Cert     *x509.Certificate `credhub:"db"`
+			NoName   string            `credhub:",optional"`
+			BadOpt   string            `credhub:"db,bogus"`
+		}
+
+		err := credhub.LoadWithPrefix(fake, "/prod", &cfg)
+		Expect(err).To(BeAssignableToTypeOf(&credhub.LoadError{}))
+
+		errs := err.(*credhub.LoadError).Errors
+		Expect(errs).To(HaveLen(6))
+		Expect(errs).To(HaveKey("Missing"))
+		Expect(errs["Field"]).To(MatchError(`/prod/db: credential has no field "missing"`))
+		Expect(errs["Type"]).To(MatchError("/prod/db: expected a certificate credential, got user"))
+		Expect(errs).To(HaveKey("Cert"))
+		Expect(errs).To(HaveKey("NoName"))
+		Expect(errs).To(HaveKey("BadOpt"))
+		Expect(err.Error()).To(HavePrefix("unable to load credentials: BadOpt: "))
+
+		Expect(cfg.Username).To(Equal("me"))
+	})
+
+	it("requires a pointer to a struct", func() {
+		var cfg struct{}
+		Expect(credhub.Load(fake, cfg)).To(MatchError(ContainSubstring("expects a non-nil pointer to a struct")))
+	})
+}
+
+// countingAPI counts the calls to GetLatestByName
+type countingAPI struct {
+	credhub.API
+	gets int
+}
+
+func (c *countingAPI) GetLatestByName(name string) (*credhub.Credential, error) {
+	c.gets++
+	return c.API.GetLatestByName(name)
+}
@@ -36,6 +36,10 @@ func (c *Client) AddPermissions(credentialName string, newPerms []Permission) ([
 	}
 	defer resp.Body.Close()
 
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
+
 	var response permbody
 
 	decoder := json.NewDecoder(resp.Body)
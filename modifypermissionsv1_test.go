@@ -102,6 +102,21 @@ func testModifyPermissions(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("the server refuses the write", func() {
+			it.Before(func() {
+				chClient, err = credhub.New(server.URL+"/forbidden", getAuthenticatedClient(server.Client()))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			when("adding permissions", func() {
+				it("fails", func() {
+					p, err := chClient.AddPermissions("/add-permission-credential", []credhub.Permission{{Actor: "uaa-user:1234", Operations: []credhub.Operation{credhub.Read}}})
+					Expect(err).To(MatchError(HavePrefix("expected a 2xx response, got 403 Forbidden")))
+					Expect(p).To(BeNil())
+				})
+			})
+		})
+
 		when("invalid json is returned", func() {
 			it.Before(func() {
 				chClient, err = credhub.New(server.URL+"/badjson", getAuthenticatedClient(server.Client()))
@@ -10,15 +10,19 @@ import (
 
 // UAAEndpoint will get the info about the UAA server associated with the specified Credhub
 func UAAEndpoint(credhubURL string, skipTLSVerify bool) (oauth2.Endpoint, error) {
-	endpoint := oauth2.Endpoint{}
-
 	baseClient := &http.Client{
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: skipTLSVerify},
 		},
 	}
 
-	r, err := baseClient.Get(credhubURL + "/info")
+	return uaaEndpoint(baseClient, credhubURL)
+}
+
+func uaaEndpoint(hc HTTPClient, credhubURL string) (oauth2.Endpoint, error) {
+	endpoint := oauth2.Endpoint{}
+
+	r, err := hc.Get(credhubURL + "/info")
 	if err != nil {
 		return endpoint, err
 	}
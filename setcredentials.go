@@ -42,6 +42,10 @@ func (c *Client) Set(credential Credential, mode OverwriteMode, additionalPermis
 	}
 	defer resp.Body.Close()
 
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
+
 	cred := new(Credential)
 	unmarshaller := json.NewDecoder(resp.Body)
 	err = unmarshaller.Decode(&cred)
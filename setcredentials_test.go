@@ -125,6 +125,16 @@ func testSetCredentials(t *testing.T, when spec.G, it spec.S) {
 				Expect(cred).To(BeNil())
 			})
 		})
+
+		when("the server refuses the write", func() {
+			it("fails", func() {
+				chClient, err = credhub.New(server.URL+"/forbidden", getAuthenticatedClient(server.Client()))
+				Expect(err).NotTo(HaveOccurred())
+				cred, err := chClient.Set(credhub.Credential{Name: "/sample-set", Type: credhub.Value, Value: "v"}, credhub.Overwrite, nil)
+				Expect(err).To(MatchError(HavePrefix("expected a 2xx response, got 403 Forbidden: The request could not be completed")))
+				Expect(cred).To(BeNil())
+			})
+		})
 	})
 }
 
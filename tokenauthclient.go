@@ -0,0 +1,65 @@
+package credhub
+
+import (
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+/*
+
+NewTokenAuthClient creates a TokenAuthClient, which authenticates every request
+with a token from the given oauth2.TokenSource.
+
+Example usage:
+
+	cfg := &clientcredentials.Config{
+		ClientID:     "client-name",
+		ClientSecret: "client-secret",
+		TokenURL:     "https://uaa.service.cf.internal:8443/oauth/token",
+	}
+
+	client := NewTokenAuthClient(http.DefaultClient, cfg.TokenSource(context.Background()))
+
+The token source is asked for a token on every request, so it should cache
+tokens until they expire; wrap it with oauth2.ReuseTokenSource if it does not.
+See the uaa subpackage for a token source backed by code.cloudfoundry.org/uaa-go-client.
+
+*/
+func NewTokenAuthClient(hc HTTPClient, ts oauth2.TokenSource) HTTPClient {
+	return &TokenAuthClient{
+		hc: hc,
+		ts: ts,
+	}
+}
+
+// TokenAuthClient is a thin wrapper around an http.Client
+// that handles authenticating with tokens provided by
+// an oauth2.TokenSource.
+type TokenAuthClient struct {
+	hc HTTPClient
+	ts oauth2.TokenSource
+}
+
+// Get will do an HTTP Request to the specified URL using the HTTP GET method
+func (c *TokenAuthClient) Get(url string) (resp *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// Do will perform the HTTP Request specified with the underlying HTTPClient
+func (c *TokenAuthClient) Do(req *http.Request) (*http.Response, error) {
+	return c.do(req)
+}
+
+func (c *TokenAuthClient) do(req *http.Request) (*http.Response, error) {
+	token, err := c.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("authorization", "bearer "+token.AccessToken)
+	return c.hc.Do(req)
+}
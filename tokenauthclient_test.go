@@ -0,0 +1,57 @@
+package credhub_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"golang.org/x/oauth2"
+)
+
+type headerCheckingClient struct {
+	t *testing.T
+}
+
+func (c *headerCheckingClient) Get(url string) (resp *http.Response, err error) { return nil, nil }
+func (c *headerCheckingClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("authorization") != "bearer static-token" {
+		c.t.Fatalf("expected the token to be injected, got %q", req.Header.Get("authorization"))
+	}
+	return nil, nil
+}
+
+type failingTokenSource struct{}
+
+func (s *failingTokenSource) Token() (*oauth2.Token, error) {
+	return nil, errors.New("no token for you")
+}
+
+func TestTokenAuthClient_Get(t *testing.T) {
+	client := credhub.NewTokenAuthClient(&headerCheckingClient{t}, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "static-token"}))
+
+	if _, err := client.Get("http://does.not.matter.com"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenAuthClient_Do(t *testing.T) {
+	client := credhub.NewTokenAuthClient(&headerCheckingClient{t}, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "static-token"}))
+
+	req, err := http.NewRequest("GET", "http://does.not.matter.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenAuthClient_TokenError(t *testing.T) {
+	client := credhub.NewTokenAuthClient(&headerCheckingClient{t}, &failingTokenSource{})
+
+	if _, err := client.Get("http://does.not.matter.com"); err == nil {
+		t.Fatal("error should have occurred")
+	}
+}
@@ -223,3 +223,31 @@ func CertificateValue(cred Credential) (CertificateValueType, error) {
 		return def, errors.New(`only "certificate" type credentials have CertificateValueType values`)
 	}
 }
+
+// computedFields are the fields of credential values that Credhub computes
+// itself, and won't accept when a credential is set
+var computedFields = map[CredentialType]string{
+	User: "password_hash",
+	SSH:  "public_key_fingerprint",
+}
+
+// SettableValue returns the value of a credential without the fields that
+// Credhub computes (the password_hash of user credentials and the
+// public_key_fingerprint of ssh credentials), so that it can be set on another
+// credential or server. The credential's value is not modified.
+func SettableValue(cred Credential) interface{} {
+	field, computed := computedFields[cred.Type]
+	m, isMap := cred.Value.(map[string]interface{})
+	if !computed || !isMap {
+		return cred.Value
+	}
+
+	value := make(map[string]interface{}, len(m))
+	for key, v := range m {
+		if key != field {
+			value[key] = v
+		}
+	}
+
+	return value
+}
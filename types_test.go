@@ -0,0 +1,38 @@
+package credhub_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+func TestSettableValue(t *testing.T) {
+	spec.Run(t, "SettableValue", testSettableValue, spec.Report(report.Terminal{}))
+}
+
+func testSettableValue(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	it("removes the fields that Credhub computes", func() {
+		user := credhub.Credential{Type: credhub.User, Value: map[string]interface{}{"username": "me", "password": "pw", "password_hash": "hash"}}
+		Expect(credhub.SettableValue(user)).To(Equal(map[string]interface{}{"username": "me", "password": "pw"}))
+		Expect(user.Value).To(HaveKey("password_hash"))
+
+		ssh := credhub.Credential{Type: credhub.SSH, Value: map[string]interface{}{"private_key": "key", "public_key_fingerprint": "fp"}}
+		Expect(credhub.SettableValue(ssh)).To(Equal(map[string]interface{}{"private_key": "key"}))
+	})
+
+	it("leaves other values alone", func() {
+		json := credhub.Credential{Type: credhub.JSON, Value: map[string]interface{}{"password_hash": "mine"}}
+		Expect(credhub.SettableValue(json)).To(Equal(json.Value))
+
+		value := credhub.Credential{Type: credhub.Value, Value: "value"}
+		Expect(credhub.SettableValue(value)).To(Equal("value"))
+	})
+}
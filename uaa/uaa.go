@@ -0,0 +1,65 @@
+/*
+Package uaa adapts code.cloudfoundry.org/uaa-go-client for use with credhub.NewTokenAuthClient.
+It lives in its own package so that users of the credhub package that do not
+need it are not forced to depend on the UAA client and its dependencies.
+*/
+package uaa
+
+import (
+	uaaclient "code.cloudfoundry.org/uaa-go-client"
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"golang.org/x/oauth2"
+)
+
+/*
+
+NewAuthClient creates a credhub.HTTPClient that authenticates requests with
+tokens fetched from a UAA client.
+
+Example usage:
+
+	cfg := &config.Config{
+		ClientName:       "client-name",
+		ClientSecret:     "client-secret",
+		UaaEndpoint:      "https://uaa.service.cf.internal:8443",
+		SkipVerification: true,
+	}
+
+	uaaClient, err = client.NewClient(logger, cfg, clock)
+	if err != nil {
+		...
+	}
+
+	client := uaa.NewAuthClient(http.DefaultClient, uaaClient)
+
+See github.com/cloudfoundry-community/uaa-go-client for more examples of instantiating the UAA client.
+
+*/
+func NewAuthClient(hc credhub.HTTPClient, uc uaaclient.Client) credhub.HTTPClient {
+	return credhub.NewTokenAuthClient(hc, NewTokenSource(uc))
+}
+
+// NewTokenSource creates an oauth2.TokenSource that fetches tokens from a UAA
+// client.
+func NewTokenSource(uc uaaclient.Client) oauth2.TokenSource {
+	return &tokenSource{uc: uc}
+}
+
+type tokenSource struct {
+	uc uaaclient.Client
+}
+
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	// FetchToken has internal logic where if the token isn't expired,
+	// it'll pull a cached one; otherwise it'll make a remote call to
+	// get a valid current one.
+	token, err := s.uc.FetchToken(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   "bearer",
+	}, nil
+}
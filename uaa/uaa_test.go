@@ -1,4 +1,4 @@
-package credhub_test
+package uaa_test
 
 import (
 	"errors"
@@ -10,12 +10,13 @@ import (
 
 	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/lager/lagertest"
-	uaa "code.cloudfoundry.org/uaa-go-client"
+	uaaclient "code.cloudfoundry.org/uaa-go-client"
 	"code.cloudfoundry.org/uaa-go-client/config"
 	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/uaa"
 )
 
-func TestUAAAuthedClient_Get(t *testing.T) {
+func TestAuthClient_Get(t *testing.T) {
 	ts := uaaTestServer()
 	defer ts.Close()
 
@@ -26,7 +27,7 @@ func TestUAAAuthedClient_Get(t *testing.T) {
 	}
 }
 
-func TestUAAAuthedClient_Do(t *testing.T) {
+func TestAuthClient_Do(t *testing.T) {
 	ts := uaaTestServer()
 	defer ts.Close()
 
@@ -79,11 +80,11 @@ func testUAAAuthClient(t *testing.T, url string) credhub.HTTPClient {
 
 	clock := fakeclock.NewFakeClock(time.Now())
 	logger := lagertest.NewTestLogger("test")
-	uaaClient, err := uaa.NewClient(logger, cfg, clock)
+	uaaClient, err := uaaclient.NewClient(logger, cfg, clock)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	fake := &fakeClient{}
-	return credhub.NewUAAAuthClient(fake, uaaClient)
+	return uaa.NewAuthClient(fake, uaaClient)
 }
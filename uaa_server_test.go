@@ -13,6 +13,17 @@ func mockUaaServer() *httptest.Server {
 				return
 			}
 
+			if r.FormValue("grant_type") == "refresh_token" {
+				if r.FormValue("refresh_token") != "refresh-me" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				w.Header().Add("content-type", "application/json")
+				w.Write([]byte(`{"access_token": "abcd", "refresh_token": "refreshed"}`))
+				return
+			}
+
 			if r.FormValue("grant_type") != "client_credentials" {
 				w.WriteHeader(http.StatusBadRequest)
 				return
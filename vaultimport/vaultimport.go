@@ -0,0 +1,424 @@
+/*
+Package vaultimport imports secrets exported from the KV secrets engine of
+HashiCorp Vault into Credhub.
+
+Two kinds of export files are read. The first is the output of "vault kv get
+-format=json" (or "vault read -format=json") for a single secret, from either
+version of the KV engine; the secret's path is the file's path, relative to the
+directory being read and without the ".json" extension:
+
+	{
+	  "request_id": "...",
+	  "data": {
+	    "data": {"username": "admin", "password": "hunter2"},
+	    "metadata": {"version": 3, ...}
+	  }
+	}
+
+The second is a single object of many secrets, keyed by their paths, as written
+by most export scripts. The secrets can be plain objects, or have the "data"
+and "metadata" of a KV v2 secret:
+
+	{
+	  "concourse/main/db": {"username": "admin", "password": "hunter2"},
+	  "concourse/main/token": {"value": "abc123"}
+	}
+
+Example usage:
+
+	secrets, err := vaultimport.ReadDir("vault-export")
+	if err != nil {
+		...
+	}
+
+	results := vaultimport.Import(client, secrets, vaultimport.Options{
+		Trim:   "secret/",
+		Prefix: "/vault",
+	})
+
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%s: %v\n", result.Path, result.Err)
+		}
+	}
+
+*/
+package vaultimport
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+)
+
+// Secret is a single secret read from an export file
+type Secret struct {
+	// Path is the path of the secret in Vault
+	Path string
+
+	// Data is the key/value pairs of the secret. It is nil if the secret's
+	// latest version has been deleted.
+	Data map[string]interface{}
+}
+
+// Options control how secrets are mapped to credentials, and imported
+type Options struct {
+	// Trim is removed from the start of the path of every secret, e.g. the
+	// mount "secret/", or "secret/data/" for paths of the KV v2 API. Secrets
+	// whose paths don't start with it are not imported.
+	Trim string
+
+	// Prefix is the path the credentials are imported under, e.g. "/vault".
+	// The default is "/".
+	Prefix string
+
+	// DryRun maps every secret without setting any credentials
+	DryRun bool
+
+	// Mode is passed to Set. Leave it empty to overwrite existing credentials.
+	Mode credhub.OverwriteMode
+}
+
+// Result is the outcome of importing a single secret
+type Result struct {
+	// Path is the path of the secret in Vault
+	Path string
+
+	// Name and Type are the credential the secret was mapped to
+	Name string
+	Type credhub.CredentialType
+
+	// Err is why the secret could not be mapped or imported, or nil if it was
+	// (or, in a dry run, would have been)
+	Err error
+}
+
+// responseFields are the top level fields of the responses of the Vault API,
+// which tell a single secret from an object of secrets keyed by path
+var responseFields = map[string]bool{
+	"request_id":     true,
+	"lease_id":       true,
+	"lease_duration": true,
+	"renewable":      true,
+	"data":           true,
+	"warnings":       true,
+	"wrap_info":      true,
+	"auth":           true,
+	"mount_type":     true,
+}
+
+// validName matches the names that Credhub accepts
+var validName = regexp.MustCompile(`^/[A-Za-z0-9_\-./:]+$`)
+
+// ReadFile reads the secrets in an export file. The path of a single secret is
+// the name of the file, without the ".json" extension.
+func ReadFile(filename string) ([]Secret, error) {
+	return readFile(filename, strings.TrimSuffix(filepath.Base(filename), ".json"))
+}
+
+// ReadDir reads the secrets in every ".json" file under dir, in order of path
+func ReadDir(dir string) ([]Secret, error) {
+	var secrets []Secret
+
+	err := filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(filename) != ".json" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+
+		s, err := readFile(filename, filepath.ToSlash(strings.TrimSuffix(rel, ".json")))
+		if err != nil {
+			return err
+		}
+
+		secrets = append(secrets, s...)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return secrets[i].Path < secrets[j].Path
+	})
+
+	return secrets, nil
+}
+
+func readFile(filename, secretPath string) ([]Secret, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := Parse(buf, secretPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return secrets, nil
+}
+
+/*
+
+Parse reads the secrets in the contents of an export file. secretPath is the
+path of the secret if the file has a single secret, and is ignored otherwise.
+
+A file is taken to have a single secret if it has a "data" object, and no
+fields other than those of a response from the Vault API, so an object of
+secrets that has one at the path "data" must have other secrets too.
+
+*/
+func Parse(buf []byte, secretPath string) ([]Secret, error) {
+	var file map[string]interface{}
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, err
+	}
+
+	if isResponse(file) {
+		return []Secret{{Path: secretPath, Data: secretData(file["data"].(map[string]interface{}))}}, nil
+	}
+
+	secrets := make([]Secret, 0, len(file))
+	for p, v := range file {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			secrets = append(secrets, Secret{Path: p, Data: secretData(t)})
+		case nil:
+			secrets = append(secrets, Secret{Path: p})
+		default:
+			return nil, fmt.Errorf("the secret at %s is not an object", p)
+		}
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Path < secrets[j].Path
+	})
+
+	return secrets, nil
+}
+
+// isResponse returns true if a file is a single secret read from the Vault API
+func isResponse(file map[string]interface{}) bool {
+	if _, ok := file["data"].(map[string]interface{}); !ok {
+		return false
+	}
+
+	for key := range file {
+		if !responseFields[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// secretData returns the key/value pairs of a secret, unwrapping those of a
+// KV v2 secret from its data and metadata
+func secretData(data map[string]interface{}) map[string]interface{} {
+	if len(data) != 2 {
+		return data
+	}
+
+	if _, ok := data["metadata"].(map[string]interface{}); !ok {
+		return data
+	}
+
+	switch inner := data["data"].(type) {
+	case map[string]interface{}:
+		return inner
+	case nil:
+		if _, ok := data["data"]; ok {
+			return nil
+		}
+	}
+
+	return data
+}
+
+/*
+
+Import maps each secret to a credential, and sets it. A secret that can't be
+mapped or set does not stop the others from being imported; the result of each
+is returned, in the order of secrets.
+
+Secrets are mapped to credentials named Prefix plus their path (without Trim),
+of a type inferred from their keys:
+
+	value        a single "value" key with a string value
+	user         "username" and "password" keys with string values, and no others
+	certificate  PEM values for a certificate and optionally its private key and
+	             CA, under any keys; the CA's key must contain "ca"
+	json         anything else
+
+A secret can't be mapped if its path doesn't start with Trim, if its path
+doesn't make a valid Credhub name, if it maps to the same name as another secret,
+or if it has no data.
+
+*/
+func Import(c credhub.API, secrets []Secret, opts Options) []Result {
+	mode := opts.Mode
+	if mode == "" {
+		mode = credhub.Overwrite
+	}
+
+	paths := make(map[string]string, len(secrets))
+	results := make([]Result, 0, len(secrets))
+	for _, secret := range secrets {
+		result := Result{Path: secret.Path}
+
+		cred, err := Map(secret, opts)
+		result.Name, result.Type = cred.Name, cred.Type
+
+		if err == nil && paths[cred.Name] != "" {
+			err = fmt.Errorf("%s is also mapped to %s", paths[cred.Name], cred.Name)
+		}
+
+		switch {
+		case err != nil:
+			result.Err = err
+		case !opts.DryRun:
+			_, result.Err = c.Set(cred, mode, nil)
+		}
+
+		if cred.Name != "" && paths[cred.Name] == "" {
+			paths[cred.Name] = secret.Path
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Map returns the credential that a secret is imported as; see Import
+func Map(secret Secret, opts Options) (credhub.Credential, error) {
+	var cred credhub.Credential
+
+	p := strings.Trim(secret.Path, "/")
+	if trim := strings.Trim(opts.Trim, "/"); trim != "" {
+		if p != trim && !strings.HasPrefix(p, trim+"/") {
+			return cred, fmt.Errorf("the path is not under %s", opts.Trim)
+		}
+		p = strings.TrimPrefix(strings.TrimPrefix(p, trim), "/")
+	}
+
+	if p == "" {
+		return cred, errors.New("the path is empty")
+	}
+
+	name := path.Join("/", opts.Prefix, p)
+	if !validName.MatchString(name) || strings.Contains(p, "//") {
+		return cred, fmt.Errorf("%q is not a valid credential name", name)
+	}
+	cred.Name = name
+
+	switch {
+	case secret.Data == nil:
+		return cred, errors.New("the secret has been deleted")
+	case len(secret.Data) == 0:
+		return cred, errors.New("the secret has no data")
+	}
+
+	cred.Type, cred.Value = infer(secret.Data)
+	return cred, nil
+}
+
+// infer returns the type of credential for the data of a secret, and its value
+func infer(data map[string]interface{}) (credhub.CredentialType, interface{}) {
+	strs := make(map[string]string, len(data))
+	for key, v := range data {
+		if s, ok := v.(string); ok {
+			strs[key] = s
+		}
+	}
+
+	if len(strs) != len(data) {
+		return credhub.JSON, data
+	}
+
+	if v, ok := strs["value"]; ok && len(strs) == 1 {
+		return credhub.Value, v
+	}
+
+	_, hasUsername := strs["username"]
+	_, hasPassword := strs["password"]
+	if hasUsername && hasPassword && len(strs) == 2 {
+		return credhub.User, map[string]interface{}{"username": strs["username"], "password": strs["password"]}
+	}
+
+	if cert, ok := certificate(strs); ok {
+		return credhub.Certificate, cert
+	}
+
+	return credhub.JSON, data
+}
+
+// certificate returns the value of a certificate credential if every value is
+// PEM, and they are a single certificate, and optionally its key and CA
+func certificate(strs map[string]string) (map[string]interface{}, bool) {
+	cert := make(map[string]interface{}, 3)
+
+	for key, s := range strs {
+		block, _ := pem.Decode([]byte(s))
+		if block == nil {
+			return nil, false
+		}
+
+		var field string
+		switch {
+		case block.Type == "CERTIFICATE" && isCA(key):
+			field = "ca"
+		case block.Type == "CERTIFICATE":
+			field = "certificate"
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			field = "private_key"
+		default:
+			return nil, false
+		}
+
+		if _, ok := cert[field]; ok {
+			return nil, false
+		}
+		cert[field] = s
+	}
+
+	if _, ok := cert["certificate"]; !ok {
+		return nil, false
+	}
+
+	return cert, true
+}
+
+// isCA returns true if a key names a CA certificate, e.g. "ca", "ca_cert",
+// "issuing_ca" or "ca.crt"
+func isCA(key string) bool {
+	for _, word := range strings.FieldsFunc(strings.ToLower(key), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	}) {
+		if word == "ca" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,235 @@
+package vaultimport_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+	"github.com/cloudfoundry-community/go-credhub/vaultimport"
+	. "github.com/onsi/gomega"
+)
+
+func TestVaultImport(t *testing.T) {
+	spec.Run(t, "VaultImport", testVaultImport, spec.Report(report.Terminal{}))
+}
+
+const kv1Secret = `{
+  "request_id": "0ab2c5ff-f1e5-6d3e-3cbc-6f4b2c1e0a6e",
+  "lease_id": "",
+  "lease_duration": 2764800,
+  "renewable": false,
+  "data": {"username": "admin", "password": "hunter2"},
+  "warnings": null
+}`
+
+const kv2Secret = `{
+  "request_id": "c2e1f4b0-7b7e-4d6a-9a0c-3c0f2e6f2a51",
+  "lease_id": "",
+  "lease_duration": 0,
+  "renewable": false,
+  "data": {
+    "data": {"value": "abc123"},
+    "metadata": {"created_time": "2019-03-01T10:00:00Z", "deletion_time": "", "destroyed": false, "version": 3}
+  },
+  "warnings": null
+}`
+
+const exportFile = `{
+  "secret/app/config": {"hosts": ["a", "b"], "retries": 3},
+  "secret/app/db": {
+    "data": {"username": "app", "password": "secret"},
+    "metadata": {"version": 1}
+  },
+  "secret/app/deleted": {
+    "data": null,
+    "metadata": {"version": 2, "deletion_time": "2019-03-01T10:00:00Z"}
+  },
+  "secret/app/empty": {},
+  "secret/app/bad name": {"value": "x"},
+  "other/thing": {"value": "y"}
+}`
+
+func testVaultImport(t *testing.T, when spec.G, it spec.S) {
+	var fake *credhubtest.FakeClient
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		fake = credhubtest.NewFakeClient(credhubtest.Version2)
+	})
+
+	when("parsing", func() {
+		it("reads a single KV v1 secret", func() {
+			secrets, err := vaultimport.Parse([]byte(kv1Secret), "app/db")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets).To(Equal([]vaultimport.Secret{
+				{Path: "app/db", Data: map[string]interface{}{"username": "admin", "password": "hunter2"}},
+			}))
+		})
+
+		it("reads a single KV v2 secret", func() {
+			secrets, err := vaultimport.Parse([]byte(kv2Secret), "app/token")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets).To(Equal([]vaultimport.Secret{
+				{Path: "app/token", Data: map[string]interface{}{"value": "abc123"}},
+			}))
+		})
+
+		it("reads objects of secrets keyed by path", func() {
+			secrets, err := vaultimport.Parse([]byte(exportFile), "ignored")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets).To(HaveLen(6))
+			Expect(secrets[0].Path).To(Equal("other/thing"))
+			Expect(secrets[3].Path).To(Equal("secret/app/db"))
+			Expect(secrets[3].Data).To(Equal(map[string]interface{}{"username": "app", "password": "secret"}))
+			Expect(secrets[4].Path).To(Equal("secret/app/deleted"))
+			Expect(secrets[4].Data).To(BeNil())
+		})
+
+		it("rejects secrets that aren't objects", func() {
+			_, err := vaultimport.Parse([]byte(`{"a": "b"}`), "")
+			Expect(err).To(MatchError("the secret at a is not an object"))
+
+			_, err = vaultimport.Parse([]byte(`[]`), "")
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("reads directories of export files", func() {
+			dir, err := ioutil.TempDir("", "vaultimport")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			Expect(os.MkdirAll(filepath.Join(dir, "app"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "app", "db.json"), []byte(kv1Secret), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "token.json"), []byte(kv2Secret), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not json"), 0600)).To(Succeed())
+
+			secrets, err := vaultimport.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets).To(HaveLen(2))
+			Expect(secrets[0].Path).To(Equal("app/db"))
+			Expect(secrets[1].Path).To(Equal("token"))
+
+			secrets, err = vaultimport.ReadFile(filepath.Join(dir, "token.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secrets[0].Path).To(Equal("token"))
+		})
+	})
+
+	when("mapping", func() {
+		mapped := func(data map[string]interface{}) credhub.Credential {
+			cred, err := vaultimport.Map(vaultimport.Secret{Path: "secret/x", Data: data}, vaultimport.Options{})
+			Expect(err).NotTo(HaveOccurred())
+			return cred
+		}
+
+		it("infers the type of credential", func() {
+			Expect(mapped(map[string]interface{}{"value": "v"})).To(Equal(credhub.Credential{Name: "/secret/x", Type: credhub.Value, Value: "v"}))
+			Expect(mapped(map[string]interface{}{"username": "u", "password": "p"}).Type).To(Equal(credhub.User))
+			Expect(mapped(map[string]interface{}{"username": "u", "password": "p", "port": "5432"}).Type).To(Equal(credhub.JSON))
+			Expect(mapped(map[string]interface{}{"value": 5.0}).Type).To(Equal(credhub.JSON))
+			Expect(mapped(map[string]interface{}{"token": "t"}).Type).To(Equal(credhub.JSON))
+		})
+
+		it("infers certificates from PEM values", func() {
+			cert, err := ioutil.ReadFile("../testdata/tls/cert")
+			Expect(err).NotTo(HaveOccurred())
+			key, err := ioutil.ReadFile("../testdata/tls/key")
+			Expect(err).NotTo(HaveOccurred())
+
+			cred := mapped(map[string]interface{}{"tls.crt": string(cert), "tls.key": string(key), "ca.crt": string(cert)})
+			Expect(cred.Type).To(Equal(credhub.Certificate))
+			Expect(cred.Value).To(Equal(map[string]interface{}{
+				"certificate": string(cert),
+				"private_key": string(key),
+				"ca":          string(cert),
+			}))
+
+			Expect(mapped(map[string]interface{}{"cert": string(cert)}).Type).To(Equal(credhub.Certificate))
+			Expect(mapped(map[string]interface{}{"key": string(key)}).Type).To(Equal(credhub.JSON))
+			Expect(mapped(map[string]interface{}{"a": string(cert), "b": string(cert)}).Type).To(Equal(credhub.JSON))
+			Expect(mapped(map[string]interface{}{"cert": string(cert), "note": "x"}).Type).To(Equal(credhub.JSON))
+		})
+
+		it("maps paths under the prefix", func() {
+			opts := vaultimport.Options{Trim: "secret/data/", Prefix: "/vault"}
+
+			cred, err := vaultimport.Map(vaultimport.Secret{Path: "secret/data/app/db", Data: map[string]interface{}{"value": "v"}}, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cred.Name).To(Equal("/vault/app/db"))
+
+			_, err = vaultimport.Map(vaultimport.Secret{Path: "secret/database", Data: map[string]interface{}{"value": "v"}}, opts)
+			Expect(err).To(MatchError("the path is not under secret/data/"))
+
+			_, err = vaultimport.Map(vaultimport.Secret{Path: "secret/data/", Data: map[string]interface{}{"value": "v"}}, opts)
+			Expect(err).To(MatchError("the path is empty"))
+		})
+	})
+
+	when("importing", func() {
+		it("sets the secrets it can map, and reports the rest", func() {
+			secrets, err := vaultimport.Parse([]byte(exportFile), "")
+			Expect(err).NotTo(HaveOccurred())
+			secrets = append(secrets, vaultimport.Secret{Path: "/secret/app/db/", Data: map[string]interface{}{"value": "dup"}})
+
+			results := vaultimport.Import(fake, secrets, vaultimport.Options{Trim: "secret", Prefix: "/vault"})
+			Expect(results).To(HaveLen(7))
+
+			errs := make(map[string]string)
+			for _, result := range results {
+				if result.Err != nil {
+					errs[result.Path] = result.Err.Error()
+				}
+			}
+			Expect(errs).To(Equal(map[string]string{
+				"other/thing":         "the path is not under secret",
+				"secret/app/bad name": `"/vault/app/bad name" is not a valid credential name`,
+				"secret/app/deleted":  "the secret has been deleted",
+				"secret/app/empty":    "the secret has no data",
+				"/secret/app/db/":     "secret/app/db is also mapped to /vault/app/db",
+			}))
+
+			db, err := fake.GetLatestByName("/vault/app/db")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(db.Type).To(Equal(credhub.User))
+			Expect(db.Value).To(HaveKeyWithValue("password", "secret"))
+
+			config, err := fake.GetLatestByName("/vault/app/config")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Type).To(Equal(credhub.JSON))
+			Expect(config.Value).To(HaveKeyWithValue("retries", 3.0))
+		})
+
+		it("doesn't set anything in a dry run", func() {
+			results := vaultimport.Import(fake, []vaultimport.Secret{{Path: "a", Data: map[string]interface{}{"value": "v"}}}, vaultimport.Options{DryRun: true})
+			Expect(results).To(Equal([]vaultimport.Result{{Path: "a", Name: "/a", Type: credhub.Value}}))
+
+			_, err := fake.GetLatestByName("/a")
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("reports errors from setting credentials", func() {
+			fake.Seed(credhub.Credential{Name: "/a", Type: credhub.Password, Value: "p"})
+
+			results := vaultimport.Import(fake, []vaultimport.Secret{{Path: "a", Data: map[string]interface{}{"value": "v"}}}, vaultimport.Options{})
+			Expect(results[0].Err).To(HaveOccurred())
+		})
+
+		it("reports writes the server rejects", func() {
+			server := credhubtest.NewServer(credhubtest.Version2)
+			defer server.Close()
+			server.Seed(credhub.Credential{Name: "/a", Type: credhub.Password, Value: "p"})
+
+			client, err := server.NewClient()
+			Expect(err).NotTo(HaveOccurred())
+
+			results := vaultimport.Import(client, []vaultimport.Secret{{Path: "a", Data: map[string]interface{}{"value": "v"}}}, vaultimport.Options{})
+			Expect(results[0].Err).To(MatchError(ContainSubstring("got 400 Bad Request: The credential type cannot be modified")))
+		})
+	})
+}
@@ -0,0 +1,293 @@
+package credhub
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CredentialChangeType is how a watched credential changed
+type CredentialChangeType string
+
+const (
+	// CredentialCreated is sent when a credential is created after the watch
+	// started
+	CredentialCreated CredentialChangeType = "created"
+	// CredentialUpdated is sent when a credential has a new latest version
+	CredentialUpdated CredentialChangeType = "updated"
+	// CredentialDeleted is sent when a credential is deleted
+	CredentialDeleted CredentialChangeType = "deleted"
+)
+
+// CredentialChange is a change to a watched credential, or an error from
+// polling for changes
+type CredentialChange struct {
+	Type CredentialChangeType
+	Name string
+
+	// Credential is the new latest version, or nil if the credential was
+	// deleted
+	Credential *Credential
+
+	// Previous is the version before the change, or nil if the credential
+	// was created
+	Previous *Credential
+
+	// Err is set, and the other fields are not, if a poll failed. Polling is
+	// retried with backoff.
+	Err error
+}
+
+// WatchOptions control which credentials are watched, and how often they are
+// polled
+type WatchOptions struct {
+	// Names are the names of the credentials to watch
+	Names []string
+
+	// Path watches every credential under a path, e.g. "/concourse"
+	Path string
+
+	// Interval is the time between polls. The default is 30 seconds.
+	Interval time.Duration
+
+	// Jitter is the most that is randomly added to each interval, so that
+	// many watchers don't poll at the same time
+	Jitter time.Duration
+
+	// MaxBackoff is the longest interval after polls fail, which is doubled
+	// after each failure. The default is 5 minutes, or Interval if it is
+	// longer.
+	MaxBackoff time.Duration
+
+	// After returns a channel that receives once a duration has passed, and
+	// is used to wait between polls. The default is time.After.
+	After func(time.Duration) <-chan time.Time
+}
+
+// Watcher polls Credhub for changes to credentials
+type Watcher struct {
+	c       API
+	opts    WatchOptions
+	changes chan CredentialChange
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	// seen is the latest version of each credential from the last poll
+	seen map[string]*Credential
+}
+
+/*
+
+NewWatcher starts polling for changes to credentials, by their names or a path
+or both, and sends them on the channel returned by Changes. The first poll finds
+the credentials that exist, and the changes after it are sent: a credential is
+updated when the ID of its latest version changes.
+
+Example usage:
+
+	w, err := credhub.NewWatcher(client, credhub.WatchOptions{
+		Path:     "/concourse/main",
+		Interval: time.Minute,
+		Jitter:   10 * time.Second,
+	})
+	if err != nil {
+		...
+	}
+	defer w.Stop()
+
+	for change := range w.Changes() {
+		if change.Err != nil {
+			log.Println(change.Err)
+			continue
+		}
+
+		fmt.Printf("%s was %s\n", change.Name, change.Type)
+	}
+
+*/
+func NewWatcher(c API, opts WatchOptions) (*Watcher, error) {
+	if len(opts.Names) == 0 && opts.Path == "" {
+		return nil, errors.New("names or a path to watch are required")
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+
+	if opts.MaxBackoff < opts.Interval {
+		opts.MaxBackoff = opts.Interval
+	}
+
+	if opts.After == nil {
+		opts.After = time.After
+	}
+
+	w := &Watcher{
+		c:       c,
+		opts:    opts,
+		changes: make(chan CredentialChange),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Watch starts a Watcher for credentials by name, with the default options
+func Watch(c API, names ...string) (*Watcher, error) {
+	return NewWatcher(c, WatchOptions{Names: names})
+}
+
+// Changes returns the channel that changes are sent on. It is closed once the
+// watcher is stopped.
+func (w *Watcher) Changes() <-chan CredentialChange {
+	return w.changes
+}
+
+// Stop stops polling, and waits for the watcher to finish
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer close(w.changes)
+
+	failures := 0
+	for {
+		changes, err := w.poll()
+		for _, change := range changes {
+			if !w.send(change) {
+				return
+			}
+		}
+
+		delay := w.opts.Interval
+		if err != nil {
+			if !w.send(CredentialChange{Err: err}) {
+				return
+			}
+
+			failures++
+			for i := 0; i < failures && delay < w.opts.MaxBackoff; i++ {
+				delay *= 2
+			}
+			if delay > w.opts.MaxBackoff {
+				delay = w.opts.MaxBackoff
+			}
+		} else {
+			failures = 0
+		}
+
+		if w.opts.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(w.opts.Jitter)))
+		}
+
+		select {
+		case <-w.opts.After(delay):
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *Watcher) send(change CredentialChange) bool {
+	select {
+	case w.changes <- change:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
+// poll reads the latest version of every watched credential, and returns how
+// they changed since the last poll, in order of name. Credentials that can't be
+// read are left as they were, so a failed poll never reports them as deleted.
+func (w *Watcher) poll() ([]CredentialChange, error) {
+	names := make(map[string]struct{}, len(w.opts.Names))
+	for _, name := range w.opts.Names {
+		names[name] = struct{}{}
+	}
+
+	var pollErr error
+	if w.opts.Path != "" {
+		found, err := w.c.FindByPath(w.opts.Path)
+		if err != nil {
+			pollErr = err
+			for name := range w.seen {
+				names[name] = struct{}{}
+			}
+		}
+
+		for _, cred := range found {
+			names[cred.Name] = struct{}{}
+		}
+	}
+
+	errs := make(map[string]error)
+	values := resolveRefs(func(name string) (interface{}, error) {
+		return w.c.GetLatestByName(name)
+	}, names, errs)
+
+	latest := make(map[string]*Credential, len(values))
+	for name, value := range values {
+		latest[name] = value.(*Credential)
+	}
+
+	for name, err := range errs {
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		if prev, ok := w.seen[name]; ok {
+			latest[name] = prev
+		}
+		if pollErr == nil {
+			pollErr = err
+		}
+	}
+
+	if w.seen == nil {
+		if pollErr != nil {
+			return nil, pollErr
+		}
+
+		w.seen = latest
+		return nil, nil
+	}
+
+	var changes []CredentialChange
+	for name, cred := range latest {
+		prev, ok := w.seen[name]
+		switch {
+		case !ok:
+			changes = append(changes, CredentialChange{Type: CredentialCreated, Name: name, Credential: cred})
+		case prev.ID != cred.ID:
+			changes = append(changes, CredentialChange{Type: CredentialUpdated, Name: name, Credential: cred, Previous: prev})
+		}
+	}
+
+	for name, prev := range w.seen {
+		if _, ok := latest[name]; !ok {
+			changes = append(changes, CredentialChange{Type: CredentialDeleted, Name: name, Previous: prev})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	w.seen = latest
+	return changes, pollErr
+}
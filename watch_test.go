@@ -0,0 +1,203 @@
+package credhub_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	"github.com/cloudfoundry-community/go-credhub/credhubtest"
+)
+
+func TestWatch(t *testing.T) {
+	spec.Run(t, "Watch", testWatch, spec.Report(report.Terminal{}))
+}
+
+// failingAPI fails FindByPath while fail is set
+type failingAPI struct {
+	credhub.API
+
+	mu   sync.Mutex
+	fail error
+}
+
+func (f *failingAPI) FindByPath(path string) ([]credhub.Credential, error) {
+	f.mu.Lock()
+	err := f.fail
+	f.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.API.FindByPath(path)
+}
+
+func (f *failingAPI) failWith(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fail = err
+}
+
+func testWatch(t *testing.T, when spec.G, it spec.S) {
+	var (
+		fake  *credhubtest.FakeClient
+		clock *fakeclock.FakeClock
+		w     *credhub.Watcher
+	)
+
+	set := func(name, value string) *credhub.Credential {
+		cred, err := fake.Set(credhub.Credential{Name: name, Type: credhub.Value, Value: value}, credhub.Overwrite, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return cred
+	}
+
+	// waiting waits for the watcher to finish polling, so changes made after it
+	// are seen by the next poll
+	waiting := func() {
+		Eventually(clock.WatcherCount).Should(Equal(1))
+	}
+
+	next := func() credhub.CredentialChange {
+		var change credhub.CredentialChange
+		Eventually(w.Changes()).Should(Receive(&change))
+		return change
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		fake = credhubtest.NewFakeClient(credhubtest.Version2)
+		clock = fakeclock.NewFakeClock(time.Now())
+	})
+
+	it.After(func() {
+		if w != nil {
+			w.Stop()
+		}
+	})
+
+	it("requires names or a path", func() {
+		_, err := credhub.NewWatcher(fake, credhub.WatchOptions{})
+		Expect(err).To(MatchError("names or a path to watch are required"))
+	})
+
+	when("watching names", func() {
+		it("sends creates, updates and deletes", func() {
+			first := set("/a", "1")
+
+			var err error
+			w, err = credhub.NewWatcher(fake, credhub.WatchOptions{Names: []string{"/a", "/b"}, Interval: time.Second, After: clock.After})
+			Expect(err).NotTo(HaveOccurred())
+
+			waiting()
+			clock.Increment(time.Second)
+			Consistently(w.Changes()).ShouldNot(Receive())
+
+			waiting()
+			second := set("/a", "2")
+			set("/b", "b")
+			clock.Increment(time.Second)
+
+			change := next()
+			Expect(change.Type).To(Equal(credhub.CredentialUpdated))
+			Expect(change.Name).To(Equal("/a"))
+			Expect(change.Previous.ID).To(Equal(first.ID))
+			Expect(change.Credential.ID).To(Equal(second.ID))
+
+			change = next()
+			Expect(change.Type).To(Equal(credhub.CredentialCreated))
+			Expect(change.Name).To(Equal("/b"))
+			Expect(change.Previous).To(BeNil())
+			Expect(change.Credential.Value).To(Equal("b"))
+
+			waiting()
+			Expect(fake.Delete("/a")).To(Succeed())
+			clock.Increment(time.Second)
+
+			change = next()
+			Expect(change.Type).To(Equal(credhub.CredentialDeleted))
+			Expect(change.Name).To(Equal("/a"))
+			Expect(change.Credential).To(BeNil())
+			Expect(change.Previous.ID).To(Equal(second.ID))
+		})
+	})
+
+	when("watching a path", func() {
+		var api *failingAPI
+
+		it.Before(func() {
+			api = &failingAPI{API: fake}
+			set("/app/a", "1")
+			set("/other/b", "1")
+
+			var err error
+			w, err = credhub.NewWatcher(api, credhub.WatchOptions{Path: "/app", Interval: time.Second, MaxBackoff: 3 * time.Second, After: clock.After})
+			Expect(err).NotTo(HaveOccurred())
+			waiting()
+		})
+
+		it("sends changes under the path", func() {
+			set("/app/nested/c", "c")
+			set("/other/b", "2")
+			clock.Increment(time.Second)
+
+			change := next()
+			Expect(change.Type).To(Equal(credhub.CredentialCreated))
+			Expect(change.Name).To(Equal("/app/nested/c"))
+			Consistently(w.Changes()).ShouldNot(Receive())
+		})
+
+		it("backs off when polls fail", func() {
+			api.failWith(errors.New("boom"))
+			set("/app/a", "2")
+			clock.Increment(time.Second)
+
+			// credentials that were seen are still read
+			change := next()
+			Expect(change.Type).To(Equal(credhub.CredentialUpdated))
+			Expect(change.Name).To(Equal("/app/a"))
+			Expect(next().Err).To(MatchError("boom"))
+
+			waiting()
+			clock.Increment(time.Second)
+			Consistently(w.Changes()).ShouldNot(Receive())
+			clock.Increment(time.Second)
+			Expect(next().Err).To(MatchError("boom"))
+
+			// capped at MaxBackoff
+			waiting()
+			clock.Increment(2 * time.Second)
+			Consistently(w.Changes()).ShouldNot(Receive())
+			clock.Increment(time.Second)
+			Expect(next().Err).To(MatchError("boom"))
+
+			waiting()
+			api.failWith(nil)
+			set("/app/d", "d")
+			clock.Increment(3 * time.Second)
+			Expect(next().Name).To(Equal("/app/d"))
+
+			waiting()
+			set("/app/e", "e")
+			clock.Increment(time.Second)
+			Expect(next().Name).To(Equal("/app/e"))
+		})
+	})
+
+	it("closes the channel when stopped", func() {
+		var err error
+		w, err = credhub.Watch(fake, "/a")
+		Expect(err).NotTo(HaveOccurred())
+
+		w.Stop()
+		Eventually(w.Changes()).Should(BeClosed())
+	})
+}
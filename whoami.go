@@ -0,0 +1,61 @@
+package credhub
+
+import (
+	"errors"
+	"time"
+)
+
+// actorIdentifier is implemented by the HTTPClients in this package that know
+// which Credhub actor they authenticate as
+type actorIdentifier interface {
+	actor() (string, error)
+}
+
+// WhoAmI returns the actor that Credhub will identify this client as, e.g.
+// "uaa-client:<client id>", "uaa-user:<user guid>" or "mtls-app:<app guid>".
+// See https://github.com/cloudfoundry-incubator/credhub/blob/master/docs/authentication-identities.md
+// for more information on actor identities. This only works for clients that
+// were created with an HTTPClient from this package.
+func (c *Client) WhoAmI() (string, error) {
+	identifier, ok := c.hc.(actorIdentifier)
+	if !ok {
+		return "", errors.New("unable to determine the actor for this client's HTTPClient")
+	}
+
+	return identifier.actor()
+}
+
+func (c *TokenAuthClient) actor() (string, error) {
+	token, err := c.ts.Token()
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := tokenClaims(token.AccessToken)
+	if err != nil {
+		return "", err
+	}
+
+	clientID, _ := claims["client_id"].(string)
+	userID, _ := claims["user_id"].(string)
+
+	switch {
+	case claims["grant_type"] == "client_credentials" && clientID != "":
+		return "uaa-client:" + clientID, nil
+	case userID != "":
+		return "uaa-user:" + userID, nil
+	case clientID != "":
+		return "uaa-client:" + clientID, nil
+	default:
+		return "", errors.New("access token does not identify a UAA user or client")
+	}
+}
+
+func (c *CFAppAuthClient) actor() (string, error) {
+	identity, err := instanceIdentity(c.cert, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return identity.Actor(), nil
+}
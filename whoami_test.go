@@ -0,0 +1,192 @@
+package credhub_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"golang.org/x/oauth2"
+
+	credhub "github.com/cloudfoundry-community/go-credhub"
+	. "github.com/onsi/gomega"
+)
+
+// instanceIdentityCert generates a self-signed certificate shaped like a CF
+// instance identity certificate, returning its PEM encoding and that of its key
+func instanceIdentityCert(ous []string, notBefore, notAfter time.Time) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName:         "8b2d4c6a-1e3f-4a5b-9c7d-0e1f2a3b4c5d",
+			OrganizationalUnit: ous,
+		},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// mtlsVersionServer is a v2 versionServer that also asks for client certificates
+func mtlsVersionServer() *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": "2.0.2"}`)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+
+	return server
+}
+
+func TestWhoAmI(t *testing.T) {
+	spec.Run(t, "WhoAmI", testWhoAmI, spec.Report(report.Terminal{}))
+}
+
+func testWhoAmI(t *testing.T, when spec.G, it spec.S) {
+	var server *httptest.Server
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		server = mtlsVersionServer()
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	tokenClient := func(claims map[string]interface{}) *credhub.Client {
+		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: unsignedToken(claims)})
+		chClient, err := credhub.New(server.URL, credhub.NewTokenAuthClient(server.Client(), ts))
+		Expect(err).NotTo(HaveOccurred())
+		return chClient
+	}
+
+	when("authenticating with UAA", func() {
+		it("identifies a client", func() {
+			chClient := tokenClient(map[string]interface{}{
+				"grant_type": "client_credentials",
+				"client_id":  "my-client",
+			})
+
+			actor, err := chClient.WhoAmI()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actor).To(Equal("uaa-client:my-client"))
+		})
+
+		it("identifies a user", func() {
+			chClient := tokenClient(map[string]interface{}{
+				"grant_type": "password",
+				"client_id":  "credhub_cli",
+				"user_id":    "106f52e2-5d01-4675-8d7a-c05ff9a2c081",
+			})
+
+			actor, err := chClient.WhoAmI()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actor).To(Equal("uaa-user:106f52e2-5d01-4675-8d7a-c05ff9a2c081"))
+		})
+
+		it("fails when the token does not identify anyone", func() {
+			chClient := tokenClient(map[string]interface{}{"scope": []string{"credhub.read"}})
+
+			_, err := chClient.WhoAmI()
+			Expect(err).To(HaveOccurred())
+		})
+
+		it("fails when the token is not a JWT", func() {
+			ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "abcd"})
+			chClient, err := credhub.New(server.URL, credhub.NewTokenAuthClient(server.Client(), ts))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = chClient.WhoAmI()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("authenticating with a CF instance identity", func() {
+		var dir string
+
+		cfClient := func(ous []string) *credhub.Client {
+			cert, key := instanceIdentityCert(ous, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+			Expect(ioutil.WriteFile(filepath.Join(dir, "cert"), cert, 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "key"), key, 0600)).To(Succeed())
+
+			hc, err := credhub.NewCFAppAuthClient(server.Client().Transport.(*http.Transport))
+			Expect(err).NotTo(HaveOccurred())
+
+			chClient, err := credhub.New(server.URL, hc)
+			Expect(err).NotTo(HaveOccurred())
+			return chClient
+		}
+
+		it.Before(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "instance-identity")
+			Expect(err).NotTo(HaveOccurred())
+
+			os.Setenv("CF_INSTANCE_CERT", filepath.Join(dir, "cert"))
+			os.Setenv("CF_INSTANCE_KEY", filepath.Join(dir, "key"))
+		})
+
+		it.After(func() {
+			os.Unsetenv("CF_INSTANCE_CERT")
+			os.Unsetenv("CF_INSTANCE_KEY")
+			os.RemoveAll(dir)
+		})
+
+		it("identifies the app", func() {
+			chClient := cfClient([]string{
+				"organization:0c8bd1b1-5c5e-4d1e-9a59-1f7d0a0e6d1a",
+				"space:7e1b2c3d-4e5f-4a6b-8c9d-0e1f2a3b4c5d",
+				"app:a7070559-6be0-4ffc-ad5d-7f7abe5f2a80",
+			})
+
+			actor, err := chClient.WhoAmI()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actor).To(Equal("mtls-app:a7070559-6be0-4ffc-ad5d-7f7abe5f2a80"))
+		})
+
+		it("fails when the certificate has no app GUID", func() {
+			chClient := cfClient(nil)
+
+			_, err := chClient.WhoAmI()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("using an arbitrary HTTPClient", func() {
+		it("fails", func() {
+			chClient, err := credhub.New(server.URL, server.Client())
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = chClient.WhoAmI()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}